@@ -0,0 +1,201 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jodydadescott/home-server/types"
+)
+
+type Config = types.AuditConfig
+type RecordEvent = types.RecordEvent
+
+const (
+	defaultMaxSize = 10 << 20
+)
+
+// Log is an append only log of record events stored as one JSON object per
+// line. When the file reaches the max size it is moved to a file with the
+// suffix .1, replacing the one before it, so at most two files are kept.
+type Log struct {
+	mutex   sync.Mutex
+	file    string
+	maxSize int64
+}
+
+func New(config *Config) *Log {
+
+	if config == nil {
+		panic("config is required")
+	}
+
+	file := types.DefaultAuditFile
+	if config.File != "" {
+		file = config.File
+	}
+
+	maxSize := int64(defaultMaxSize)
+	if config.MaxSize > 0 {
+		maxSize = config.MaxSize
+	}
+
+	return &Log{file: file, maxSize: maxSize}
+}
+
+// Append writes the events to the log. It has the signature of a dns event
+// handler. Errors are logged as there is no caller to return them to.
+func (t *Log) Append(events []*RecordEvent) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	err := t.append(events)
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("Unable to write audit log %s; error %s", t.file, err.Error()))
+	}
+}
+
+// rotated returns the name of the file the log is moved to when it is full
+func (t *Log) rotated() string {
+	return t.file + ".1"
+}
+
+func (t *Log) append(events []*RecordEvent) error {
+
+	err := os.MkdirAll(filepath.Dir(t.file), 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(t.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	encoder := json.NewEncoder(w)
+
+	for _, event := range events {
+		err := encoder.Encode(event)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.Size() < t.maxSize {
+		return nil
+	}
+
+	zap.L().Debug(fmt.Sprintf("Rotating audit log %s at %d bytes", t.file, info.Size()))
+	return os.Rename(t.file, t.rotated())
+}
+
+// Query returns the events between since and until (either may be zero) that
+// match the hostname (may be empty). The hostname matches the record name, or
+// the value of a PTR or CNAME, either as a short name or an FQDN. If limit is
+// greater than zero only the most recent events up to the limit are returned.
+//
+// The files are read without the lock held by Append so a query does not hold
+// up a refresh. A line that is being written when it is read is skipped.
+func (t *Log) Query(since, until time.Time, hostname string, limit int) ([]*RecordEvent, error) {
+
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+
+	var events []*RecordEvent
+
+	for _, file := range []string{t.rotated(), t.file} {
+
+		err := t.scan(file, func(event *RecordEvent) {
+
+			if !since.IsZero() && event.Time.Before(since) {
+				return
+			}
+
+			if !until.IsZero() && event.Time.After(until) {
+				return
+			}
+
+			if hostname != "" && !matchHostname(hostname, event.Name, event.Old, event.New) {
+				return
+			}
+
+			events = append(events, event)
+
+			if limit > 0 && len(events) >= limit*2 {
+				events = append(events[:0], events[len(events)-limit:]...)
+			}
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if limit > 0 && len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+
+	return events, nil
+}
+
+// scan calls fn for each event in the file. A file that does not exist has no
+// events.
+func (t *Log) scan(file string, fn func(*RecordEvent)) error {
+
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	line := 0
+
+	for scanner.Scan() {
+
+		line++
+
+		var event RecordEvent
+		err := json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			zap.L().Debug(fmt.Sprintf("Skipping invalid audit log %s line %d; error %s", file, line, err.Error()))
+			continue
+		}
+
+		fn(&event)
+	}
+
+	return scanner.Err()
+}
+
+func matchHostname(hostname string, names ...string) bool {
+	for _, name := range names {
+		name = strings.TrimSuffix(strings.ToLower(name), ".")
+		if name == hostname || strings.HasPrefix(name, hostname+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2023, 10, 17, 20, 0, 0, 0, time.UTC)
+
+// newEvents returns the nas being added, its IP changing, the printer being
+// added with a PTR record and the nas being removed an hour apart
+func newEvents() []*RecordEvent {
+	return []*RecordEvent{
+		{Time: start, Action: "added", Type: "A", Name: "nas.home.", New: "192.168.1.10"},
+		{Time: start.Add(time.Hour), Action: "changed", Type: "A", Name: "nas.home.", Old: "192.168.1.10", New: "192.168.1.11"},
+		{Time: start.Add(time.Hour * 2), Action: "added", Type: "A", Name: "printer.home.", New: "192.168.1.50"},
+		{Time: start.Add(time.Hour * 2), Action: "added", Type: "PTR", Name: "50.1.168.192.in-addr.arpa.", New: "printer.home."},
+		{Time: start.Add(time.Hour * 3), Action: "removed", Type: "A", Name: "nas.home.", Old: "192.168.1.11"},
+	}
+}
+
+func eventsString(events []*RecordEvent) string {
+	var s []string
+	for _, event := range events {
+		s = append(s, event.Action+" "+event.Type+" "+event.Name)
+	}
+	return strings.Join(s, ", ")
+}
+
+func TestQuery(t *testing.T) {
+
+	log := New(&Config{File: filepath.Join(t.TempDir(), "audit", "audit.log")})
+
+	// Nothing has been written yet
+	events, err := log.Query(time.Time{}, time.Time{}, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 0 {
+		t.Errorf("expected no events, got %s", eventsString(events))
+	}
+
+	all := newEvents()
+	log.Append(all[:2])
+	log.Append(all[2:])
+
+	tests := []struct {
+		name     string
+		since    time.Time
+		until    time.Time
+		hostname string
+		limit    int
+		expected string
+	}{
+		{
+			name:     "all",
+			expected: "added A nas.home., changed A nas.home., added A printer.home., added PTR 50.1.168.192.in-addr.arpa., removed A nas.home.",
+		},
+		{
+			name:     "since and until",
+			since:    start.Add(time.Hour),
+			until:    start.Add(time.Hour * 2),
+			expected: "changed A nas.home., added A printer.home., added PTR 50.1.168.192.in-addr.arpa.",
+		},
+		{
+			name:     "short name",
+			hostname: "nas",
+			expected: "added A nas.home., changed A nas.home., removed A nas.home.",
+		},
+		{
+			// The PTR record has the printer as its value
+			name:     "FQDN",
+			hostname: "Printer.Home.",
+			expected: "added A printer.home., added PTR 50.1.168.192.in-addr.arpa.",
+		},
+		{
+			name:     "other name",
+			hostname: "na",
+			expected: "",
+		},
+		{
+			name:     "limit",
+			limit:    2,
+			expected: "added PTR 50.1.168.192.in-addr.arpa., removed A nas.home.",
+		},
+		{
+			name:     "limit with hostname",
+			hostname: "nas",
+			limit:    1,
+			expected: "removed A nas.home.",
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			events, err := log.Query(test.since, test.until, test.hostname, test.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := eventsString(events); got != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestRotate(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "audit.log")
+
+	// Each append of one event is more than the max size
+	log := New(&Config{File: file, MaxSize: 10})
+
+	for _, event := range newEvents() {
+		log.Append([]*RecordEvent{event})
+	}
+
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("expected the log to be rotated, got %v", err)
+	}
+
+	// Only the last rotated file is kept
+	events, err := log.Query(time.Time{}, time.Time{}, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := eventsString(events); got != "removed A nas.home." {
+		t.Errorf("expected the last event, got %s", got)
+	}
+}
+
+func TestQueryInvalidLine(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "audit.log")
+
+	// A line that was being written when the file was read
+	content := `{"time":"2023-10-17T20:00:00Z","action":"added","type":"A","name":"nas.home.","new":"192.168.1.10"}` + "\n" + `{"time":"2023-10-17T21:00:00Z","act`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := New(&Config{File: file}).Query(time.Time{}, time.Time{}, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := eventsString(events); got != "added A nas.home." {
+		t.Errorf("expected the complete line, got %s", got)
+	}
+}
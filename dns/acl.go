@@ -0,0 +1,254 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+
+	"github.com/jodydadescott/home-server/util"
+)
+
+// Kinds of ACL denial
+const (
+	aclDenied          = "query"
+	aclLocalDenied     = "local"
+	aclRecursionDenied = "recursion"
+)
+
+const (
+	// aclLogInterval is how often the refusals of a client are logged
+	aclLogInterval = time.Minute
+
+	// aclLogClients is the number of clients whose last log time is kept
+	// before the ones that have not been logged for an interval are forgotten
+	aclLogClients = 1024
+)
+
+// acl decides which clients may query the server, the local zones and the
+// nameservers and counts the queries that it refuses. A nil acl allows every
+// client.
+type acl struct {
+	allow     []*net.IPNet
+	deny      []*net.IPNet
+	local     *aclRule
+	recursion *aclRule
+	mutex     sync.Mutex
+	status    ACLStatus
+	logged    map[string]*aclLog
+}
+
+// aclLog is when the refusals of a client were last logged and how many were
+// not logged since then
+type aclLog struct {
+	last       time.Time
+	suppressed int
+}
+
+// aclRule allows the clients in allow, or every client if it is empty, except
+// for the ones in deny. A nil rule allows every client.
+type aclRule struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+func newACL(config *ACLConfig) *acl {
+
+	if config == nil {
+		return nil
+	}
+
+	config = config.Clone()
+
+	t := &acl{
+		allow:  parseNetworks("ACL allow", config.Allow),
+		deny:   parseNetworks("ACL deny", config.Deny),
+		logged: make(map[string]*aclLog),
+	}
+
+	if config.Local != nil {
+		t.local = &aclRule{
+			allow: parseNetworks("ACL local allow", config.Local.Allow),
+			deny:  parseNetworks("ACL local deny", config.Local.Deny),
+		}
+	}
+
+	if config.Recursion != nil {
+		t.recursion = &aclRule{
+			allow: parseNetworks("ACL recursion allow", config.Recursion.Allow),
+			deny:  parseNetworks("ACL recursion deny", config.Recursion.Deny),
+		}
+	}
+
+	return t
+}
+
+// parseNetworks returns the networks for the CIDRs and panics if one is invalid
+func parseNetworks(name string, networks []string) []*net.IPNet {
+
+	var ipNets []*net.IPNet
+
+	for _, network := range networks {
+
+		ipNet, err := util.ParseNetwork(network)
+		if err != nil {
+			panic(fmt.Sprintf("%s %s", name, err.Error()))
+		}
+
+		ipNets = append(ipNets, ipNet)
+	}
+
+	return ipNets
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// allows returns true if the client is not denied and is allowed. A client
+// without an IP is only allowed if there are no networks.
+func allows(allow, deny []*net.IPNet, ip net.IP) bool {
+
+	if ip == nil {
+		return len(allow) == 0 && len(deny) == 0
+	}
+
+	if containsIP(deny, ip) {
+		return false
+	}
+
+	return len(allow) == 0 || containsIP(allow, ip)
+}
+
+func (t *aclRule) allows(ip net.IP) bool {
+	if t == nil {
+		return true
+	}
+	return allows(t.allow, t.deny, ip)
+}
+
+// allowQuery returns true if the client may query the server
+func (t *acl) allowQuery(ip net.IP) bool {
+	if t == nil {
+		return true
+	}
+	return allows(t.allow, t.deny, ip)
+}
+
+// allowLocal returns true if the client may query the local zones
+func (t *acl) allowLocal(ip net.IP) bool {
+	if t == nil {
+		return true
+	}
+	return t.local.allows(ip)
+}
+
+// allowRecursion returns true if the client may have queries forwarded
+func (t *acl) allowRecursion(ip net.IP) bool {
+	if t == nil {
+		return true
+	}
+	return t.recursion.allows(ip)
+}
+
+// refuse answers the query with REFUSED and counts the denial. The denials of
+// a client are logged at most once per interval with the number that were not
+// logged as each one is in the query log anyway.
+func (t *acl) refuse(server *Server, w dns.ResponseWriter, r *dns.Msg, kind, view string) {
+
+	client := w.RemoteAddr().String()
+	now := time.Now()
+
+	key := client
+	if ip := clientIP(w.RemoteAddr()); ip != nil {
+		key = ip.String()
+	}
+
+	t.mutex.Lock()
+
+	switch kind {
+	case aclLocalDenied:
+		t.status.LocalDenied++
+	case aclRecursionDenied:
+		t.status.RecursionDenied++
+	default:
+		t.status.Denied++
+	}
+
+	t.status.LastDenied = now
+	t.status.LastClient = client
+
+	log, suppressed := t.shouldLog(key, now)
+
+	t.mutex.Unlock()
+
+	if log {
+
+		name := ""
+		if len(r.Question) > 0 {
+			name = r.Question[0].Name
+		}
+
+		if suppressed > 0 {
+			zap.L().Info(fmt.Sprintf("Refused %s from %s; %s is denied by the ACL; %d more refusals were not logged", name, client, kind, suppressed))
+		} else {
+			zap.L().Info(fmt.Sprintf("Refused %s from %s; %s is denied by the ACL", name, client, kind))
+		}
+	}
+
+	m := new(dns.Msg)
+	m.SetRcode(r, dns.RcodeRefused)
+	w.WriteMsg(m)
+	server.logQuery(w, m, "acl", view)
+}
+
+// shouldLog returns true if a refusal for the client is to be logged and the
+// number of its refusals that were not logged since the last one. The caller
+// must hold the mutex.
+func (t *acl) shouldLog(client string, now time.Time) (bool, int) {
+
+	entry := t.logged[client]
+
+	if entry != nil && now.Sub(entry.last) < aclLogInterval {
+		entry.suppressed++
+		return false, 0
+	}
+
+	if entry == nil && len(t.logged) >= aclLogClients {
+		for k, v := range t.logged {
+			if now.Sub(v.last) >= aclLogInterval {
+				delete(t.logged, k)
+			}
+		}
+	}
+
+	suppressed := 0
+	if entry != nil {
+		suppressed = entry.suppressed
+	}
+
+	t.logged[client] = &aclLog{last: now}
+
+	return true, suppressed
+}
+
+func (t *acl) getStatus() *ACLStatus {
+
+	if t == nil {
+		return nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	status := t.status
+	return &status
+}
@@ -0,0 +1,150 @@
+package dns_test
+
+import (
+	"strings"
+	"testing"
+
+	mdns "github.com/miekg/dns"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/jodydadescott/home-server/dns"
+	"github.com/jodydadescott/home-server/dns/dnstest"
+	"github.com/jodydadescott/home-server/types"
+)
+
+func expectRcode(t *testing.T, address, source, name string, expected int) {
+	t.Helper()
+	if rcode := exchange(t, address, source, name, mdns.TypeA).Rcode; rcode != expected {
+		t.Errorf("%s from %s: expected %s, got %s", name, source, mdns.RcodeToString[expected], mdns.RcodeToString[rcode])
+	}
+}
+
+func TestACL(t *testing.T) {
+
+	config := newConfig(t)
+
+	config.ACL = &types.ACLConfig{
+		Local:     (&types.ACLRule{}).AddDeny("127.0.0.3"),
+		Recursion: (&types.ACLRule{}).AddAllow("127.0.0.0/30"),
+	}
+	config.ACL.AddAllow("127.0.0.0/29").AddDeny("127.0.0.5")
+
+	server, address := dnstest.Start(t, config)
+
+	// Allowed to query the local zones and to recurse
+	expectA(t, address, "127.0.0.1", "nas.home", "192.168.1.10")
+	expectA(t, address, "127.0.0.1", "other.org", "198.51.100.1")
+
+	// Not allowed to query the local zones
+	expectRcode(t, address, "127.0.0.3", "nas.home", mdns.RcodeRefused)
+	expectRcode(t, address, "127.0.0.3", "10.1.168.192.in-addr.arpa", mdns.RcodeRefused)
+	expectA(t, address, "127.0.0.3", "other.org", "198.51.100.1")
+
+	// Not allowed to recurse
+	expectA(t, address, "127.0.0.4", "nas.home", "192.168.1.10")
+	expectA(t, address, "127.0.0.4", "www.example.com", "10.0.0.80")
+	expectRcode(t, address, "127.0.0.4", "other.org", mdns.RcodeRefused)
+	expectRcode(t, address, "127.0.0.4", "missing.home", mdns.RcodeRefused)
+
+	// Denied and not allowed
+	expectRcode(t, address, "127.0.0.5", "nas.home", mdns.RcodeRefused)
+	expectRcode(t, address, "127.0.0.9", "nas.home", mdns.RcodeRefused)
+	expectRcode(t, address, "127.0.0.9", "other.org", mdns.RcodeRefused)
+
+	status := server.GetACLStatus()
+	if status == nil {
+		t.Fatal("expected an ACL status")
+	}
+
+	if status.Denied != 3 || status.LocalDenied != 2 || status.RecursionDenied != 2 {
+		t.Errorf("unexpected ACL status %+v", status)
+	}
+
+	if !strings.HasPrefix(status.LastClient, "127.0.0.9:") || status.LastDenied.IsZero() {
+		t.Errorf("unexpected last denial %s at %s", status.LastClient, status.LastDenied)
+	}
+
+	refused := 0
+	for _, entry := range server.GetQueryLog() {
+		if entry.Source == "acl" && entry.Rcode == "REFUSED" {
+			refused++
+		}
+	}
+
+	if refused != 7 {
+		t.Errorf("expected 7 refused queries in the query log, got %d", refused)
+	}
+}
+
+func TestACLLogging(t *testing.T) {
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+
+	config := newConfig(t)
+	config.ACL = (&types.ACLConfig{}).AddDeny("127.0.0.5", "127.0.0.6")
+
+	server, address := dnstest.Start(t, config)
+
+	// A client that is refused is logged once per interval
+	for i := 0; i < 3; i++ {
+		expectRcode(t, address, "127.0.0.5", "nas.home", mdns.RcodeRefused)
+	}
+	expectRcode(t, address, "127.0.0.6", "nas.home", mdns.RcodeRefused)
+
+	if status := server.GetACLStatus(); status.Denied != 4 {
+		t.Errorf("expected 4 denied queries, got %d", status.Denied)
+	}
+
+	refused := logs.FilterMessageSnippet("Refused nas.home.").All()
+	if len(refused) != 2 {
+		t.Fatalf("expected 2 refusals to be logged, got %d", len(refused))
+	}
+
+	for i, client := range []string{"127.0.0.5:", "127.0.0.6:"} {
+		if !strings.Contains(refused[i].Message, "from "+client) {
+			t.Errorf("expected a refusal from %s to be logged, got %s", client, refused[i].Message)
+		}
+	}
+}
+
+func TestACLWithViews(t *testing.T) {
+
+	config := newConfig(t)
+
+	// Guests may only use the local zones of their view
+	guest := &types.ViewConfig{Name: "guest"}
+	guest.AddNetworks(guestClient).AddProviders("remote")
+	config.AddView(guest)
+
+	config.ACL = &types.ACLConfig{Recursion: (&types.ACLRule{}).AddDeny(guestClient)}
+
+	server, address := dnstest.Start(t, config)
+
+	expectA(t, address, guestClient, "www.example.com", "10.0.0.80")
+	expectRcode(t, address, guestClient, "nas.home", mdns.RcodeRefused)
+	expectA(t, address, defaultClient, "nas.home", "192.168.1.10")
+
+	for _, entry := range server.GetQueryLog() {
+		if entry.Source == "acl" && entry.View != "guest" {
+			t.Errorf("expected the refused query in the guest view, got %q", entry.View)
+		}
+	}
+}
+
+func TestNoACL(t *testing.T) {
+
+	if status := dns.New(&dns.Config{}).GetACLStatus(); status != nil {
+		t.Errorf("expected no ACL status, got %+v", status)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for an invalid network")
+		}
+	}()
+
+	dns.New(&dns.Config{ACL: (&types.ACLConfig{}).AddAllow("192.168.1.0/24", "lan")})
+}
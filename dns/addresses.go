@@ -0,0 +1,68 @@
+package dns
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"strings"
+)
+
+// addresses is the set of A or AAAA records for a name from one provider.
+// Each record has a different IP.
+type addresses []*ARecord
+
+// GetKey returns the name the addresses are for
+func (t addresses) GetKey() string {
+	return t[0].GetKey()
+}
+
+// GetValue returns the IPs so that a change to any of them is a change to the
+// set
+func (t addresses) GetValue() string {
+
+	var ips []string
+	for _, r := range t {
+		ips = append(ips, r.IP)
+	}
+
+	return strings.Join(ips, ", ")
+}
+
+// addressSets is the addresses for each name
+type addressSets map[string]addresses
+
+// add adds the record to the set for its name unless the set already has the
+// IP
+func (t addressSets) add(r *ARecord) {
+
+	key := r.GetKey()
+
+	for _, existing := range t[key] {
+		if existing.IP == r.IP {
+			return
+		}
+	}
+
+	t[key] = append(t[key], r)
+}
+
+// sort puts the addresses for each name in order of their IP so the value of a
+// set does not depend on the order the provider returned them in
+func (t addressSets) sort() {
+	for _, set := range t {
+		sort.SliceStable(set, func(i, j int) bool {
+			return bytes.Compare(net.ParseIP(set[i].IP).To16(), net.ParseIP(set[j].IP).To16()) < 0
+		})
+	}
+}
+
+// count returns the number of records in all of the sets
+func (t addressSets) count() int {
+
+	count := 0
+	for _, set := range t {
+		count += len(set)
+	}
+
+	return count
+}
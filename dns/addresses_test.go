@@ -0,0 +1,84 @@
+package dns_test
+
+import (
+	"strings"
+	"testing"
+
+	mdns "github.com/miekg/dns"
+
+	"github.com/jodydadescott/home-server/dns"
+	"github.com/jodydadescott/home-server/dns/dnstest"
+	"github.com/jodydadescott/home-server/types"
+)
+
+func TestAddresses(t *testing.T) {
+
+	config := &dns.Config{ConflictPolicy: types.ConflictPolicyAll}
+	config.AddProvider(&provider{name: "unifi", domain: "home", records: map[string]string{
+		"nas": "192.168.1.11,192.168.1.10,2001:db8::10,192.168.1.10",
+		"tv":  "192.168.1.31,192.168.1.30",
+	}})
+	config.AddProvider(&provider{name: "static", domain: "home", records: map[string]string{
+		"nas": "192.168.1.9,192.168.1.10",
+	}})
+
+	server, address := dnstest.Start(t, config)
+
+	// The addresses of a provider are in order of their IP and an IP is only
+	// answered once
+	tests := []struct {
+		qtype    uint16
+		expected string
+	}{
+		{mdns.TypeA, "192.168.1.10 192.168.1.11 192.168.1.9"},
+		{mdns.TypeAAAA, "2001:db8::10"},
+	}
+
+	for _, test := range tests {
+		if got := strings.Join(answers(exchange(t, address, "127.0.0.1", "nas.home", test.qtype)), " "); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", mdns.TypeToString[test.qtype], test.expected, got)
+		}
+	}
+
+	expectA(t, address, "127.0.0.1", "tv.home", "192.168.1.30", "192.168.1.31")
+
+	// The addresses of the tv are all from one provider so they are not a
+	// conflict
+	expected := "A nas.home. *unifi(0)=192.168.1.10,*unifi(0)=192.168.1.11,*static(0)=192.168.1.9,*static(0)=192.168.1.10"
+	if got := conflictsString(server.GetConflicts()); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
+
+func TestShuffle(t *testing.T) {
+
+	ips := []string{"192.168.1.10", "192.168.1.11", "192.168.1.12", "192.168.1.13", "192.168.1.14"}
+
+	for _, shuffle := range []bool{false, true} {
+
+		config := &dns.Config{Shuffle: shuffle}
+		config.AddProvider(&provider{name: "unifi", domain: "home", records: map[string]string{"nas": strings.Join(ips, ",")}})
+
+		_, address := dnstest.Start(t, config)
+
+		orders := make(map[string]bool)
+
+		for i := 0; i < 20; i++ {
+			values := answers(exchange(t, address, "127.0.0.1", "nas.home", mdns.TypeA))
+			if len(values) != len(ips) {
+				t.Fatalf("expected %d answers, got %v", len(ips), values)
+			}
+			orders[strings.Join(values, " ")] = true
+		}
+
+		// The chance of 20 shuffles of 5 IPs all being in the same order is
+		// too small to matter
+		if shuffle && len(orders) == 1 {
+			t.Error("expected the answers to be shuffled")
+		}
+
+		if !shuffle && (len(orders) != 1 || !orders[strings.Join(ips, " ")]) {
+			t.Errorf("expected the answers in order, got %v", orders)
+		}
+	}
+}
@@ -2,10 +2,14 @@ package dns
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"go.uber.org/zap"
+
+	"github.com/jodydadescott/home-server/types"
+	"github.com/jodydadescott/home-server/util"
 )
 
 const (
@@ -13,24 +17,37 @@ const (
 )
 
 type Client struct {
-	mutex  sync.RWMutex
-	ticker *xticker
+	mutex        sync.RWMutex
+	refreshMutex sync.Mutex
+	ticker       *xticker
 	Provider
 	done         chan bool
-	aRecords     map[string]*ARecord
-	aaaaRecords  map[string]*ARecord
+	watchDone    chan struct{}
+	aRecords     addressSets
+	aaaaRecords  addressSets
 	ptrRecords   map[string]*PTRrecord
 	cnameRecords map[string]*CNameRecord
+	srvRecords   recordSets[*SRVRecord]
+	txtRecords   recordSets[*TXTRecord]
+	lastRefresh  time.Time
+	lastSuccess  time.Time
+	lastError    error
+	failingSince time.Time
+	loaded       bool
+	onChange     func([]*RecordEvent)
+	onDomain     func(string)
 	trace        bool
 }
 
-func newClient(provider Provider, trace bool) *Client {
+func newClient(provider Provider, trace bool, onChange func([]*RecordEvent), onDomain func(string)) *Client {
 	if provider == nil {
 		panic("provider is nil")
 	}
 
 	return &Client{
 		Provider: provider,
+		onChange: onChange,
+		onDomain: onDomain,
 		trace:    trace,
 	}
 }
@@ -80,6 +97,18 @@ func (t *Client) run() error {
 		t.ticker = &xticker{}
 	}
 
+	if watcher, ok := t.Provider.(Watcher); ok {
+		zap.L().Info(fmt.Sprintf("Watching %s for changes", t.GetName()))
+		t.watchDone = make(chan struct{})
+		go watcher.Watch(t.watchDone, func() {
+			zap.L().Debug(fmt.Sprintf("Running refresh for %s on change", t.GetName()))
+			err := t.refresh()
+			if err != nil {
+				zap.L().Error(fmt.Sprintf("Refresh for %s failed; error %s", t.GetName(), err.Error()))
+			}
+		})
+	}
+
 	if t.GetRefreshDuration() <= 0 {
 		zap.L().Info(fmt.Sprintf("Refresh for %s is not enabled", t.GetName()))
 		return t.refresh()
@@ -118,6 +147,10 @@ func (t *Client) shutdown() {
 		t.done <- true
 	}
 
+	if t.watchDone != nil {
+		close(t.watchDone)
+	}
+
 }
 
 func (t *Client) getARecords() []*ARecord {
@@ -127,8 +160,8 @@ func (t *Client) getARecords() []*ARecord {
 
 	var records []*ARecord
 
-	for _, record := range t.aRecords {
-		records = append(records, record)
+	for _, set := range t.aRecords {
+		records = append(records, set...)
 	}
 
 	return records
@@ -141,14 +174,72 @@ func (t *Client) getAAAARecords() []*ARecord {
 
 	var records []*ARecord
 
-	for _, record := range t.aaaaRecords {
+	for _, set := range t.aaaaRecords {
+		records = append(records, set...)
+	}
+
+	return records
+}
+
+func (t *Client) getPTRRecords() []*PTRrecord {
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	var records []*PTRrecord
+
+	for _, record := range t.ptrRecords {
+		records = append(records, record)
+	}
+
+	return records
+}
+
+func (t *Client) getCNameRecords() []*CNameRecord {
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	var records []*CNameRecord
+
+	for _, record := range t.cnameRecords {
 		records = append(records, record)
 	}
 
 	return records
 }
 
-func (t *Client) getARecord(name string) *ARecord {
+func (t *Client) getSRVRecords() []*SRVRecord {
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	var records []*SRVRecord
+
+	for _, set := range t.srvRecords {
+		records = append(records, set...)
+	}
+
+	return records
+}
+
+func (t *Client) getTXTRecords() []*TXTRecord {
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	var records []*TXTRecord
+
+	for _, set := range t.txtRecords {
+		records = append(records, set...)
+	}
+
+	return records
+}
+
+// getARecordSet returns the A records for the name. A name may have more than
+// one A record such as for a host with more than one interface.
+func (t *Client) getARecordSet(name string) []*ARecord {
 
 	t.mutex.RLock()
 	defer t.mutex.RUnlock()
@@ -160,7 +251,8 @@ func (t *Client) getARecord(name string) *ARecord {
 	return t.aRecords[name]
 }
 
-func (t *Client) getAAAARecord(name string) *ARecord {
+// getAAAARecordSet returns the AAAA records for the name
+func (t *Client) getAAAARecordSet(name string) []*ARecord {
 
 	t.mutex.RLock()
 	defer t.mutex.RUnlock()
@@ -196,12 +288,129 @@ func (t *Client) getCNameRecord(name string) *CNameRecord {
 	return t.cnameRecords[name]
 }
 
+// getSRVRecordSet returns the SRV records for the name such as for a service
+// with more than one target
+func (t *Client) getSRVRecordSet(name string) []*SRVRecord {
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	if t.srvRecords == nil {
+		return nil
+	}
+
+	return t.srvRecords[name]
+}
+
+// getTXTRecordSet returns the TXT records for the name
+func (t *Client) getTXTRecordSet(name string) []*TXTRecord {
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	if t.txtRecords == nil {
+		return nil
+	}
+
+	return t.txtRecords[name]
+}
+
+// reverseZone returns the reverse zone of the /24 or /64 the ARPA name is in
+// so that PTR queries for it are answered locally
+func reverseZone(arpa string) string {
+
+	ip, err := util.GetIP(arpa)
+	if err != nil {
+		return ""
+	}
+
+	cidr := ip + "/24"
+	if strings.Contains(ip, ":") {
+		cidr = ip + "/64"
+	}
+
+	zone, err := util.GetReverseZone(cidr)
+	if err != nil {
+		return ""
+	}
+
+	return zone
+}
+
+// getPriority returns the configured priority of the provider or 0
+func (t *Client) getPriority() int {
+	if p, ok := t.Provider.(Prioritized); ok {
+		return p.GetPriority()
+	}
+	return 0
+}
+
+// isStatic returns true if the records of the provider are set by hand
+func (t *Client) isStatic() bool {
+	if s, ok := t.Provider.(Static); ok {
+		return s.Static()
+	}
+	return false
+}
+
+func (t *Client) getStatus() *ProviderStatus {
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	status := &ProviderStatus{
+		Name:         t.GetName(),
+		Domain:       t.GetDomainName(),
+		LastRefresh:  t.lastRefresh,
+		LastSuccess:  t.lastSuccess,
+		FailingSince: t.failingSince,
+		Priority:     t.getPriority(),
+		Records:      t.aRecords.count() + t.aaaaRecords.count() + len(t.ptrRecords) + len(t.cnameRecords) + t.srvRecords.count() + t.txtRecords.count(),
+	}
+
+	if t.GetRefreshDuration() > 0 {
+		status.Refresh = t.GetRefreshDuration().String()
+	}
+
+	if t.lastError != nil {
+		status.LastError = t.lastError.Error()
+	}
+
+	return status
+}
+
 func (t *Client) refresh() error {
 
-	aRecords := make(map[string]*ARecord)
-	aaaRecords := make(map[string]*ARecord)
+	t.refreshMutex.Lock()
+	defer t.refreshMutex.Unlock()
+
+	err := t.load()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.lastRefresh = time.Now()
+	t.lastError = err
+
+	if err == nil {
+		t.lastSuccess = t.lastRefresh
+		t.failingSince = time.Time{}
+	} else if t.failingSince.IsZero() {
+		t.failingSince = t.lastRefresh
+	}
+
+	return err
+}
+
+func (t *Client) load() error {
+
+	aRecords := make(addressSets)
+	aaaRecords := make(addressSets)
 	ptrRecords := make(map[string]*PTRrecord)
 	cnameRecords := make(map[string]*CNameRecord)
+	srvRecords := make(recordSets[*SRVRecord])
+	txtRecords := make(recordSets[*TXTRecord])
+	domains := make(map[string]bool)
 
 	records, err := t.GetRecords()
 	if err != nil {
@@ -217,7 +426,8 @@ func (t *Client) refresh() error {
 			if t.trace {
 				zap.L().Debug(fmt.Sprintf("Loading %s record with key %s and value %s", "A", r.GetKey(), r.GetValue()))
 			}
-			aRecords[r.GetKey()] = r
+			aRecords.add(r)
+			domains[r.Domain] = true
 		}
 	}
 
@@ -230,7 +440,8 @@ func (t *Client) refresh() error {
 			if t.trace {
 				zap.L().Debug(fmt.Sprintf("Loading %s record with key %s and value %s", "AAAA", r.GetKey(), r.GetValue()))
 			}
-			aaaRecords[r.GetKey()] = r
+			aaaRecords.add(r)
+			domains[r.Domain] = true
 		}
 	}
 
@@ -244,6 +455,9 @@ func (t *Client) refresh() error {
 				zap.L().Debug(fmt.Sprintf("Loading %s record with key %s and value %s", "PTR", r.GetKey(), r.GetValue()))
 			}
 			ptrRecords[r.GetKey()] = r
+			if zone := reverseZone(r.ARPA); zone != "" {
+				domains[zone] = true
+			}
 		}
 	}
 
@@ -261,16 +475,95 @@ func (t *Client) refresh() error {
 				zap.L().Debug(fmt.Sprintf("Loading %s record with key %s and value %s", "CNAME", r.GetKey(), r.GetValue()))
 			}
 			cnameRecords[r.GetKey()] = r
+			domains[r.AliasDomain] = true
 		}
 	}
 
+	if records.SrvRecords != nil {
+		for _, r := range records.SrvRecords {
+			r = r.Clone()
+			if r.Domain == "" {
+				r.Domain = t.GetDomainName()
+			}
+			if r.TargetDomain == "" {
+				r.TargetDomain = t.GetDomainName()
+			}
+			if t.trace {
+				zap.L().Debug(fmt.Sprintf("Loading %s record with key %s and value %s", "SRV", r.GetKey(), r.GetValue()))
+			}
+			srvRecords.add(r)
+			domains[r.Domain] = true
+		}
+	}
+
+	if records.TxtRecords != nil {
+		for _, r := range records.TxtRecords {
+			r = r.Clone()
+			if r.Domain == "" {
+				r.Domain = t.GetDomainName()
+			}
+			if t.trace {
+				zap.L().Debug(fmt.Sprintf("Loading %s record with key %s and value %s", "TXT", r.GetKey(), r.GetValue()))
+			}
+			txtRecords.add(r)
+			domains[r.Domain] = true
+		}
+	}
+
+	aRecords.sort()
+	aaaRecords.sort()
+	srvRecords.sort()
+	txtRecords.sort()
+
 	t.mutex.Lock()
-	defer t.mutex.Unlock()
+
+	// The first load is the baseline so it does not produce events
+	var events []*RecordEvent
+	if t.loaded {
+		events = append(events, diff(t.GetName(), "A", t.aRecords, aRecords, aSRC)...)
+		events = append(events, diff(t.GetName(), "AAAA", t.aaaaRecords, aaaRecords, aSRC)...)
+		events = append(events, diff(t.GetName(), "PTR", t.ptrRecords, ptrRecords, ptrSRC)...)
+		events = append(events, diff(t.GetName(), "CNAME", t.cnameRecords, cnameRecords, cnameSRC)...)
+		events = append(events, diff(t.GetName(), "SRV", t.srvRecords, srvRecords, srvSRC)...)
+		events = append(events, diff(t.GetName(), "TXT", t.txtRecords, txtRecords, txtSRC)...)
+	}
 
 	t.aRecords = aRecords
 	t.aaaaRecords = aaaRecords
 	t.ptrRecords = ptrRecords
 	t.cnameRecords = cnameRecords
+	t.srvRecords = srvRecords
+	t.txtRecords = txtRecords
+	t.loaded = true
+
+	t.mutex.Unlock()
+
+	if multiDomain, ok := t.Provider.(MultiDomain); ok {
+		for _, domain := range multiDomain.GetDomainNames() {
+			domains[domain] = true
+		}
+	}
+
+	if t.onDomain != nil {
+		for domain := range domains {
+			t.onDomain(domain)
+		}
+	}
+
+	for _, event := range events {
+		switch event.Action {
+		case types.RecordAdded:
+			zap.L().Info(fmt.Sprintf("%s %s record %s added with value %s", t.GetName(), event.Type, event.Name, event.New))
+		case types.RecordRemoved:
+			zap.L().Info(fmt.Sprintf("%s %s record %s removed; value was %s", t.GetName(), event.Type, event.Name, event.Old))
+		case types.RecordChanged:
+			zap.L().Info(fmt.Sprintf("%s %s record %s changed from %s to %s", t.GetName(), event.Type, event.Name, event.Old, event.New))
+		}
+	}
+
+	if len(events) > 0 && t.onChange != nil {
+		t.onChange(events)
+	}
 
 	return nil
 }
@@ -0,0 +1,154 @@
+package dns
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/jodydadescott/home-server/types"
+)
+
+// GetConflicts returns the names that more than one provider has records for.
+// The claims are in the order the providers are asked so the claims of the
+// first provider are the ones that are used unless the policy is to answer with
+// all of the IPs.
+func (t *Server) GetConflicts() []*Conflict {
+
+	claims := make(map[string]*Conflict)
+	owners := make(map[string][]*Client)
+	var keys []string
+
+	add := func(client *Client, recordType, name, value, src string) {
+
+		key := name + " " + recordType
+
+		conflict := claims[key]
+		if conflict == nil {
+			conflict = &Conflict{Name: name, Type: recordType}
+			claims[key] = conflict
+			keys = append(keys, key)
+		}
+
+		conflict.Claims = append(conflict.Claims, &Claim{
+			Provider: client.GetName(),
+			Priority: client.getPriority(),
+			Value:    value,
+			SRC:      src,
+		})
+
+		owners[key] = append(owners[key], client)
+	}
+
+	for _, client := range t.clients {
+
+		for _, r := range client.getARecords() {
+			add(client, "A", r.GetKey(), r.GetValue(), r.SRC)
+		}
+
+		for _, r := range client.getAAAARecords() {
+			add(client, "AAAA", r.GetKey(), r.GetValue(), r.SRC)
+		}
+
+		for _, r := range client.getPTRRecords() {
+			add(client, "PTR", r.GetKey(), r.GetValue(), r.SRC)
+		}
+
+		for _, r := range client.getCNameRecords() {
+			add(client, "CNAME", r.GetKey(), r.GetValue(), r.SRC)
+		}
+
+		for _, r := range client.getSRVRecords() {
+			add(client, "SRV", r.GetKey(), r.GetValue(), r.SRC)
+		}
+
+		for _, r := range client.getTXTRecords() {
+			add(client, "TXT", r.GetKey(), r.GetValue(), r.SRC)
+		}
+	}
+
+	sort.Strings(keys)
+
+	var conflicts []*Conflict
+
+	for _, key := range keys {
+
+		conflict := claims[key]
+		clients := owners[key]
+
+		// A provider may have more than one A or AAAA record for a name so it
+		// is only a conflict if another provider has one too
+		if clients[0] == clients[len(clients)-1] {
+			continue
+		}
+
+		all := t.policy == types.ConflictPolicyAll && (conflict.Type == "A" || conflict.Type == "AAAA")
+
+		for i, claim := range conflict.Claims {
+			claim.Winner = all || clients[i] == clients[0]
+		}
+
+		conflicts = append(conflicts, conflict)
+	}
+
+	return conflicts
+}
+
+// GetCollisions returns the names that the providers gave to records that had
+// the same name
+func (t *Server) GetCollisions() []*NameCollision {
+
+	var collisions []*NameCollision
+
+	for _, client := range t.clients {
+		if colliding, ok := client.Provider.(Colliding); ok {
+			collisions = append(collisions, colliding.GetCollisions()...)
+		}
+	}
+
+	return collisions
+}
+
+// checkConflicts logs the conflicts that are new or have changed since the
+// last check and the conflicts that were resolved
+func (t *Server) checkConflicts() {
+
+	conflicts := t.GetConflicts()
+
+	t.conflictMutex.Lock()
+	defer t.conflictMutex.Unlock()
+
+	current := make(map[string]string)
+
+	for _, conflict := range conflicts {
+
+		var claims []string
+		var winners []string
+
+		for _, claim := range conflict.Claims {
+			claims = append(claims, fmt.Sprintf("%s (%s)", claim.Provider, claim.Value))
+			if claim.Winner && (len(winners) == 0 || winners[len(winners)-1] != claim.Provider) {
+				winners = append(winners, claim.Provider)
+			}
+		}
+
+		key := conflict.Type + " record " + conflict.Name
+		summary := strings.Join(claims, ", ")
+		current[key] = summary
+
+		if t.conflicts[key] == summary {
+			continue
+		}
+
+		zap.L().Warn(fmt.Sprintf("%s record %s is claimed by %s; answering with %s", conflict.Type, conflict.Name, summary, strings.Join(winners, ", ")))
+	}
+
+	for key := range t.conflicts {
+		if _, ok := current[key]; !ok {
+			zap.L().Info(fmt.Sprintf("%s is no longer claimed by more than one provider", key))
+		}
+	}
+
+	t.conflicts = current
+}
@@ -0,0 +1,136 @@
+package dns_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jodydadescott/home-server/dns"
+	"github.com/jodydadescott/home-server/dns/dnstest"
+	"github.com/jodydadescott/home-server/types"
+)
+
+// conflictsString returns the claims of each conflict with a * for the ones
+// that are used
+func conflictsString(conflicts []*types.Conflict) string {
+
+	var s []string
+
+	for _, conflict := range conflicts {
+
+		var claims []string
+		for _, claim := range conflict.Claims {
+			winner := ""
+			if claim.Winner {
+				winner = "*"
+			}
+			claims = append(claims, fmt.Sprintf("%s%s(%d)=%s", winner, claim.Provider, claim.Priority, claim.Value))
+		}
+
+		s = append(s, conflict.Type+" "+conflict.Name+" "+strings.Join(claims, ","))
+	}
+
+	return strings.Join(s, "; ")
+}
+
+func TestConflictPolicy(t *testing.T) {
+
+	tests := []struct {
+		policy    string
+		expected  []string
+		conflicts string
+	}{
+		{
+			// The providers are asked in the order they were added
+			policy:    "",
+			expected:  []string{"192.168.1.20"},
+			conflicts: "A nas.home. *unifi(0)=192.168.1.20,static(0)=192.168.1.10",
+		},
+		{
+			policy:    types.ConflictPolicyFirstWins,
+			expected:  []string{"192.168.1.20"},
+			conflicts: "A nas.home. *unifi(0)=192.168.1.20,static(0)=192.168.1.10",
+		},
+		{
+			policy:    types.ConflictPolicyStaticOverridesDynamic,
+			expected:  []string{"192.168.1.10"},
+			conflicts: "A nas.home. *static(0)=192.168.1.10,unifi(0)=192.168.1.20",
+		},
+		{
+			policy:    types.ConflictPolicyAll,
+			expected:  []string{"192.168.1.10", "192.168.1.20"},
+			conflicts: "A nas.home. *unifi(0)=192.168.1.20,*static(0)=192.168.1.10",
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.policy, func(t *testing.T) {
+
+			config := &dns.Config{ConflictPolicy: test.policy}
+			config.AddProvider(&provider{name: "unifi", domain: "home", records: map[string]string{"nas": "192.168.1.20", "tv": "192.168.1.30"}})
+			config.AddProvider(&provider{name: "static", domain: "home", records: map[string]string{"nas": "192.168.1.10"}, static: true})
+
+			server, address := dnstest.Start(t, config)
+
+			expectA(t, address, "127.0.0.1", "nas.home", test.expected...)
+			expectA(t, address, "127.0.0.1", "tv.home", "192.168.1.30")
+
+			if got := conflictsString(server.GetConflicts()); got != test.conflicts {
+				t.Errorf("expected %s, got %s", test.conflicts, got)
+			}
+		})
+	}
+}
+
+func TestConflictPriority(t *testing.T) {
+
+	tests := []struct {
+		policy    string
+		expected  string
+		conflicts string
+	}{
+		{
+			policy:    types.ConflictPolicyFirstWins,
+			expected:  "192.168.1.30",
+			conflicts: "A nas.home. *remote(10)=192.168.1.30,unifi(0)=192.168.1.20,static(0)=192.168.1.10",
+		},
+		{
+			// Static providers are asked before the others whatever their
+			// priority
+			policy:    types.ConflictPolicyStaticOverridesDynamic,
+			expected:  "192.168.1.10",
+			conflicts: "A nas.home. *static(0)=192.168.1.10,remote(10)=192.168.1.30,unifi(0)=192.168.1.20",
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.policy, func(t *testing.T) {
+
+			config := &dns.Config{ConflictPolicy: test.policy}
+			config.AddProvider(&provider{name: "unifi", domain: "home", records: map[string]string{"nas": "192.168.1.20"}})
+			config.AddProvider(&provider{name: "static", domain: "home", records: map[string]string{"nas": "192.168.1.10"}, static: true})
+			config.AddProvider(&provider{name: "remote", domain: "home", records: map[string]string{"nas": "192.168.1.30"}, priority: 10})
+
+			server, address := dnstest.Start(t, config)
+
+			expectA(t, address, "127.0.0.1", "nas.home", test.expected)
+
+			if got := conflictsString(server.GetConflicts()); got != test.conflicts {
+				t.Errorf("expected %s, got %s", test.conflicts, got)
+			}
+		})
+	}
+}
+
+func TestInvalidConflictPolicy(t *testing.T) {
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+
+	dns.New(&dns.Config{ConflictPolicy: "last-wins"})
+}
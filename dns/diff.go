@@ -0,0 +1,79 @@
+package dns
+
+import (
+	"time"
+
+	"github.com/jodydadescott/home-server/types"
+)
+
+// record is the common view of the record types needed to compare them
+type record interface {
+	GetKey() string
+	GetValue() string
+}
+
+// diff returns the events needed to get from the old records to the new
+// records. Records are matched on their key and are changed if their value
+// differs.
+func diff[T record](provider, recordType string, oldRecords, newRecords map[string]T, src func(T) string) []*RecordEvent {
+
+	var events []*RecordEvent
+
+	now := time.Now()
+
+	for key, n := range newRecords {
+
+		o, exist := oldRecords[key]
+
+		if !exist {
+			events = append(events, &RecordEvent{
+				Time:     now,
+				Action:   types.RecordAdded,
+				Type:     recordType,
+				Name:     key,
+				New:      n.GetValue(),
+				SRC:      src(n),
+				Provider: provider,
+			})
+			continue
+		}
+
+		if o.GetValue() != n.GetValue() {
+			events = append(events, &RecordEvent{
+				Time:     now,
+				Action:   types.RecordChanged,
+				Type:     recordType,
+				Name:     key,
+				Old:      o.GetValue(),
+				New:      n.GetValue(),
+				SRC:      src(n),
+				Provider: provider,
+			})
+		}
+	}
+
+	for key, o := range oldRecords {
+
+		if _, exist := newRecords[key]; exist {
+			continue
+		}
+
+		events = append(events, &RecordEvent{
+			Time:     now,
+			Action:   types.RecordRemoved,
+			Type:     recordType,
+			Name:     key,
+			Old:      o.GetValue(),
+			SRC:      src(o),
+			Provider: provider,
+		})
+	}
+
+	return events
+}
+
+func aSRC(r addresses) string               { return r[0].SRC }
+func ptrSRC(r *PTRrecord) string            { return r.SRC }
+func cnameSRC(r *CNameRecord) string        { return r.SRC }
+func srvSRC(r recordSet[*SRVRecord]) string { return r[0].SRC }
+func txtSRC(r recordSet[*TXTRecord]) string { return r[0].SRC }
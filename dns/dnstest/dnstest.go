@@ -0,0 +1,87 @@
+// Package dnstest runs the DNS server and fake nameservers on ephemeral
+// loopback ports for tests. The sockets are bound before the servers run so
+// queries can be sent as soon as they are returned.
+package dnstest
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	mdns "github.com/miekg/dns"
+
+	"github.com/jodydadescott/home-server/dns"
+	"github.com/jodydadescott/home-server/types"
+	"github.com/jodydadescott/home-server/types/proto"
+)
+
+// listen returns a UDP socket on an ephemeral loopback port
+func listen(t testing.TB) net.PacketConn {
+
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn
+}
+
+// Start runs the DNS server for the config and returns it and its address. The
+// server is stopped when the test ends.
+func Start(t testing.TB, config *dns.Config) (*dns.Server, string) {
+
+	t.Helper()
+
+	conn := listen(t)
+	config.PacketConns = append(config.PacketConns, conn)
+
+	s := dns.New(config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return s, conn.LocalAddr().String()
+}
+
+// Nameserver starts a nameserver that answers every A query with the IP so
+// that the answer shows which nameserver a query was forwarded to
+func Nameserver(t testing.TB, ip string) *types.NetPort {
+
+	t.Helper()
+
+	conn := listen(t)
+
+	started := make(chan struct{})
+
+	s := &mdns.Server{
+		PacketConn:        conn,
+		NotifyStartedFunc: func() { close(started) },
+		Handler: mdns.HandlerFunc(func(w mdns.ResponseWriter, r *mdns.Msg) {
+			m := new(mdns.Msg).SetReply(r)
+			if r.Question[0].Qtype == mdns.TypeA {
+				rr, _ := mdns.NewRR(r.Question[0].Name + " A " + ip)
+				m.Answer = append(m.Answer, rr)
+			}
+			w.WriteMsg(m)
+		}),
+	}
+
+	go s.ActivateAndServe()
+	<-started
+
+	t.Cleanup(func() { s.Shutdown() })
+
+	return &types.NetPort{IP: "127.0.0.1", Port: conn.LocalAddr().(*net.UDPAddr).Port, Proto: proto.UDP}
+}
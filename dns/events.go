@@ -0,0 +1,67 @@
+package dns
+
+import (
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+const (
+	subscriberBuffer = 100
+)
+
+// broker fans record events out to handlers and subscribers. Handlers are
+// called synchronously. A subscriber that falls behind loses events rather
+// than blocking refreshes.
+type broker struct {
+	mutex       sync.RWMutex
+	handlers    []func([]*RecordEvent)
+	subscribers map[chan *RecordEvent]bool
+}
+
+func newBroker(handlers []func([]*RecordEvent)) *broker {
+	return &broker{
+		handlers:    handlers,
+		subscribers: make(map[chan *RecordEvent]bool),
+	}
+}
+
+func (t *broker) subscribe() (<-chan *RecordEvent, func()) {
+
+	ch := make(chan *RecordEvent, subscriberBuffer)
+
+	t.mutex.Lock()
+	t.subscribers[ch] = true
+	t.mutex.Unlock()
+
+	var once sync.Once
+
+	return ch, func() {
+		once.Do(func() {
+			t.mutex.Lock()
+			delete(t.subscribers, ch)
+			t.mutex.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func (t *broker) publish(events []*RecordEvent) {
+
+	for _, handler := range t.handlers {
+		handler(events)
+	}
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	for ch := range t.subscribers {
+		for _, event := range events {
+			select {
+			case ch <- event:
+			default:
+				zap.L().Warn("Subscriber is not keeping up; dropping record event")
+			}
+		}
+	}
+}
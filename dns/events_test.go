@@ -0,0 +1,55 @@
+package dns
+
+import (
+	"testing"
+)
+
+func TestBroker(t *testing.T) {
+
+	var handled int
+
+	b := newBroker([]func([]*RecordEvent){
+		func(events []*RecordEvent) { handled += len(events) },
+	})
+
+	events, unsubscribe := b.subscribe()
+	slow, unsubscribeSlow := b.subscribe()
+	defer unsubscribeSlow()
+
+	b.publish([]*RecordEvent{{Action: "added", Name: "nas.home."}, {Action: "removed", Name: "tv.home."}})
+
+	if handled != 2 {
+		t.Errorf("expected the handler to get 2 events, got %d", handled)
+	}
+
+	for _, name := range []string{"nas.home.", "tv.home."} {
+		if event := <-events; event.Name != name {
+			t.Errorf("expected %s, got %s", name, event.Name)
+		}
+	}
+
+	// The slow subscriber loses the events that do not fit in its buffer but
+	// does not block the other subscriber
+	for i := 0; i < subscriberBuffer; i++ {
+		b.publish([]*RecordEvent{{Action: "changed", Name: "nas.home."}})
+		<-events
+	}
+
+	if len(slow) != subscriberBuffer {
+		t.Errorf("expected %d buffered events, got %d", subscriberBuffer, len(slow))
+	}
+
+	// Unsubscribing closes the channel and can be called more than once
+	unsubscribe()
+	unsubscribe()
+
+	if _, ok := <-events; ok {
+		t.Error("expected the channel to be closed")
+	}
+
+	b.publish([]*RecordEvent{{Action: "added", Name: "printer.home."}})
+
+	if handled != subscriberBuffer+3 {
+		t.Errorf("expected the handler to get %d events, got %d", subscriberBuffer+3, handled)
+	}
+}
@@ -0,0 +1,55 @@
+package dns
+
+import (
+	"sync"
+)
+
+const (
+	queryLogSize = 200
+)
+
+// queryLog is a fixed size ring of the most recent queries
+type queryLog struct {
+	mutex   sync.RWMutex
+	entries []*QueryLogEntry
+	next    int
+	full    bool
+}
+
+func newQueryLog(size int) *queryLog {
+	return &queryLog{entries: make([]*QueryLogEntry, size)}
+}
+
+func (t *queryLog) add(entry *QueryLogEntry) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.entries[t.next] = entry
+	t.next++
+
+	if t.next == len(t.entries) {
+		t.next = 0
+		t.full = true
+	}
+}
+
+// get returns the entries with the most recent first
+func (t *queryLog) get() []*QueryLogEntry {
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	count := t.next
+	if t.full {
+		count = len(t.entries)
+	}
+
+	var entries []*QueryLogEntry
+
+	for i := 1; i <= count; i++ {
+		entries = append(entries, t.entries[(t.next-i+len(t.entries))%len(t.entries)])
+	}
+
+	return entries
+}
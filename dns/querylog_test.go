@@ -0,0 +1,47 @@
+package dns
+
+import (
+	"strings"
+	"testing"
+)
+
+func queryLogString(entries []*QueryLogEntry) string {
+	var s []string
+	for _, entry := range entries {
+		s = append(s, entry.Name)
+	}
+	return strings.Join(s, ", ")
+}
+
+func TestQueryLog(t *testing.T) {
+
+	log := newQueryLog(3)
+
+	if entries := log.get(); len(entries) != 0 {
+		t.Errorf("expected no entries, got %s", queryLogString(entries))
+	}
+
+	// The most recent entries are first and the oldest are overwritten once the
+	// ring is full
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"a.home.", "a.home."},
+		{"b.home.", "b.home., a.home."},
+		{"c.home.", "c.home., b.home., a.home."},
+		{"d.home.", "d.home., c.home., b.home."},
+		{"e.home.", "e.home., d.home., c.home."},
+		{"f.home.", "f.home., e.home., d.home."},
+		{"g.home.", "g.home., f.home., e.home."},
+	}
+
+	for _, test := range tests {
+
+		log.add(&QueryLogEntry{Name: test.name})
+
+		if got := queryLogString(log.get()); got != test.expected {
+			t.Errorf("after %s: expected %s, got %s", test.name, test.expected, got)
+		}
+	}
+}
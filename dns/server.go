@@ -4,8 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math/rand"
+	"net"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/miekg/dns"
 	"go.uber.org/zap"
@@ -15,13 +20,23 @@ import (
 )
 
 type Server struct {
-	listeners    []*NetPort
-	domainNames  []string
-	udpDnsClient *dns.Client
-	tcpDnsClient *dns.Client
-	clients      []*Client
-	nameservers  []*NetPort
-	trace        bool
+	listeners     []*NetPort
+	packetConns   []net.PacketConn
+	domainMutex   sync.Mutex
+	defaultView   *view
+	views         []*view
+	acl           *acl
+	udpDnsClient  *dns.Client
+	tcpDnsClient  *dns.Client
+	clients       []*Client
+	nameservers   []*upstream
+	queryLog      *queryLog
+	events        *broker
+	policy        string
+	conflictMutex sync.Mutex
+	conflicts     map[string]string
+	shuffle       bool
+	trace         bool
 }
 
 func New(config *Config) *Server {
@@ -30,7 +45,7 @@ func New(config *Config) *Server {
 		panic("config is required")
 	}
 
-	if len(config.Listeners) <= 0 {
+	if len(config.Listeners) <= 0 && len(config.PacketConns) <= 0 {
 		config.Listeners = append(config.Listeners, &NetPort{
 			Port:  types.DefaultDnsPort,
 			Proto: types.DefaultDnsProto,
@@ -54,40 +69,93 @@ func New(config *Config) *Server {
 		}
 	}
 
-	var nameservers []*NetPort
-	for _, nameserver := range config.Nameservers {
+	nameservers := newUpstreams(config.Nameservers, "")
 
-		switch nameserver.Proto {
-
-		case proto.UDP, proto.TCP:
+	policy := config.ConflictPolicy
 
-		case proto.Empty:
-			nameserver.Proto = proto.UDP
+	switch policy {
 
-		default:
-			panic("Proto Invalid")
-		}
+	case types.ConflictPolicyFirstWins, types.ConflictPolicyStaticOverridesDynamic, types.ConflictPolicyAll:
 
-		if nameserver.Port <= 0 {
-			nameserver.Port = types.DefaultDnsPort
-		}
+	case "":
+		policy = types.ConflictPolicyFirstWins
 
-		nameservers = append(nameservers, nameserver)
+	default:
+		panic(fmt.Sprintf("conflict policy %s is invalid", policy))
 	}
 
 	c := &Server{
 		listeners:    config.Listeners,
+		packetConns:  config.PacketConns,
 		udpDnsClient: &dns.Client{Net: "udp", SingleInflight: true},
 		tcpDnsClient: &dns.Client{Net: "tcp", SingleInflight: true},
 		nameservers:  nameservers,
+		queryLog:     newQueryLog(queryLogSize),
+		events:       newBroker(config.EventHandlers),
+		policy:       policy,
+		conflicts:    make(map[string]string),
+		shuffle:      config.Shuffle,
 		trace:        config.Trace,
+		acl:          newACL(config.ACL),
 	}
 
 	for _, provider := range config.Providers {
 		if provider == nil {
 			panic("nil provider")
 		}
-		c.clients = append(c.clients, newClient(provider, c.trace))
+		var client *Client
+		client = newClient(provider, c.trace, c.onChange, func(domainName string) {
+			c.addDomainName(client, domainName)
+		})
+		c.clients = append(c.clients, client)
+	}
+
+	// Providers are asked in order so the order decides which record wins when
+	// more than one provider has a record for a name
+	sort.SliceStable(c.clients, func(i, j int) bool {
+		a, b := c.clients[i], c.clients[j]
+		if policy == types.ConflictPolicyStaticOverridesDynamic && a.isStatic() != b.isStatic() {
+			return a.isStatic()
+		}
+		return a.getPriority() > b.getPriority()
+	})
+
+	zap.L().Debug(fmt.Sprintf("Conflict policy is %s", policy))
+
+	for i, client := range c.clients {
+		zap.L().Debug(fmt.Sprintf("Provider %d is %s with priority %d", i+1, client.GetName(), client.getPriority()))
+	}
+
+	c.defaultView = &view{
+		server:      c,
+		clients:     c.clients,
+		nameservers: c.nameservers,
+		mux:         dns.NewServeMux(),
+	}
+
+	names := make(map[string]bool)
+
+	for _, viewConfig := range config.Views {
+
+		if viewConfig == nil {
+			panic("nil view")
+		}
+
+		v := newView(c, viewConfig)
+
+		if names[v.name] {
+			panic(fmt.Sprintf("view %s is not unique", v.name))
+		}
+		names[v.name] = true
+
+		c.views = append(c.views, v)
+
+		var providers []string
+		for _, client := range v.clients {
+			providers = append(providers, client.GetName())
+		}
+
+		zap.L().Debug(fmt.Sprintf("View %s is for %s with providers %s", v.name, strings.Join(viewConfig.Networks, ", "), strings.Join(providers, ", ")))
 	}
 
 	return c
@@ -100,122 +168,343 @@ func (t *Server) GetRecords() *DomainRecords {
 	for _, client := range t.clients {
 		records.ARecords = append(records.ARecords, client.getARecords()...)
 		records.AAAARecords = append(records.AAAARecords, client.getAAAARecords()...)
+		records.CnameRecords = append(records.CnameRecords, client.getCNameRecords()...)
+		records.PtrRecords = append(records.PtrRecords, client.getPTRRecords()...)
+		records.SrvRecords = append(records.SrvRecords, client.getSRVRecords()...)
+		records.TxtRecords = append(records.TxtRecords, client.getTXTRecords()...)
 	}
 
 	return records
 }
 
-func (t *Server) Run(ctx context.Context) error {
+// onChange publishes the record events from a provider refresh and checks if
+// the change added or removed a conflict
+func (t *Server) onChange(events []*RecordEvent) {
+	t.events.publish(events)
+	t.checkConflicts()
+}
 
-	getARecord := func(name string) *ARecord {
-		for _, client := range t.clients {
-			r := client.getARecord(name)
-			if r != nil {
-				return r
-			}
+// addDomainName registers the domain of the client to be handled locally in
+// the views that have the client. Providers may add domains when they are
+// refreshed so this may be called after the server has started.
+func (t *Server) addDomainName(client *Client, domainName string) {
+
+	domainName = strings.TrimSuffix(strings.ToLower(domainName), ".")
+	if domainName == "" {
+		return
+	}
+
+	t.domainMutex.Lock()
+	defer t.domainMutex.Unlock()
+
+	for _, v := range t.getViews() {
+		if v.hasClient(client) {
+			v.addDomainName(domainName)
 		}
-		return nil
+	}
+}
+
+// getViews returns the views with the default view last
+func (t *Server) getViews() []*view {
+	return append(append([]*view{}, t.views...), t.defaultView)
+}
+
+// clientIP returns the IP of the client or nil if it does not have one
+func clientIP(addr net.Addr) net.IP {
+
+	switch addr := addr.(type) {
+	case *net.UDPAddr:
+		return addr.IP
+	case *net.TCPAddr:
+		return addr.IP
 	}
 
-	getAAAARecord := func(name string) *ARecord {
-		for _, client := range t.clients {
-			r := client.getAAAARecord(name)
-			if r != nil {
-				return r
+	return nil
+}
+
+// getView returns the view for the client IP
+func (t *Server) getView(ip net.IP) *view {
+
+	if ip != nil {
+		for _, v := range t.views {
+			if v.contains(ip) {
+				return v
 			}
 		}
-		return nil
 	}
 
-	getPTRRecord := func(name string) *PTRrecord {
-		for _, client := range t.clients {
-			r := client.getPTRRecord(name)
-			if r != nil {
-				return r
+	return t.defaultView
+}
+
+// ServeDNS answers the query in the view for the client if the ACL allows the
+// client
+func (t *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+
+	ip := clientIP(w.RemoteAddr())
+
+	if !t.acl.allowQuery(ip) {
+		t.acl.refuse(t, w, r, aclDenied, "")
+		return
+	}
+
+	t.getView(ip).ServeDNS(w, r)
+}
+
+// GetACLStatus returns the number of queries refused by the ACL or nil if
+// there is no ACL
+func (t *Server) GetACLStatus() *ACLStatus {
+	return t.acl.getStatus()
+}
+
+// GetProviderStatus returns the refresh status of each provider
+func (t *Server) GetProviderStatus() []*ProviderStatus {
+
+	var status []*ProviderStatus
+
+	for _, client := range t.clients {
+		status = append(status, client.getStatus())
+	}
+
+	return status
+}
+
+// GetUpstreamStatus returns the health of each remote nameserver
+func (t *Server) GetUpstreamStatus() []*UpstreamStatus {
+
+	var status []*UpstreamStatus
+	seen := make(map[*upstream]bool)
+
+	add := func(nameservers []*upstream) {
+		for _, nameserver := range nameservers {
+			if !seen[nameserver] {
+				seen[nameserver] = true
+				status = append(status, nameserver.getStatus())
 			}
 		}
-		return nil
 	}
 
-	getCNameRecord := func(name string) *CNameRecord {
-		for _, client := range t.clients {
-			r := client.getCNameRecord(name)
-			if r != nil {
-				return r
-			}
+	// Views without their own nameservers use the nameservers of the server
+	add(t.nameservers)
+
+	for _, v := range t.views {
+		add(v.nameservers)
+		for _, f := range v.forwards {
+			add(f.nameservers)
 		}
-		return nil
 	}
 
-	handleRemote := func(w dns.ResponseWriter, r *dns.Msg) {
+	return status
+}
 
-		dnsClient := t.tcpDnsClient
+// Subscribe returns a channel of record events produced when providers are
+// refreshed and a func that must be called to unsubscribe
+func (t *Server) Subscribe() (<-chan *RecordEvent, func()) {
+	return t.events.subscribe()
+}
 
-		for _, nameserver := range t.nameservers {
+// GetQueryLog returns the most recent queries with the newest first
+func (t *Server) GetQueryLog() []*QueryLogEntry {
+	return t.queryLog.get()
+}
 
-			switch nameserver.Proto {
+func (t *Server) logQuery(w dns.ResponseWriter, m *dns.Msg, source, view string) {
 
-			case proto.TCP:
-				dnsClient = t.tcpDnsClient
+	for _, q := range m.Question {
 
-			case proto.UDP:
-				dnsClient = t.udpDnsClient
+		entry := &QueryLogEntry{
+			Time:   time.Now(),
+			Client: w.RemoteAddr().String(),
+			Name:   q.Name,
+			Type:   dns.TypeToString[q.Qtype],
+			Rcode:  dns.RcodeToString[m.Rcode],
+			Source: source,
+			View:   view,
+		}
 
+		for _, rr := range m.Answer {
+			entry.Answer = append(entry.Answer, rr.String())
+		}
+
+		t.queryLog.add(entry)
+	}
+}
+
+// getAddresses returns the records from the first provider that has any or,
+// if the policy is to answer with all of the IPs, the records with a unique
+// IP from every provider that has any. If shuffle is set the order of the
+// records is random so that clients spread across them.
+func (t *view) getAddresses(name string, get func(*Client, string) []*ARecord) []*ARecord {
+
+	var records []*ARecord
+	seen := make(map[string]bool)
+
+	for _, client := range t.clients {
+
+		for _, r := range get(client, name) {
+			if !seen[r.IP] {
+				seen[r.IP] = true
+				records = append(records, r)
 			}
+		}
 
-			r, _, err := dnsClient.Exchange(r, nameserver.GetIPColonPort())
+		if len(records) > 0 && t.server.policy != types.ConflictPolicyAll {
+			break
+		}
+	}
 
-			if err == nil {
-				rString, _ := json.Marshal(r)
+	if t.server.shuffle {
+		rand.Shuffle(len(records), func(i, j int) {
+			records[i], records[j] = records[j], records[i]
+		})
+	}
 
-				if r.Rcode == dns.RcodeSuccess {
-					r.Compress = true
-					w.WriteMsg(r)
+	return records
+}
 
-					if t.trace {
-						zap.L().Debug(fmt.Sprintf("Remote Nameserver %s responded with %s", nameserver.GetIPColonPort(), rString))
-					}
+func (t *view) getARecords(name string) []*ARecord {
+	return t.getAddresses(name, (*Client).getARecordSet)
+}
 
-					return
-				}
-			} else {
-				if t.trace {
-					zap.L().Debug(fmt.Sprintf("Remote Nameserver %s responded with error %s", nameserver.GetIPColonPort(), err.Error()))
+func (t *view) getAAAARecords(name string) []*ARecord {
+	return t.getAddresses(name, (*Client).getAAAARecordSet)
+}
+
+func (t *view) getPTRRecord(name string) *PTRrecord {
+	for _, client := range t.clients {
+		r := client.getPTRRecord(name)
+		if r != nil {
+			return r
+		}
+	}
+	return nil
+}
+
+func (t *view) getCNameRecord(name string) *CNameRecord {
+	for _, client := range t.clients {
+		r := client.getCNameRecord(name)
+		if r != nil {
+			return r
+		}
+	}
+	return nil
+}
+
+// getSRVRecords returns the SRV records of the first provider that has the
+// name
+func (t *view) getSRVRecords(name string) []*SRVRecord {
+	for _, client := range t.clients {
+		records := client.getSRVRecordSet(name)
+		if len(records) > 0 {
+			return records
+		}
+	}
+	return nil
+}
+
+// getTXTRecords returns the TXT records of the first provider that has the
+// name
+func (t *view) getTXTRecords(name string) []*TXTRecord {
+	for _, client := range t.clients {
+		records := client.getTXTRecordSet(name)
+		if len(records) > 0 {
+			return records
+		}
+	}
+	return nil
+}
+
+// handleRemote forwards the query to the nameservers of the forward for the
+// name or else the nameservers of the view
+func (t *view) handleRemote(w dns.ResponseWriter, r *dns.Msg) {
+
+	if !t.server.acl.allowRecursion(clientIP(w.RemoteAddr())) {
+		t.server.acl.refuse(t.server, w, r, aclRecursionDenied, t.name)
+		return
+	}
+
+	dnsClient := t.server.tcpDnsClient
+
+	nameservers := t.nameservers
+	if len(r.Question) > 0 {
+		nameservers = t.getNameservers(r.Question[0].Name)
+	}
+
+	for _, nameserver := range nameservers {
+
+		switch nameserver.Proto {
+
+		case proto.TCP:
+			dnsClient = t.server.tcpDnsClient
+
+		case proto.UDP:
+			dnsClient = t.server.udpDnsClient
+
+		}
+
+		r, _, err := dnsClient.Exchange(r, nameserver.GetIPColonPort())
+
+		if err == nil {
+			nameserver.success()
+			rString, _ := json.Marshal(r)
+
+			if r.Rcode == dns.RcodeSuccess {
+				r.Compress = true
+				w.WriteMsg(r)
+				t.server.logQuery(w, r, nameserver.GetIPColonPort(), t.name)
+
+				if t.server.trace {
+					zap.L().Debug(fmt.Sprintf("Remote Nameserver %s responded with %s", nameserver.GetIPColonPort(), rString))
 				}
+
+				return
+			}
+		} else {
+			nameserver.failure(err)
+			if t.server.trace {
+				zap.L().Debug(fmt.Sprintf("Remote Nameserver %s responded with error %s", nameserver.GetIPColonPort(), err.Error()))
 			}
 		}
+	}
 
-		if t.trace {
-			zap.L().Debug("failure to forward request")
-		}
+	if t.server.trace {
+		zap.L().Debug("failure to forward request")
+	}
 
-		m := new(dns.Msg)
-		m.SetReply(r)
-		m.SetRcode(r, dns.RcodeServerFailure)
-		w.WriteMsg(m)
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.SetRcode(r, dns.RcodeServerFailure)
+	w.WriteMsg(m)
+	t.server.logQuery(w, m, "", t.name)
+}
+
+func (t *view) handleLocal(w dns.ResponseWriter, r *dns.Msg) {
+
+	if !t.server.acl.allowLocal(clientIP(w.RemoteAddr())) {
+		t.server.acl.refuse(t.server, w, r, aclLocalDenied, t.name)
+		return
 	}
 
-	handleLocal := func(w dns.ResponseWriter, r *dns.Msg) {
-		m := new(dns.Msg)
-		m.SetReply(r)
-		m.Compress = false
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Compress = false
 
-		local := false
+	local := false
 
-		switch r.Opcode {
-		case dns.OpcodeQuery:
+	switch r.Opcode {
+	case dns.OpcodeQuery:
 
-			for _, q := range m.Question {
+		for _, q := range m.Question {
 
-				switch q.Qtype {
+			switch q.Qtype {
 
-				case dns.TypeA:
-					lookup := getARecord(q.Name)
-					if lookup != nil {
-						record := fmt.Sprintf("%s A %s", q.Name, lookup.GetValue())
+			case dns.TypeA:
+				lookup := t.getARecords(q.Name)
+				if len(lookup) > 0 {
+					for _, a := range lookup {
+						record := fmt.Sprintf("%s A %s", q.Name, a.GetValue())
 
-						if t.trace {
-							zap.L().Debug(fmt.Sprintf("success -> %s, source=%s", record, lookup.SRC))
+						if t.server.trace {
+							zap.L().Debug(fmt.Sprintf("success -> %s, source=%s", record, a.SRC))
 						}
 
 						rr, err := dns.NewRR(record)
@@ -225,22 +514,24 @@ func (t *Server) Run(ctx context.Context) error {
 						} else {
 							zap.L().Error(err.Error())
 						}
+					}
 
-						local = true
+					local = true
 
-					} else {
-						if t.trace {
-							zap.L().Debug(fmt.Sprintf("fail -> %s has no A record", q.Name))
-						}
+				} else {
+					if t.server.trace {
+						zap.L().Debug(fmt.Sprintf("fail -> %s has no A record", q.Name))
 					}
+				}
 
-				case dns.TypeAAAA:
-					lookup := getAAAARecord(q.Name)
-					if lookup != nil {
-						record := fmt.Sprintf("%s AAAA %s", q.Name, lookup.GetValue())
+			case dns.TypeAAAA:
+				lookup := t.getAAAARecords(q.Name)
+				if len(lookup) > 0 {
+					for _, a := range lookup {
+						record := fmt.Sprintf("%s AAAA %s", q.Name, a.GetValue())
 
-						if t.trace {
-							zap.L().Debug(fmt.Sprintf("success -> %s, source=%s", record, lookup.SRC))
+						if t.server.trace {
+							zap.L().Debug(fmt.Sprintf("success -> %s, source=%s", record, a.SRC))
 						}
 
 						rr, err := dns.NewRR(record)
@@ -250,22 +541,74 @@ func (t *Server) Run(ctx context.Context) error {
 						} else {
 							zap.L().Error(err.Error())
 						}
+					}
 
-						local = true
+					local = true
+
+				} else {
+					if t.server.trace {
+						zap.L().Debug(fmt.Sprintf("fail -> %s has no AAAA record", q.Name))
+					}
+				}
 
+			case dns.TypePTR:
+				lookup := t.getPTRRecord(q.Name)
+				if lookup != nil {
+					record := fmt.Sprintf("%s PTR %s", q.Name, lookup.GetValue())
+
+					if t.server.trace {
+						zap.L().Debug(fmt.Sprintf("success -> %s, source=%s", record, lookup.SRC))
+					}
+
+					rr, err := dns.NewRR(record)
+
+					if err == nil {
+						m.Answer = append(m.Answer, rr)
 					} else {
-						if t.trace {
-							zap.L().Debug(fmt.Sprintf("fail -> %s has no AAAA record", q.Name))
-						}
+						zap.L().Error(err.Error())
+					}
+
+					local = true
+
+				} else {
+					if t.server.trace {
+						zap.L().Debug((fmt.Sprintf("fail -> %s has no PTR record", q.Name)))
+					}
+				}
+
+			case dns.TypeCNAME:
+				lookup := t.getCNameRecord(q.Name)
+				if lookup != nil {
+					record := fmt.Sprintf("%s CNAME %s", q.Name, lookup.GetValue())
+
+					if t.server.trace {
+						zap.L().Debug(fmt.Sprintf("success -> %s, source=%s", record, lookup.SRC))
+					}
+
+					rr, err := dns.NewRR(record)
+
+					if err == nil {
+						m.Answer = append(m.Answer, rr)
+					} else {
+						zap.L().Error(err.Error())
+					}
+
+					local = true
+
+				} else {
+					if t.server.trace {
+						zap.L().Debug((fmt.Sprintf("fail -> %s has no CNAME record", q.Name)))
 					}
+				}
 
-				case dns.TypePTR:
-					lookup := getPTRRecord(q.Name)
-					if lookup != nil {
-						record := fmt.Sprintf("%s PTR %s", q.Name, lookup.GetValue())
+			case dns.TypeSRV:
+				lookup := t.getSRVRecords(q.Name)
+				if len(lookup) > 0 {
+					for _, r := range lookup {
+						record := fmt.Sprintf("%s SRV %s", q.Name, r.GetValue())
 
-						if t.trace {
-							zap.L().Debug(fmt.Sprintf("success -> %s, source=%s", record, lookup.SRC))
+						if t.server.trace {
+							zap.L().Debug(fmt.Sprintf("success -> %s, source=%s", record, r.SRC))
 						}
 
 						rr, err := dns.NewRR(record)
@@ -275,22 +618,24 @@ func (t *Server) Run(ctx context.Context) error {
 						} else {
 							zap.L().Error(err.Error())
 						}
+					}
 
-						local = true
+					local = true
 
-					} else {
-						if t.trace {
-							zap.L().Debug((fmt.Sprintf("fail -> %s has no PTR record", q.Name)))
-						}
+				} else {
+					if t.server.trace {
+						zap.L().Debug((fmt.Sprintf("fail -> %s has no SRV record", q.Name)))
 					}
+				}
 
-				case dns.TypeCNAME:
-					lookup := getCNameRecord(q.Name)
-					if lookup != nil {
-						record := fmt.Sprintf("%s CNAME %s", q.Name, lookup.GetValue())
+			case dns.TypeTXT:
+				lookup := t.getTXTRecords(q.Name)
+				if len(lookup) > 0 {
+					for _, r := range lookup {
+						record := fmt.Sprintf("%s TXT %s", q.Name, r.GetValue())
 
-						if t.trace {
-							zap.L().Debug(fmt.Sprintf("success -> %s, source=%s", record, lookup.SRC))
+						if t.server.trace {
+							zap.L().Debug(fmt.Sprintf("success -> %s, source=%s", record, r.SRC))
 						}
 
 						rr, err := dns.NewRR(record)
@@ -300,76 +645,88 @@ func (t *Server) Run(ctx context.Context) error {
 						} else {
 							zap.L().Error(err.Error())
 						}
+					}
 
-						local = true
+					local = true
 
-					} else {
-						if t.trace {
-							zap.L().Debug((fmt.Sprintf("fail -> %s has no CNAME record", q.Name)))
-						}
+				} else {
+					if t.server.trace {
+						zap.L().Debug((fmt.Sprintf("fail -> %s has no TXT record", q.Name)))
 					}
-
 				}
-			}
 
+			}
 		}
 
-		if local {
-			w.WriteMsg(m)
-			return
-		}
+	}
 
-		handleRemote(w, r)
+	if local {
+		w.WriteMsg(m)
+		t.server.logQuery(w, m, "local", t.name)
+		return
 	}
 
-	addDomainName := func(domainName string) {
-		domainName = strings.ToLower(domainName)
-		for _, existingDomain := range t.domainNames {
-			if domainName == existingDomain {
-				return
+	t.handleRemote(w, r)
+}
+
+func (t *Server) Run(ctx context.Context) error {
+
+	// The forwards are registered before the domains of the providers so that a
+	// domain that is both is answered locally first
+	for _, v := range t.getViews() {
+
+		v.mux.HandleFunc("10.in-addr.arpa.", v.handleLocal)
+		v.mux.HandleFunc("168.192.in-addr.arpa.", v.handleLocal)
+		v.mux.HandleFunc("0.0.16.127.in-addr.arpa.", v.handleLocal)
+		v.mux.HandleFunc("0.0.168.192.in-addr.arpa.", v.handleLocal)
+		v.mux.HandleFunc("d.f.ip6.arpa.", v.handleLocal)
+
+		for _, f := range v.forwards {
+			if t.trace {
+				for _, nameserver := range f.nameservers {
+					zap.L().Debug(fmt.Sprintf("Forwarding %s in view %s to nameserver %s : %s", f.domain, v.name, nameserver.IP, string(nameserver.Proto)))
+				}
 			}
+			v.mux.HandleFunc(f.domain+".", v.handleRemote)
+		}
+
+		if len(v.nameservers) > 0 {
+			for _, nameserver := range v.nameservers {
+				if t.trace {
+					if v.name == "" {
+						zap.L().Debug(fmt.Sprintf("Forwarding to nameserver %s : %s", nameserver.IP, string(nameserver.Proto)))
+					} else {
+						zap.L().Debug(fmt.Sprintf("Forwarding in view %s to nameserver %s : %s", v.name, nameserver.IP, string(nameserver.Proto)))
+					}
+				}
+			}
+
+			v.mux.HandleFunc(".", v.handleRemote)
+
+		} else if v.name == "" {
+			zap.L().Debug("Forwarding to nameservers is not enabled")
+		} else {
+			zap.L().Debug(fmt.Sprintf("Forwarding to nameservers is not enabled in view %s", v.name))
 		}
-		t.domainNames = append(t.domainNames, domainName)
 	}
 
 	for _, client := range t.clients {
-		addDomainName(client.GetDomainName())
+		t.addDomainName(client, client.GetDomainName())
 		err := client.run()
 		if err != nil {
 			return err
 		}
 	}
 
-	for _, v := range t.domainNames {
-		zap.L().Debug(fmt.Sprintf("Adding domain %s to be handled locally", v))
-		dns.HandleFunc(v+".", handleLocal)
-	}
-
-	dns.HandleFunc("10.in-addr.arpa.", handleLocal)
-	dns.HandleFunc("168.192.in-addr.arpa.", handleLocal)
-	dns.HandleFunc("0.0.16.127.in-addr.arpa.", handleLocal)
-	dns.HandleFunc("0.0.168.192.in-addr.arpa.", handleLocal)
-
-	if len(t.nameservers) > 0 {
-		for _, v := range t.nameservers {
-			if t.trace {
-				zap.L().Debug(fmt.Sprintf("Forwarding to nameserver %s : %s", v.IP, string(v.Proto)))
-			}
-		}
-
-		dns.HandleFunc(".", handleRemote)
-
-	} else {
-		zap.L().Debug("Forwarding to nameservers is not enabled")
-	}
+	t.checkConflicts()
 
-	errs := make(chan error, len(t.listeners))
+	errs := make(chan error, len(t.listeners)+len(t.packetConns))
 
 	var servers []*dns.Server
 
 	for _, listener := range t.listeners {
 		zap.L().Info(fmt.Sprintf("Starting server on %s/%s", listener.IP+":"+strconv.Itoa(listener.Port), string(listener.Proto)))
-		server := &dns.Server{Addr: listener.IP + ":" + strconv.Itoa(listener.Port), Net: string(listener.Proto)}
+		server := &dns.Server{Addr: listener.IP + ":" + strconv.Itoa(listener.Port), Net: string(listener.Proto), Handler: t}
 		servers = append(servers, server)
 
 		go func() {
@@ -381,6 +738,19 @@ func (t *Server) Run(ctx context.Context) error {
 
 	}
 
+	for _, conn := range t.packetConns {
+		zap.L().Info(fmt.Sprintf("Starting server on %s/%s", conn.LocalAddr().String(), string(proto.UDP)))
+		server := &dns.Server{PacketConn: conn, Handler: t}
+		servers = append(servers, server)
+
+		go func() {
+			err := server.ActivateAndServe()
+			if err != nil {
+				errs <- err
+			}
+		}()
+	}
+
 	var err error
 
 	select {
@@ -393,6 +763,10 @@ func (t *Server) Run(ctx context.Context) error {
 
 	}
 
+	for _, server := range servers {
+		server.Shutdown()
+	}
+
 	for _, client := range t.clients {
 		client.shutdown()
 	}
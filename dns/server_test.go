@@ -0,0 +1,138 @@
+package dns_test
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	mdns "github.com/miekg/dns"
+
+	"github.com/jodydadescott/home-server/dns"
+	"github.com/jodydadescott/home-server/dns/dnstest"
+	"github.com/jodydadescott/home-server/types"
+)
+
+// provider is a provider with fixed records. The IPs of a host are separated
+// by commas.
+type provider struct {
+	name       string
+	domain     string
+	records    map[string]string
+	srvRecords []*types.SRVRecord
+	txtRecords []*types.TXTRecord
+	priority   int
+	static     bool
+}
+
+func (t *provider) GetName() string                   { return t.name }
+func (t *provider) GetDomainName() string             { return t.domain }
+func (t *provider) GetRefreshDuration() time.Duration { return 0 }
+func (t *provider) GetPriority() int                  { return t.priority }
+func (t *provider) Static() bool                      { return t.static }
+
+func (t *provider) GetRecords() (*types.DomainRecords, error) {
+	records := &types.DomainRecords{}
+	for hostname, ips := range t.records {
+		for _, ip := range strings.Split(ips, ",") {
+			if strings.Contains(ip, ":") {
+				records.AddAAAARecords(&types.ARecord{Hostname: hostname, Domain: t.domain, IP: ip})
+			} else {
+				records.AddARecords(&types.ARecord{Hostname: hostname, Domain: t.domain, IP: ip})
+			}
+		}
+	}
+	records.SrvRecords = t.srvRecords
+	records.TxtRecords = t.txtRecords
+	return records, nil
+}
+
+// exchange sends the query from the source IP
+func exchange(t *testing.T, address, source, name string, qtype uint16) *mdns.Msg {
+
+	t.Helper()
+
+	client := &mdns.Client{
+		Timeout: time.Second,
+		Dialer:  &net.Dialer{LocalAddr: &net.UDPAddr{IP: net.ParseIP(source)}},
+	}
+
+	response, _, err := client.Exchange(new(mdns.Msg).SetQuestion(mdns.Fqdn(name), qtype), address)
+	if err != nil {
+		t.Fatalf("%s from %s: %s", name, source, err.Error())
+	}
+
+	return response
+}
+
+// answers returns the values of the answers in order
+func answers(response *mdns.Msg) []string {
+
+	var values []string
+
+	for _, rr := range response.Answer {
+		switch rr := rr.(type) {
+		case *mdns.A:
+			values = append(values, rr.A.String())
+		case *mdns.AAAA:
+			values = append(values, rr.AAAA.String())
+		default:
+			values = append(values, strings.TrimPrefix(rr.String(), rr.Header().String()))
+		}
+	}
+
+	return values
+}
+
+func expectA(t *testing.T, address, source, name string, expected ...string) {
+
+	t.Helper()
+
+	values := answers(exchange(t, address, source, name, mdns.TypeA))
+	sort.Strings(values)
+
+	if strings.Join(values, ",") != strings.Join(expected, ",") {
+		t.Errorf("%s from %s: expected %v, got %v", name, source, expected, values)
+	}
+}
+
+func TestSRVAndTXT(t *testing.T) {
+
+	config := &dns.Config{}
+
+	config.AddProvider(&provider{
+		name:   "zone",
+		domain: "home",
+		srvRecords: []*types.SRVRecord{
+			{Name: "_ldap._tcp", Domain: "home", TargetHostname: "dc1", TargetDomain: "home", Port: 389, Priority: 0, Weight: 100},
+			{Name: "_ldap._tcp", Domain: "home", TargetHostname: "dc2", TargetDomain: "home", Port: 389, Priority: 10, Weight: 100},
+		},
+		txtRecords: []*types.TXTRecord{
+			{Name: "mail", Domain: "home", Text: []string{"v=spf1 -all"}},
+			{Name: "mail", Domain: "home", Text: []string{"verification=abc"}},
+			{Name: "mail", Domain: "home", Text: []string{"v=spf1 -all"}},
+		},
+	})
+
+	_, address := dnstest.Start(t, config)
+
+	tests := []struct {
+		name     string
+		qtype    uint16
+		expected string
+	}{
+		{"_ldap._tcp.home", mdns.TypeSRV, "0 100 389 dc1.home., 10 100 389 dc2.home."},
+		{"mail.home", mdns.TypeTXT, `"v=spf1 -all", "verification=abc"`},
+	}
+
+	for _, test := range tests {
+
+		values := answers(exchange(t, address, "127.0.0.1", test.name, test.qtype))
+		sort.Strings(values)
+
+		if got := strings.Join(values, ", "); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package dns
+
+import (
+	"sort"
+	"strings"
+)
+
+// recordSet is the set of SRV or TXT records for a name from one provider.
+// Each record has a different value.
+type recordSet[T record] []T
+
+// GetKey returns the name the records are for
+func (t recordSet[T]) GetKey() string {
+	return t[0].GetKey()
+}
+
+// GetValue returns the values so that a change to any of them is a change to
+// the set
+func (t recordSet[T]) GetValue() string {
+
+	var values []string
+	for _, r := range t {
+		values = append(values, r.GetValue())
+	}
+
+	return strings.Join(values, ", ")
+}
+
+// recordSets is the records for each name
+type recordSets[T record] map[string]recordSet[T]
+
+// add adds the record to the set for its name unless the set already has the
+// value
+func (t recordSets[T]) add(r T) {
+
+	key := r.GetKey()
+
+	for _, existing := range t[key] {
+		if existing.GetValue() == r.GetValue() {
+			return
+		}
+	}
+
+	t[key] = append(t[key], r)
+}
+
+// sort puts the records for each name in order of their value so the value of
+// a set does not depend on the order the provider returned them in
+func (t recordSets[T]) sort() {
+	for _, set := range t {
+		sort.SliceStable(set, func(i, j int) bool {
+			return set[i].GetValue() < set[j].GetValue()
+		})
+	}
+}
+
+// count returns the number of records in all of the sets
+func (t recordSets[T]) count() int {
+
+	count := 0
+	for _, set := range t {
+		count += len(set)
+	}
+
+	return count
+}
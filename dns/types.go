@@ -1,6 +1,7 @@
 package dns
 
 import (
+	"net"
 	"time"
 
 	"github.com/jinzhu/copier"
@@ -14,13 +15,33 @@ type Domain = types.Domain
 type ARecord = types.ARecord
 type PTRrecord = types.PTRrecord
 type CNameRecord = types.CNameRecord
+type SRVRecord = types.SRVRecord
+type TXTRecord = types.TXTRecord
 type DomainRecords = types.DomainRecords
+type ProviderStatus = types.ProviderStatus
+type UpstreamStatus = types.UpstreamStatus
+type QueryLogEntry = types.QueryLogEntry
+type RecordEvent = types.RecordEvent
+type Conflict = types.Conflict
+type NameCollision = types.NameCollision
+type Claim = types.Claim
+type ViewConfig = types.ViewConfig
+type ACLConfig = types.ACLConfig
+type ACLStatus = types.ACLStatus
 
 type Config struct {
-	Providers   []Provider
-	Trace       bool
-	Listeners   []*NetPort
-	Nameservers []*NetPort
+	Providers []Provider
+	Trace     bool
+	Listeners []*NetPort
+	// PacketConns are UDP sockets that are already bound, such as ones on an
+	// ephemeral port in tests. They are served as well as the Listeners.
+	PacketConns    []net.PacketConn
+	Nameservers    []*NetPort
+	EventHandlers  []func([]*RecordEvent)
+	ConflictPolicy string
+	Shuffle        bool
+	Views          []*ViewConfig
+	ACL            *ACLConfig
 }
 
 // Clone return copy
@@ -34,9 +55,57 @@ func (t *Config) AddProvider(provider Provider) {
 	t.Providers = append(t.Providers, provider)
 }
 
+// AddView adds a split-horizon view. Views are checked in the order they are
+// added and the first one with a network that has the client IP is used.
+func (t *Config) AddView(view *ViewConfig) {
+	t.Views = append(t.Views, view)
+}
+
+// AddEventHandler adds a func that is called with the record events from each
+// provider refresh. Handlers are called synchronously and so should not block.
+func (t *Config) AddEventHandler(handler func([]*RecordEvent)) {
+	t.EventHandlers = append(t.EventHandlers, handler)
+}
+
 type Provider interface {
 	GetName() string
 	GetDomainName() string
 	GetRecords() (*DomainRecords, error)
 	GetRefreshDuration() time.Duration
 }
+
+// Watcher is an optional interface for a Provider that knows when its records
+// have changed. Watch should block until done is closed and call changed each
+// time the records change so that they are refreshed without waiting for the
+// refresh duration.
+type Watcher interface {
+	Watch(done <-chan struct{}, changed func())
+}
+
+// Prioritized is an optional interface for a Provider with a configured
+// priority. Providers with a higher priority are asked first. Providers that do
+// not implement it have a priority of 0.
+type Prioritized interface {
+	GetPriority() int
+}
+
+// Static is an optional interface for a Provider with records that are set by
+// hand rather than found on the network. Their records win with the
+// static-overrides-dynamic conflict policy.
+type Static interface {
+	Static() bool
+}
+
+// MultiDomain is an optional interface for a Provider that puts records in
+// more than one domain. The domains are handled locally after each refresh
+// even if they do not have any records yet.
+type MultiDomain interface {
+	GetDomainNames() []string
+}
+
+// Colliding is an optional interface for a Provider that gives records with
+// the same name different names. It returns the names that collided on the
+// last refresh.
+type Colliding interface {
+	GetCollisions() []*NameCollision
+}
@@ -0,0 +1,60 @@
+package dns
+
+import (
+	"sync"
+	"time"
+)
+
+// upstream tracks the health of a remote nameserver
+type upstream struct {
+	mutex sync.RWMutex
+	*NetPort
+	lastSuccess  time.Time
+	lastFailure  time.Time
+	lastError    error
+	failingSince time.Time
+	failures     int
+	view         string
+}
+
+func (t *upstream) success() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.lastSuccess = time.Now()
+	t.failingSince = time.Time{}
+	t.failures = 0
+}
+
+func (t *upstream) failure(err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.lastFailure = time.Now()
+	t.lastError = err
+	if t.failures == 0 {
+		t.failingSince = t.lastFailure
+	}
+	t.failures++
+}
+
+func (t *upstream) getStatus() *UpstreamStatus {
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	status := &UpstreamStatus{
+		Nameserver:   t.GetIPColonPort(),
+		Proto:        string(t.Proto),
+		Healthy:      t.failures == 0,
+		LastSuccess:  t.lastSuccess,
+		LastFailure:  t.lastFailure,
+		FailingSince: t.failingSince,
+		Failures:     t.failures,
+		View:         t.view,
+	}
+
+	if t.lastError != nil {
+		status.LastError = t.lastError.Error()
+	}
+
+	return status
+}
@@ -0,0 +1,48 @@
+package dns
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jodydadescott/home-server/types/proto"
+)
+
+func TestUpstream(t *testing.T) {
+
+	u := newUpstreams([]*NetPort{{IP: "192.168.1.1"}}, "guest")[0]
+
+	status := u.getStatus()
+	if status.Nameserver != "192.168.1.1:53" || status.Proto != string(proto.UDP) || status.View != "guest" || !status.Healthy {
+		t.Errorf("unexpected initial status %+v", status)
+	}
+
+	u.failure(errors.New("timeout"))
+	first := u.getStatus()
+
+	if first.Healthy || first.Failures != 1 || first.LastError != "timeout" || first.FailingSince.IsZero() || !first.FailingSince.Equal(first.LastFailure) {
+		t.Errorf("unexpected status after a failure %+v", first)
+	}
+
+	// Failing since is when the first failure in a row happened
+	u.failure(errors.New("connection refused"))
+	second := u.getStatus()
+
+	if second.Healthy || second.Failures != 2 || second.LastError != "connection refused" || !second.FailingSince.Equal(first.FailingSince) {
+		t.Errorf("unexpected status after a second failure %+v", second)
+	}
+
+	// A success makes it healthy again but the last failure is kept
+	u.success()
+	recovered := u.getStatus()
+
+	if !recovered.Healthy || recovered.Failures != 0 || !recovered.FailingSince.IsZero() || recovered.LastSuccess.IsZero() || !recovered.LastFailure.Equal(second.LastFailure) {
+		t.Errorf("unexpected status after a success %+v", recovered)
+	}
+
+	u.failure(errors.New("timeout"))
+	again := u.getStatus()
+
+	if again.Failures != 1 || again.FailingSince.Before(recovered.LastSuccess) {
+		t.Errorf("unexpected status after failing again %+v", again)
+	}
+}
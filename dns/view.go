@@ -0,0 +1,280 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+
+	"github.com/jodydadescott/home-server/types"
+	"github.com/jodydadescott/home-server/types/proto"
+)
+
+// view is a split-horizon view. The clients from its networks are answered
+// with the records of its providers and forwarded to its nameservers. The
+// default view has no networks and answers the clients that do not match
+// another view with the records of every provider.
+type view struct {
+	server      *Server
+	name        string
+	networks    []*net.IPNet
+	clients     []*Client
+	nameservers []*upstream
+	forwards    []*forward
+	blocklist   map[string]bool
+	blockPolicy string
+	domainNames []string
+	mux         *dns.ServeMux
+}
+
+// forward is the nameservers for a domain and its subdomains
+type forward struct {
+	domain      string
+	nameservers []*upstream
+}
+
+func newView(server *Server, config *ViewConfig) *view {
+
+	config = config.Clone()
+
+	if config.Name == "" {
+		panic("view name is required")
+	}
+
+	if len(config.Networks) == 0 {
+		panic(fmt.Sprintf("view %s has no networks", config.Name))
+	}
+
+	v := &view{
+		server:      server,
+		name:        config.Name,
+		nameservers: server.nameservers,
+		blocklist:   make(map[string]bool),
+		blockPolicy: config.BlockPolicy,
+		mux:         dns.NewServeMux(),
+	}
+
+	v.networks = parseNetworks("view "+config.Name, config.Networks)
+
+	for _, client := range server.clients {
+		for _, pattern := range config.Providers {
+			if matchProvider(pattern, client.GetName()) {
+				v.clients = append(v.clients, client)
+				break
+			}
+		}
+	}
+
+	for _, pattern := range config.Providers {
+		found := false
+		for _, client := range v.clients {
+			if matchProvider(pattern, client.GetName()) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			zap.L().Debug(fmt.Sprintf("View %s provider %s does not match a provider", config.Name, pattern))
+		}
+	}
+
+	if len(config.Nameservers) > 0 {
+		v.nameservers = newUpstreams(config.Nameservers, config.Name)
+	}
+
+	for _, rule := range config.Forwards {
+
+		domain := strings.TrimSuffix(strings.ToLower(rule.Domain), ".")
+		if domain == "" {
+			panic(fmt.Sprintf("view %s has a forward without a domain", config.Name))
+		}
+
+		if len(rule.Nameservers) == 0 {
+			panic(fmt.Sprintf("view %s forward for %s has no nameservers", config.Name, domain))
+		}
+
+		v.forwards = append(v.forwards, &forward{domain: domain, nameservers: newUpstreams(rule.Nameservers, config.Name)})
+	}
+
+	// The forward for the longest domain that a name is in is used
+	sort.SliceStable(v.forwards, func(i, j int) bool {
+		return len(v.forwards[i].domain) > len(v.forwards[j].domain)
+	})
+
+	for _, domain := range config.Blocklist {
+		if domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), "."); domain != "" {
+			v.blocklist[domain] = true
+		}
+	}
+
+	switch v.blockPolicy {
+
+	case types.BlockPolicyNXDomain, types.BlockPolicyNull, types.BlockPolicyRefused:
+
+	case "":
+		v.blockPolicy = types.BlockPolicyNXDomain
+
+	default:
+		panic(fmt.Sprintf("view %s block policy %s is invalid", config.Name, v.blockPolicy))
+	}
+
+	return v
+}
+
+// matchProvider returns true if the pattern is the name of the provider, the
+// kind of provider before the colon, a glob that matches the name or *
+func matchProvider(pattern, name string) bool {
+
+	if pattern == "*" || pattern == name || strings.HasPrefix(name, pattern+":") {
+		return true
+	}
+
+	matched, _ := path.Match(pattern, name)
+	return matched
+}
+
+// newUpstreams returns the nameservers with the default proto and port set
+func newUpstreams(nameservers []*NetPort, view string) []*upstream {
+
+	var upstreams []*upstream
+
+	for _, nameserver := range nameservers {
+
+		switch nameserver.Proto {
+
+		case proto.UDP, proto.TCP:
+
+		case proto.Empty:
+			nameserver.Proto = proto.UDP
+
+		default:
+			panic("Proto Invalid")
+		}
+
+		if nameserver.Port <= 0 {
+			nameserver.Port = types.DefaultDnsPort
+		}
+
+		upstreams = append(upstreams, &upstream{NetPort: nameserver, view: view})
+	}
+
+	return upstreams
+}
+
+func (t *view) hasClient(client *Client) bool {
+	for _, c := range t.clients {
+		if c == client {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *view) contains(ip net.IP) bool {
+	return containsIP(t.networks, ip)
+}
+
+// addDomainName registers the domain to be handled locally. The caller must
+// hold the domain mutex of the server.
+func (t *view) addDomainName(domainName string) {
+
+	for _, existingDomain := range t.domainNames {
+		if domainName == existingDomain {
+			return
+		}
+	}
+
+	t.domainNames = append(t.domainNames, domainName)
+
+	if t.name == "" {
+		zap.L().Debug(fmt.Sprintf("Adding domain %s to be handled locally", domainName))
+	} else {
+		zap.L().Debug(fmt.Sprintf("Adding domain %s to be handled locally in view %s", domainName, t.name))
+	}
+
+	t.mux.HandleFunc(domainName+".", t.handleLocal)
+}
+
+// getNameservers returns the nameservers of the forward for the name or else
+// the nameservers of the view
+func (t *view) getNameservers(name string) []*upstream {
+
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+
+	for _, f := range t.forwards {
+		if name == f.domain || strings.HasSuffix(name, "."+f.domain) {
+			return f.nameservers
+		}
+	}
+
+	return t.nameservers
+}
+
+// isBlocked returns true if the name or a domain it is in is in the blocklist
+func (t *view) isBlocked(name string) bool {
+
+	if len(t.blocklist) == 0 {
+		return false
+	}
+
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+
+	for name != "" {
+
+		if t.blocklist[name] {
+			return true
+		}
+
+		_, name, _ = strings.Cut(name, ".")
+	}
+
+	return false
+}
+
+// handleBlocked answers a query for a blocked name with the block policy
+func (t *view) handleBlocked(w dns.ResponseWriter, r *dns.Msg) {
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	switch t.blockPolicy {
+
+	case types.BlockPolicyRefused:
+		m.Rcode = dns.RcodeRefused
+
+	case types.BlockPolicyNull:
+		for _, q := range r.Question {
+			switch q.Qtype {
+			case dns.TypeA:
+				m.Answer = append(m.Answer, &dns.A{Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 3600}, A: net.IPv4zero})
+			case dns.TypeAAAA:
+				m.Answer = append(m.Answer, &dns.AAAA{Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 3600}, AAAA: net.IPv6zero})
+			}
+		}
+
+	default:
+		m.Rcode = dns.RcodeNameError
+	}
+
+	if t.server.trace {
+		zap.L().Debug(fmt.Sprintf("blocked -> %s, policy=%s", r.Question[0].Name, t.blockPolicy))
+	}
+
+	w.WriteMsg(m)
+	t.server.logQuery(w, m, "blocked", t.name)
+}
+
+// ServeDNS answers the query in the view
+func (t *view) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+
+	if len(r.Question) > 0 && t.isBlocked(r.Question[0].Name) {
+		t.handleBlocked(w, r)
+		return
+	}
+
+	t.mux.ServeDNS(w, r)
+}
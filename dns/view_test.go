@@ -0,0 +1,169 @@
+package dns_test
+
+import (
+	"testing"
+
+	mdns "github.com/miekg/dns"
+
+	"github.com/jodydadescott/home-server/dns"
+	"github.com/jodydadescott/home-server/dns/dnstest"
+	"github.com/jodydadescott/home-server/types"
+)
+
+// The views are matched on the source IP of the query so the tests send from
+// these loopback addresses
+const (
+	defaultClient = "127.0.0.1"
+	guestClient   = "127.0.0.2"
+	vpnClient     = "127.0.0.3"
+	lanClient     = "127.0.0.4"
+)
+
+func newConfig(t *testing.T) *dns.Config {
+
+	config := &dns.Config{}
+
+	config.AddProvider(&provider{name: "static", domain: "home", records: map[string]string{"nas": "192.168.1.10"}})
+	config.AddProvider(&provider{name: "remote:split", domain: "example.com", records: map[string]string{"www": "10.0.0.80"}})
+
+	config.Nameservers = append(config.Nameservers, dnstest.Nameserver(t, "198.51.100.1"))
+
+	return config
+}
+
+func TestViews(t *testing.T) {
+
+	config := newConfig(t)
+
+	guest := &types.ViewConfig{Name: "guest", BlockPolicy: types.BlockPolicyNull}
+	guest.AddNetworks(guestClient + "/32").AddNameservers(dnstest.Nameserver(t, "198.51.100.2")).AddBlocklist("ads.example.net")
+
+	vpn := &types.ViewConfig{Name: "vpn"}
+	vpn.AddNetworks(vpnClient).AddProviders("*")
+	vpn.AddForwards((&types.ForwardRule{Domain: "corp.example.com"}).AddNameservers(dnstest.Nameserver(t, "198.51.100.3")))
+
+	lan := &types.ViewConfig{Name: "lan"}
+	lan.AddNetworks("127.0.0.4/30").AddProviders("static")
+
+	config.AddView(guest)
+	config.AddView(vpn)
+	config.AddView(lan)
+
+	server, address := dnstest.Start(t, config)
+
+	// Clients that do not match a view get every provider
+	expectA(t, address, defaultClient, "nas.home", "192.168.1.10")
+	expectA(t, address, defaultClient, "www.example.com", "10.0.0.80")
+	expectA(t, address, defaultClient, "host.corp.example.com", "198.51.100.1")
+
+	// The guest view has no internal names, its own nameservers and a blocklist
+	expectA(t, address, guestClient, "nas.home", "198.51.100.2")
+	expectA(t, address, guestClient, "www.example.com", "198.51.100.2")
+	expectA(t, address, guestClient, "ads.example.net", "0.0.0.0")
+	expectA(t, address, guestClient, "pixel.ads.example.net", "0.0.0.0")
+
+	// The VPN view gets the internal IP of a public name and forwards the corp
+	// domain to its own nameserver
+	expectA(t, address, vpnClient, "www.example.com", "10.0.0.80")
+	expectA(t, address, vpnClient, "nas.home", "192.168.1.10")
+	expectA(t, address, vpnClient, "host.corp.example.com", "198.51.100.3")
+	expectA(t, address, vpnClient, "other.org", "198.51.100.1")
+
+	// The LAN view only has the static provider so the public name is forwarded
+	expectA(t, address, lanClient, "nas.home", "192.168.1.10")
+	expectA(t, address, lanClient, "www.example.com", "198.51.100.1")
+
+	views := make(map[string]bool)
+	for _, entry := range server.GetQueryLog() {
+		views[entry.View] = true
+	}
+
+	for _, name := range []string{"", "guest", "vpn", "lan"} {
+		if !views[name] {
+			t.Errorf("query log does not have a query in view %q", name)
+		}
+	}
+
+	upstreams := make(map[string]bool)
+	for _, status := range server.GetUpstreamStatus() {
+		upstreams[status.View] = true
+	}
+
+	if len(upstreams) != 3 || !upstreams[""] || !upstreams["guest"] || !upstreams["vpn"] {
+		t.Errorf("unexpected upstream views %v", upstreams)
+	}
+}
+
+func TestBlockPolicy(t *testing.T) {
+
+	tests := []struct {
+		policy string
+		rcode  int
+	}{
+		{"", mdns.RcodeNameError},
+		{types.BlockPolicyNXDomain, mdns.RcodeNameError},
+		{types.BlockPolicyRefused, mdns.RcodeRefused},
+		{types.BlockPolicyNull, mdns.RcodeSuccess},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.policy, func(t *testing.T) {
+
+			config := newConfig(t)
+
+			view := &types.ViewConfig{Name: "kids", BlockPolicy: test.policy}
+			view.AddNetworks(guestClient+"/32").AddProviders("*").AddBlocklist("games.example.org.", "NAS.home")
+			config.AddView(view)
+
+			_, address := dnstest.Start(t, config)
+
+			for _, name := range []string{"games.example.org", "www.games.example.org", "nas.home"} {
+				if rcode := exchange(t, address, guestClient, name, mdns.TypeA).Rcode; rcode != test.rcode {
+					t.Errorf("%s: expected %s, got %s", name, mdns.RcodeToString[test.rcode], mdns.RcodeToString[rcode])
+				}
+			}
+
+			if rcode := exchange(t, address, guestClient, "example.org", mdns.TypeA).Rcode; rcode != mdns.RcodeSuccess {
+				t.Errorf("example.org: expected NOERROR, got %s", mdns.RcodeToString[rcode])
+			}
+
+			// The blocklist is only for the view
+			expectA(t, address, defaultClient, "nas.home", "192.168.1.10")
+		})
+	}
+}
+
+func TestInvalidViews(t *testing.T) {
+
+	tests := map[string][]*types.ViewConfig{
+		"no name":        {{Networks: []string{"10.0.0.0/8"}}},
+		"no networks":    {{Name: "guest"}},
+		"invalid cidr":   {{Name: "guest", Networks: []string{"10.0.0.0/33"}}},
+		"invalid policy": {{Name: "guest", Networks: []string{"10.0.0.0/8"}, BlockPolicy: "drop"}},
+		"forward domain": {{Name: "guest", Networks: []string{"10.0.0.0/8"}, Forwards: []*types.ForwardRule{{Domain: "."}}}},
+		"duplicate": {
+			{Name: "guest", Networks: []string{"10.0.0.0/8"}},
+			{Name: "guest", Networks: []string{"172.16.0.0/12"}},
+		},
+	}
+
+	for name, views := range tests {
+
+		t.Run(name, func(t *testing.T) {
+
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic")
+				}
+			}()
+
+			config := &dns.Config{}
+			for _, view := range views {
+				config.AddView(view)
+			}
+
+			dns.New(config)
+		})
+	}
+}
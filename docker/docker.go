@@ -0,0 +1,356 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jodydadescott/home-server/types"
+	"github.com/jodydadescott/home-server/util"
+)
+
+type Config = types.DockerConfig
+type ARecord = types.ARecord
+type PTRrecord = types.PTRrecord
+type Records = types.DomainRecords
+
+const (
+	source = "docker"
+
+	LabelHostname = "home-server.hostname"
+	LabelDomain   = "home-server.domain"
+	LabelEnable   = "home-server.enable"
+
+	defaultSocket  = "/var/run/docker.sock"
+	defaultRefresh = time.Minute
+
+	requestTimeout = time.Second * 30
+
+	// reconnectDelay is the wait before the events stream is opened again
+	reconnectDelay = time.Second * 5
+)
+
+// container is the part of the Docker Engine API container list that is used
+type container struct {
+	ID              string            `json:"Id"`
+	Names           []string          `json:"Names"`
+	Labels          map[string]string `json:"Labels"`
+	NetworkSettings struct {
+		Networks map[string]*network `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+type network struct {
+	IPAddress         string `json:"IPAddress"`
+	GlobalIPv6Address string `json:"GlobalIPv6Address"`
+}
+
+// Client is a provider for the running containers of a Docker engine
+type Client struct {
+	socket      string
+	domain      string
+	network     string
+	labeledOnly bool
+	refresh     time.Duration
+	priority    int
+	httpClient  *http.Client
+}
+
+func New(config *Config) *Client {
+
+	if config == nil {
+		panic("config is required")
+	}
+
+	config = config.Clone()
+
+	client := &Client{
+		socket:      defaultSocket,
+		domain:      types.DefaultDomain,
+		network:     config.Network,
+		labeledOnly: config.LabeledOnly,
+		refresh:     defaultRefresh,
+		priority:    config.Priority,
+	}
+
+	if config.Socket != "" {
+		client.socket = config.Socket
+	}
+
+	if config.Domain != "" {
+		client.domain = config.Domain
+	}
+
+	if config.Refresh > 0 {
+		client.refresh = config.Refresh
+	}
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", client.socket)
+		},
+	}
+
+	// The events stream does not end so the client has no timeout. Requests
+	// that should end use a context with a timeout.
+	client.httpClient = &http.Client{Transport: transport}
+
+	return client
+}
+
+func (t *Client) GetName() string {
+	return source + ":" + t.socket
+}
+
+func (t *Client) GetDomainName() string {
+	return t.domain
+}
+
+// GetRefreshDuration returns the interval at which containers are listed in
+// case an event was missed
+func (t *Client) GetRefreshDuration() time.Duration {
+	return t.refresh
+}
+
+// GetPriority implements dns.Prioritized
+func (t *Client) GetPriority() int {
+	return t.priority
+}
+
+// get does a GET on the Docker Engine API. The host of the URL is ignored as
+// the connection is to the socket.
+func (t *Client) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+
+	u := url.URL{Scheme: "http", Host: "docker", Path: path, RawQuery: query.Encode()}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Docker %s returned %s", path, resp.Status)
+	}
+
+	return resp, nil
+}
+
+func (t *Client) GetRecords() (*Records, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	resp, err := t.get(ctx, "/containers/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var containers []*container
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, fmt.Errorf("Docker container list is invalid; error %s", err.Error())
+	}
+
+	return t.getRecords(containers), nil
+}
+
+// Watch implements dns.Watcher. The container events stream is followed and
+// the records are refreshed when a container starts, stops or changes
+// networks. The stream is opened again if it ends.
+func (t *Client) Watch(done <-chan struct{}, changed func()) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-done
+		cancel()
+	}()
+
+	filters, _ := json.Marshal(map[string][]string{
+		"type":  {"container", "network"},
+		"event": {"start", "die", "destroy", "rename", "connect", "disconnect"},
+	})
+
+	for {
+
+		err := t.watch(ctx, url.Values{"filters": {string(filters)}}, changed)
+
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		if err != nil {
+			zap.L().Debug(fmt.Sprintf("Docker events stream for %s ended; error %s", t.socket, err.Error()))
+		}
+
+		select {
+		case <-done:
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func (t *Client) watch(ctx context.Context, query url.Values, changed func()) error {
+
+	resp, err := t.get(ctx, "/events", query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+
+	for {
+
+		var event struct {
+			Type   string `json:"Type"`
+			Action string `json:"Action"`
+			Actor  struct {
+				ID string `json:"ID"`
+			} `json:"Actor"`
+		}
+
+		if err := decoder.Decode(&event); err != nil {
+			return err
+		}
+
+		zap.L().Debug(fmt.Sprintf("Docker %s event %s for %s", event.Type, event.Action, event.Actor.ID))
+		changed()
+	}
+}
+
+// getRecords returns the A or AAAA and PTR records for the containers. The
+// hostname is the hostname label or the container name as a valid hostname
+// label and the domain is the domain label or the configured domain. The IPs are
+// from the configured network or, if there is none, from every network so a
+// container on more than one network has an address set.
+func (t *Client) getRecords(containers []*container) *Records {
+
+	records := &Records{}
+	src := source + ":container"
+
+	for _, c := range containers {
+
+		if strings.EqualFold(c.Labels[LabelEnable], "false") {
+			continue
+		}
+
+		hostname := c.Labels[LabelHostname]
+
+		if hostname == "" && t.labeledOnly {
+			continue
+		}
+
+		if hostname == "" && len(c.Names) > 0 {
+			hostname = strings.TrimPrefix(c.Names[0], "/")
+		}
+
+		// Container names may have underscores and dots and the label may
+		// have anything
+		hostname = util.ToLabel(hostname)
+
+		if hostname == "" {
+			zap.L().Debug(fmt.Sprintf("Container %s does not have a valid name", c.ID))
+			continue
+		}
+
+		domain := t.domain
+		if v := c.Labels[LabelDomain]; v != "" {
+			domain = strings.TrimSuffix(v, ".")
+		}
+
+		ips := t.getIPs(c)
+		if len(ips) == 0 {
+			zap.L().Debug(fmt.Sprintf("Container %s does not have an IP", hostname))
+			continue
+		}
+
+		for _, ip := range ips {
+
+			arpa, err := util.GetARPA(ip)
+			if err != nil {
+				zap.L().Debug(fmt.Sprintf("Container %s has an invalid IP; error %s", hostname, err.Error()))
+				continue
+			}
+
+			a := &ARecord{
+				Hostname: hostname,
+				Domain:   domain,
+				IP:       ip,
+				SRC:      src,
+			}
+
+			if net.ParseIP(ip).To4() != nil {
+				records.AddARecords(a)
+			} else {
+				records.AddAAAARecords(a)
+			}
+
+			records.AddPtrRecords(&PTRrecord{
+				ARPA:     arpa,
+				Hostname: hostname,
+				Domain:   domain,
+				SRC:      src,
+			})
+		}
+	}
+
+	return records
+}
+
+// getIPs returns the IPs of the container on the configured network or, if
+// there is none, on every network in order of the network name
+func (t *Client) getIPs(c *container) []string {
+
+	networks := c.NetworkSettings.Networks
+
+	var names []string
+
+	if t.network != "" {
+		names = append(names, t.network)
+	} else {
+		for name := range networks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	var ips []string
+	seen := make(map[string]bool)
+
+	for _, name := range names {
+
+		n := networks[name]
+		if n == nil {
+			continue
+		}
+
+		for _, ip := range []string{n.IPAddress, n.GlobalIPv6Address} {
+			if ip != "" && !seen[ip] {
+				seen[ip] = true
+				ips = append(ips, ip)
+			}
+		}
+	}
+
+	return ips
+}
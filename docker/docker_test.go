@@ -0,0 +1,211 @@
+package docker
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The wiki has the hostname label, the db is on two networks, the builder is
+// disabled, the job does not have an IP and the label of the proxy has no
+// valid characters
+const containersJSON = `[
+  {"Id": "1", "Names": ["/grafana_1"], "Labels": {},
+   "NetworkSettings": {"Networks": {"bridge": {"IPAddress": "172.17.0.2"}}}},
+  {"Id": "2", "Names": ["/wiki"], "Labels": {"home-server.hostname": "Jody's Wiki", "home-server.domain": "lab."},
+   "NetworkSettings": {"Networks": {"bridge": {"IPAddress": "172.17.0.3"}}}},
+  {"Id": "3", "Names": ["/db"], "Labels": {},
+   "NetworkSettings": {"Networks": {
+     "bridge": {"IPAddress": "172.17.0.4"},
+     "backend": {"IPAddress": "172.18.0.4", "GlobalIPv6Address": "fd00::4"}}}},
+  {"Id": "4", "Names": ["/builder"], "Labels": {"home-server.enable": "False"},
+   "NetworkSettings": {"Networks": {"bridge": {"IPAddress": "172.17.0.5"}}}},
+  {"Id": "5", "Names": ["/job"], "Labels": {},
+   "NetworkSettings": {"Networks": {"none": {}}}},
+  {"Id": "6", "Names": ["/proxy"], "Labels": {"home-server.hostname": "___"},
+   "NetworkSettings": {"Networks": {"bridge": {"IPAddress": "172.17.0.7"}}}}
+]`
+
+// engine is a fake Docker engine on a unix socket. The events sent to it are
+// streamed to the clients of /events.
+type engine struct {
+	socket  string
+	events  chan string
+	filters chan string
+}
+
+func newEngine(t *testing.T) *engine {
+
+	e := &engine{
+		socket:  filepath.Join(t.TempDir(), "docker.sock"),
+		events:  make(chan string),
+		filters: make(chan string, 1),
+	}
+
+	listener, err := net.Listen("unix", e.socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(containersJSON))
+	})
+
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+
+		select {
+		case e.filters <- r.URL.Query().Get("filters"):
+		default:
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event := <-e.events:
+				w.Write([]byte(event + "\n"))
+				w.(http.Flusher).Flush()
+			}
+		}
+	})
+
+	server := httptest.NewUnstartedServer(mux)
+	server.Listener = listener
+	server.Start()
+
+	t.Cleanup(server.Close)
+
+	return e
+}
+
+func recordsString(records *Records) string {
+
+	var s []string
+
+	for _, r := range records.ARecords {
+		s = append(s, "A "+r.Hostname+"."+r.Domain+"="+r.IP)
+	}
+	for _, r := range records.AAAARecords {
+		s = append(s, "AAAA "+r.Hostname+"."+r.Domain+"="+r.IP)
+	}
+
+	sort.Strings(s)
+	return strings.Join(s, " ")
+}
+
+func TestGetRecords(t *testing.T) {
+
+	e := newEngine(t)
+
+	tests := []struct {
+		name     string
+		config   *Config
+		expected string
+		ptrs     int
+	}{
+		{
+			// The IPs on every network are used
+			name:     "default",
+			config:   &Config{Socket: e.socket},
+			expected: "A db.home=172.17.0.4 A db.home=172.18.0.4 A grafana-1.home=172.17.0.2 A jodys-wiki.lab=172.17.0.3 AAAA db.home=fd00::4",
+			ptrs:     5,
+		},
+		{
+			name:     "labeled only",
+			config:   &Config{Socket: e.socket, Domain: "docker", LabeledOnly: true},
+			expected: "A jodys-wiki.lab=172.17.0.3",
+			ptrs:     1,
+		},
+		{
+			name:     "network",
+			config:   &Config{Socket: e.socket, Network: "bridge"},
+			expected: "A db.home=172.17.0.4 A grafana-1.home=172.17.0.2 A jodys-wiki.lab=172.17.0.3",
+			ptrs:     3,
+		},
+		{
+			name:     "missing network",
+			config:   &Config{Socket: e.socket, Network: "frontend"},
+			expected: "",
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			records, err := New(test.config).GetRecords()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := recordsString(records); got != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, got)
+			}
+
+			if len(records.PtrRecords) != test.ptrs {
+				t.Errorf("expected %d PTR records, got %d", test.ptrs, len(records.PtrRecords))
+			}
+		})
+	}
+}
+
+func TestWatch(t *testing.T) {
+
+	e := newEngine(t)
+
+	changed := make(chan struct{}, 1)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+		New(&Config{Socket: e.socket}).Watch(done, func() { changed <- struct{}{} })
+	}()
+
+	var filters map[string][]string
+
+	select {
+	case v := <-e.filters:
+		if err := json.Unmarshal([]byte(v), &filters); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected the events stream to be opened")
+	}
+
+	if !strings.Contains(strings.Join(filters["event"], " "), "start die") {
+		t.Errorf("expected the start and die events in the filters, got %v", filters)
+	}
+
+	for _, action := range []string{"start", "die"} {
+
+		e.events <- `{"Type":"container","Action":"` + action + `","Actor":{"ID":"1"}}`
+
+		select {
+		case <-changed:
+		case <-time.After(time.Second * 5):
+			t.Fatalf("expected a change for the %s event", action)
+		}
+	}
+
+	close(done)
+
+	select {
+	case <-finished:
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected Watch to return when done is closed")
+	}
+}
@@ -11,6 +11,8 @@ require (
 	github.com/miekg/dns v1.1.56
 	github.com/spf13/cobra v1.7.0
 	go.uber.org/zap v1.26.0
+	golang.org/x/net v0.15.0
+	golang.org/x/sys v0.12.0
 	gopkg.in/yaml.v2 v2.4.0
 )
 
@@ -25,7 +27,6 @@ require (
 	github.com/spf13/pflag v1.0.5 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
 	golang.org/x/mod v0.12.0 // indirect
-	golang.org/x/net v0.15.0 // indirect
-	golang.org/x/sys v0.12.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
 	golang.org/x/tools v0.13.0 // indirect
 )
@@ -0,0 +1,303 @@
+package homeassistant
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jodydadescott/home-server/types"
+	"github.com/jodydadescott/home-server/util"
+)
+
+type Config = types.HomeAssistantConfig
+type ARecord = types.ARecord
+type PTRrecord = types.PTRrecord
+type Records = types.DomainRecords
+
+const (
+	source = "homeassistant"
+
+	defaultRefresh  = time.Minute * 5
+	defaultTemplate = "{{.Name}}"
+
+	requestTimeout = time.Second * 30
+
+	// reconnectDelay is the wait before the WebSocket is opened again
+	reconnectDelay = time.Second * 5
+)
+
+var defaultIPAttributes = []string{"ip", "ip_address", "host"}
+
+// state is the part of an entity state from the REST API that is used
+type state struct {
+	EntityID   string         `json:"entity_id"`
+	State      string         `json:"state"`
+	Attributes map[string]any `json:"attributes"`
+}
+
+// nameFields are the fields that can be used in the name template
+type nameFields struct {
+	Name         string
+	Area         string
+	Entity       string
+	Manufacturer string
+	Model        string
+}
+
+// Client is a provider for the devices of a Home Assistant instance that have
+// an IP
+type Client struct {
+	url        string
+	token      string
+	domain     string
+	registry   bool
+	template   *template.Template
+	attributes []string
+	refresh    time.Duration
+	priority   int
+	httpClient *http.Client
+}
+
+func New(config *Config) *Client {
+
+	if config == nil {
+		panic("config is required")
+	}
+
+	config = config.Clone()
+
+	if config.URL == "" {
+		panic("URL is required")
+	}
+
+	if config.Token == "" {
+		panic("Token is required")
+	}
+
+	if _, err := url.Parse(config.URL); err != nil {
+		panic(fmt.Sprintf("Home Assistant URL %s is invalid; error %s", config.URL, err.Error()))
+	}
+
+	text := config.NameTemplate
+	if text == "" {
+		text = defaultTemplate
+	}
+
+	tmpl, err := template.New("name").Parse(text)
+	if err == nil {
+		// A field that does not exist is only found when the template is run
+		err = tmpl.Execute(io.Discard, &nameFields{})
+	}
+
+	if err != nil {
+		panic(fmt.Sprintf("Home Assistant name template %s is invalid; error %s", text, err.Error()))
+	}
+
+	client := &Client{
+		url:        strings.TrimSuffix(config.URL, "/"),
+		token:      config.Token,
+		domain:     types.DefaultDomain,
+		registry:   config.Registry,
+		template:   tmpl,
+		attributes: defaultIPAttributes,
+		refresh:    defaultRefresh,
+		priority:   config.Priority,
+		httpClient: &http.Client{Timeout: requestTimeout},
+	}
+
+	if config.Domain != "" {
+		client.domain = strings.TrimSuffix(config.Domain, ".")
+	}
+
+	if len(config.IPAttributes) > 0 {
+		client.attributes = config.IPAttributes
+	}
+
+	if config.Refresh > 0 {
+		client.refresh = config.Refresh
+	}
+
+	return client
+}
+
+func (t *Client) GetName() string {
+	if u, err := url.Parse(t.url); err == nil && u.Host != "" {
+		return source + ":" + u.Host
+	}
+	return source + ":" + t.url
+}
+
+func (t *Client) GetDomainName() string {
+	return t.domain
+}
+
+// GetRefreshDuration returns the interval at which the states are read. IPs
+// change without a registry change so they are read even if the registries are
+// watched.
+func (t *Client) GetRefreshDuration() time.Duration {
+	return t.refresh
+}
+
+// GetPriority implements dns.Prioritized
+func (t *Client) GetPriority() int {
+	return t.priority
+}
+
+func (t *Client) getStates(ctx context.Context) ([]*state, error) {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url+"/api/states", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Home Assistant /api/states returned %s", resp.Status)
+	}
+
+	var states []*state
+	if err := json.NewDecoder(resp.Body).Decode(&states); err != nil {
+		return nil, fmt.Errorf("Home Assistant states are invalid; error %s", err.Error())
+	}
+
+	return states, nil
+}
+
+func (t *Client) GetRecords() (*Records, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	states, err := t.getStates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var reg *registries
+	if t.registry {
+		reg, err = t.getRegistries()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return t.getRecords(states, reg), nil
+}
+
+// getRecords returns the A or AAAA and PTR records for the entities that have
+// an IP. The entities of a device have the name of the device so a device with
+// more than one IP has a record for each.
+func (t *Client) getRecords(states []*state, reg *registries) *Records {
+
+	records := &Records{}
+	src := source + ":entity"
+	seen := make(map[string]bool)
+
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].EntityID < states[j].EntityID
+	})
+
+	for _, s := range states {
+
+		ips := t.getIPs(s)
+		if len(ips) == 0 {
+			continue
+		}
+
+		fields := reg.getFields(s)
+
+		var b strings.Builder
+		if err := t.template.Execute(&b, fields); err != nil {
+			zap.L().Debug(fmt.Sprintf("Home Assistant entity %s does not have a name; error %s", s.EntityID, err.Error()))
+			continue
+		}
+
+		hostname := util.ToLabel(b.String())
+		if hostname == "" {
+			zap.L().Debug(fmt.Sprintf("Home Assistant entity %s does not have a name", s.EntityID))
+			continue
+		}
+
+		for _, ip := range ips {
+
+			if seen[hostname+" "+ip] {
+				continue
+			}
+			seen[hostname+" "+ip] = true
+
+			arpa, err := util.GetARPA(ip)
+			if err != nil {
+				zap.L().Debug(fmt.Sprintf("Home Assistant entity %s has an invalid IP; error %s", s.EntityID, err.Error()))
+				continue
+			}
+
+			a := &ARecord{
+				Hostname: hostname,
+				Domain:   t.domain,
+				IP:       ip,
+				SRC:      src,
+			}
+
+			if net.ParseIP(ip).To4() != nil {
+				records.AddARecords(a)
+			} else {
+				records.AddAAAARecords(a)
+			}
+
+			records.AddPtrRecords(&PTRrecord{
+				ARPA:     arpa,
+				Hostname: hostname,
+				Domain:   t.domain,
+				SRC:      src,
+			})
+		}
+	}
+
+	return records
+}
+
+// getIPs returns the IPs in the IP attributes of the entity. An attribute may
+// be a list and the host attribute may be a hostname which is ignored.
+func (t *Client) getIPs(s *state) []string {
+
+	var ips []string
+
+	add := func(v any) {
+		if value, ok := v.(string); ok {
+			if ip := net.ParseIP(strings.TrimSpace(value)); ip != nil && !ip.IsUnspecified() && !ip.IsLoopback() {
+				ips = append(ips, ip.String())
+			}
+		}
+	}
+
+	for _, attribute := range t.attributes {
+		switch v := s.Attributes[attribute].(type) {
+		case []any:
+			for _, item := range v {
+				add(item)
+			}
+		default:
+			add(v)
+		}
+	}
+
+	return ips
+}
@@ -0,0 +1,240 @@
+package homeassistant
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/jodydadescott/home-server/types"
+)
+
+const token = "test-token"
+
+// newStub returns a Home Assistant stub that serves the states and the
+// registries from the recorded fixtures in testdata. After the registry events
+// are subscribed to it sends a device registry event.
+func newStub(t *testing.T) *httptest.Server {
+
+	t.Helper()
+
+	fixture := func(name string) json.RawMessage {
+		b, err := os.ReadFile("testdata/" + name + ".json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api/states", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "401: Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(fixture("states"))
+	})
+
+	mux.Handle("/api/websocket", websocket.Handler(func(ws *websocket.Conn) {
+
+		websocket.JSON.Send(ws, map[string]string{"type": "auth_required", "ha_version": "2023.10.5"})
+
+		var auth map[string]string
+		if err := websocket.JSON.Receive(ws, &auth); err != nil {
+			return
+		}
+
+		if auth["access_token"] != token {
+			websocket.JSON.Send(ws, map[string]string{"type": "auth_invalid", "message": "Invalid access token or password"})
+			return
+		}
+
+		websocket.JSON.Send(ws, map[string]string{"type": "auth_ok", "ha_version": "2023.10.5"})
+
+		subscriptions := 0
+
+		for {
+
+			var command struct {
+				ID   int    `json:"id"`
+				Type string `json:"type"`
+			}
+
+			if err := websocket.JSON.Receive(ws, &command); err != nil {
+				return
+			}
+
+			result := map[string]any{"id": command.ID, "type": "result", "success": true, "result": nil}
+
+			switch command.Type {
+			case "config/device_registry/list":
+				result["result"] = fixture("devices")
+			case "config/entity_registry/list":
+				result["result"] = fixture("entities")
+			case "config/area_registry/list":
+				result["result"] = fixture("areas")
+			case "subscribe_events":
+				subscriptions++
+			default:
+				result = map[string]any{"id": command.ID, "type": "result", "success": false, "error": map[string]string{"code": "unknown_command", "message": "Unknown command."}}
+			}
+
+			websocket.JSON.Send(ws, result)
+
+			if subscriptions == len(registryEvents) {
+				subscriptions = 0
+				websocket.JSON.Send(ws, map[string]any{"id": command.ID, "type": "event", "event": map[string]any{"event_type": "device_registry_updated", "data": map[string]string{"action": "update", "device_id": "dev-light"}}})
+			}
+		}
+	}))
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// names returns each name with its sorted IPs
+func names(records *types.DomainRecords) map[string]string {
+
+	ips := make(map[string][]string)
+	for _, r := range append(append([]*types.ARecord{}, records.ARecords...), records.AAAARecords...) {
+		ips[r.Hostname+"."+r.Domain] = append(ips[r.Hostname+"."+r.Domain], r.IP)
+	}
+
+	result := make(map[string]string)
+	for name, v := range ips {
+		sort.Strings(v)
+		result[name] = strings.Join(v, ",")
+	}
+
+	return result
+}
+
+func expectNames(t *testing.T, got, expected map[string]string) {
+
+	t.Helper()
+
+	for name, ips := range expected {
+		if got[name] != ips {
+			t.Errorf("%s: expected %s, got %s", name, ips, got[name])
+		}
+	}
+
+	for name := range got {
+		if _, ok := expected[name]; !ok {
+			t.Errorf("unexpected record for %s", name)
+		}
+	}
+}
+
+func TestGetRecords(t *testing.T) {
+
+	server := newStub(t)
+
+	records, err := New(&Config{URL: server.URL, Token: token, Domain: "iot.home"}).GetRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the registries the names are the entity names
+	expectNames(t, names(records), map[string]string{
+		"kitchen-light.iot.home":        "192.168.20.40",
+		"kitchen-light-signal.iot.home": "192.168.20.40",
+		"brother-printer.iot.home":      "192.168.20.5",
+		"living-room-speaker.iot.home":  "192.168.20.60,192.168.20.61,2001:db8:0:ab14::61",
+	})
+
+	if len(records.PtrRecords) != 6 {
+		t.Errorf("expected 6 PTR records, got %d", len(records.PtrRecords))
+	}
+}
+
+func TestGetRecordsWithRegistry(t *testing.T) {
+
+	server := newStub(t)
+
+	client := New(&Config{
+		URL:          server.URL,
+		Token:        token,
+		Domain:       "iot.home",
+		Registry:     true,
+		NameTemplate: "{{if .Area}}{{.Area}}-{{end}}{{.Name}}",
+	})
+
+	records, err := client.GetRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The entities of a device have the name of the device and the area of an
+	// entity overrides the area of its device
+	expectNames(t, names(records), map[string]string{
+		"kitchen-light.iot.home":       "192.168.20.40",
+		"office-hl-l2350dw.iot.home":   "192.168.20.5",
+		"living-room-speaker.iot.home": "192.168.20.60,192.168.20.61,2001:db8:0:ab14::61",
+	})
+}
+
+func TestIPAttributes(t *testing.T) {
+
+	server := newStub(t)
+
+	config := &Config{URL: server.URL, Token: token}
+	config.AddIPAttributes("ip")
+
+	records, err := New(config).GetRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectNames(t, names(records), map[string]string{
+		"brother-printer.home": "192.168.20.5",
+	})
+}
+
+func TestWatch(t *testing.T) {
+
+	server := newStub(t)
+
+	client := New(&Config{URL: server.URL, Token: token, Registry: true})
+
+	done := make(chan struct{})
+	changed := make(chan struct{}, 1)
+
+	go client.Watch(done, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	defer close(done)
+
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("registry event did not refresh the records")
+	}
+}
+
+func TestInvalidToken(t *testing.T) {
+
+	server := newStub(t)
+
+	if _, err := New(&Config{URL: server.URL, Token: "wrong"}).GetRecords(); err == nil {
+		t.Error("expected an error for an invalid token")
+	}
+
+	if _, err := New(&Config{URL: server.URL, Token: "wrong"}).getRegistries(); err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Errorf("expected an authentication error, got %v", err)
+	}
+}
@@ -0,0 +1,330 @@
+package homeassistant
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+)
+
+// registryEvents are the events that are watched to refresh the records
+var registryEvents = []string{"device_registry_updated", "entity_registry_updated", "area_registry_updated"}
+
+// message is a message of the WebSocket API
+type message struct {
+	ID      int             `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Success bool            `json:"success,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Event   json.RawMessage `json:"event,omitempty"`
+	Message string          `json:"message,omitempty"`
+	Error   *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+type device struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	NameByUser   string `json:"name_by_user"`
+	AreaID       string `json:"area_id"`
+	Manufacturer string `json:"manufacturer"`
+	Model        string `json:"model"`
+}
+
+type entity struct {
+	EntityID string `json:"entity_id"`
+	DeviceID string `json:"device_id"`
+	AreaID   string `json:"area_id"`
+}
+
+type area struct {
+	AreaID string `json:"area_id"`
+	Name   string `json:"name"`
+}
+
+// registries are the devices, entities and areas of Home Assistant by ID
+type registries struct {
+	devices  map[string]*device
+	entities map[string]*entity
+	areas    map[string]string
+}
+
+// getFields returns the name template fields for the entity. Without the
+// registries the name is the friendly name of the entity.
+func (t *registries) getFields(s *state) *nameFields {
+
+	fields := &nameFields{Entity: s.EntityID}
+
+	if _, id, ok := strings.Cut(s.EntityID, "."); ok {
+		fields.Entity = id
+	}
+
+	fields.Name = fields.Entity
+	if name, ok := s.Attributes["friendly_name"].(string); ok && name != "" {
+		fields.Name = name
+	}
+
+	if t == nil {
+		return fields
+	}
+
+	e := t.entities[s.EntityID]
+	if e == nil {
+		return fields
+	}
+
+	areaID := e.AreaID
+
+	if d := t.devices[e.DeviceID]; d != nil {
+
+		if d.NameByUser != "" {
+			fields.Name = d.NameByUser
+		} else if d.Name != "" {
+			fields.Name = d.Name
+		}
+
+		fields.Manufacturer = d.Manufacturer
+		fields.Model = d.Model
+
+		// The area of an entity overrides the area of its device
+		if areaID == "" {
+			areaID = d.AreaID
+		}
+	}
+
+	fields.Area = t.areas[areaID]
+
+	return fields
+}
+
+// conn is an authenticated connection to the WebSocket API
+type conn struct {
+	ws *websocket.Conn
+	id int
+}
+
+// dial opens the WebSocket API and authenticates with the token
+func (t *Client) dial() (*conn, error) {
+
+	u := "ws" + strings.TrimPrefix(t.url, "http") + "/api/websocket"
+
+	config, err := websocket.NewConfig(u, t.url)
+	if err != nil {
+		return nil, err
+	}
+
+	config.Dialer = &net.Dialer{Timeout: requestTimeout}
+
+	ws, err := websocket.DialConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &conn{ws: ws}
+
+	ws.SetDeadline(time.Now().Add(requestTimeout))
+
+	var m message
+
+	if err := websocket.JSON.Receive(ws, &m); err != nil {
+		ws.Close()
+		return nil, err
+	}
+
+	if m.Type != "auth_required" {
+		ws.Close()
+		return nil, fmt.Errorf("Home Assistant WebSocket sent %s instead of auth_required", m.Type)
+	}
+
+	if err := websocket.JSON.Send(ws, map[string]string{"type": "auth", "access_token": t.token}); err != nil {
+		ws.Close()
+		return nil, err
+	}
+
+	m = message{}
+	if err := websocket.JSON.Receive(ws, &m); err != nil {
+		ws.Close()
+		return nil, err
+	}
+
+	if m.Type != "auth_ok" {
+		ws.Close()
+		return nil, fmt.Errorf("Home Assistant WebSocket authentication failed: %s", m.Message)
+	}
+
+	ws.SetDeadline(time.Time{})
+
+	return c, nil
+}
+
+func (t *conn) close() {
+	t.ws.Close()
+}
+
+// call sends the command and decodes the result into v
+func (t *conn) call(command map[string]any, v any) error {
+
+	t.id++
+	id := t.id
+	command["id"] = id
+
+	if err := websocket.JSON.Send(t.ws, command); err != nil {
+		return err
+	}
+
+	for {
+
+		var m message
+		if err := websocket.JSON.Receive(t.ws, &m); err != nil {
+			return err
+		}
+
+		if m.ID != id || m.Type != "result" {
+			continue
+		}
+
+		if !m.Success {
+			if m.Error != nil {
+				return fmt.Errorf("Home Assistant %s failed: %s", command["type"], m.Error.Message)
+			}
+			return fmt.Errorf("Home Assistant %s failed", command["type"])
+		}
+
+		if v == nil {
+			return nil
+		}
+
+		return json.Unmarshal(m.Result, v)
+	}
+}
+
+// getRegistries reads the device, entity and area registries
+func (t *Client) getRegistries() (*registries, error) {
+
+	c, err := t.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+
+	c.ws.SetDeadline(time.Now().Add(requestTimeout))
+
+	var devices []*device
+	var entities []*entity
+	var areas []*area
+
+	if err := c.call(map[string]any{"type": "config/device_registry/list"}, &devices); err != nil {
+		return nil, err
+	}
+
+	if err := c.call(map[string]any{"type": "config/entity_registry/list"}, &entities); err != nil {
+		return nil, err
+	}
+
+	if err := c.call(map[string]any{"type": "config/area_registry/list"}, &areas); err != nil {
+		return nil, err
+	}
+
+	reg := &registries{
+		devices:  make(map[string]*device),
+		entities: make(map[string]*entity),
+		areas:    make(map[string]string),
+	}
+
+	for _, d := range devices {
+		reg.devices[d.ID] = d
+	}
+
+	for _, e := range entities {
+		reg.entities[e.EntityID] = e
+	}
+
+	for _, a := range areas {
+		reg.areas[a.AreaID] = a.Name
+	}
+
+	return reg, nil
+}
+
+// Watch implements dns.Watcher. If the registries are used the registry events
+// are followed and the records are refreshed when a device, entity or area
+// changes. The WebSocket is opened again if it closes.
+func (t *Client) Watch(done <-chan struct{}, changed func()) {
+
+	if !t.registry {
+		return
+	}
+
+	for {
+
+		err := t.watch(done, changed)
+
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		if err != nil {
+			zap.L().Debug(fmt.Sprintf("Home Assistant WebSocket for %s closed; error %s", t.url, err.Error()))
+		}
+
+		select {
+		case <-done:
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func (t *Client) watch(done <-chan struct{}, changed func()) error {
+
+	c, err := t.dial()
+	if err != nil {
+		return err
+	}
+
+	// The connection is closed when done so that Receive returns
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		select {
+		case <-done:
+		case <-stop:
+		}
+		c.close()
+	}()
+
+	for _, event := range registryEvents {
+		if err := c.call(map[string]any{"type": "subscribe_events", "event_type": event}, nil); err != nil {
+			return err
+		}
+	}
+
+	for {
+
+		var m message
+		if err := websocket.JSON.Receive(c.ws, &m); err != nil {
+			return err
+		}
+
+		if m.Type != "event" {
+			continue
+		}
+
+		var event struct {
+			EventType string `json:"event_type"`
+		}
+		json.Unmarshal(m.Event, &event)
+
+		zap.L().Debug(fmt.Sprintf("Home Assistant event %s", event.EventType))
+		changed()
+	}
+}
@@ -0,0 +1,209 @@
+package hosts
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jodydadescott/home-server/types"
+	"github.com/jodydadescott/home-server/util"
+)
+
+type Config = types.HostsConfig
+type ARecord = types.ARecord
+type CNameRecord = types.CNameRecord
+type PTRrecord = types.PTRrecord
+type Records = types.DomainRecords
+
+const (
+	source = "hosts"
+)
+
+// reserved is fe00::/8 which has the ip6-localnet entry of Debian hosts files
+// as well as the link-local and the deprecated site-local addresses
+var reserved = &net.IPNet{IP: net.ParseIP("fe00::"), Mask: net.CIDRMask(8, 128)}
+
+// Client is a provider for records in /etc/hosts format files
+type Client struct {
+	domain   string
+	files    []string
+	priority int
+}
+
+func New(config *Config) *Client {
+
+	if config == nil {
+		panic("config is required")
+	}
+
+	config = config.Clone()
+
+	if len(config.Files) == 0 {
+		panic("at least one hosts file is required")
+	}
+
+	domain := types.DefaultDomain
+	if config.Domain != "" {
+		domain = config.Domain
+	}
+
+	return &Client{
+		domain:   domain,
+		files:    config.Files,
+		priority: config.Priority,
+	}
+}
+
+func (t *Client) GetName() string {
+	return source
+}
+
+func (t *Client) GetDomainName() string {
+	return t.domain
+}
+
+func (t *Client) GetRefreshDuration() time.Duration {
+	return 0
+}
+
+// GetPriority implements dns.Prioritized
+func (t *Client) GetPriority() int {
+	return t.priority
+}
+
+// Static implements dns.Static
+func (t *Client) Static() bool {
+	return true
+}
+
+// Watch implements dns.Watcher
+func (t *Client) Watch(done <-chan struct{}, changed func()) {
+	util.WatchFiles(done, t.files, changed)
+}
+
+func (t *Client) GetRecords() (*Records, error) {
+
+	records := &Records{}
+
+	for _, file := range t.files {
+
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+
+		err = t.parse(f, file, records)
+		f.Close()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return records, nil
+}
+
+// splitName returns the hostname and domain for a name. A name without a dot is
+// put in the default domain.
+func (t *Client) splitName(name string) (string, string) {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	parts := strings.SplitN(name, ".", 2)
+	if len(parts) == 1 {
+		return parts[0], t.domain
+	}
+	return parts[0], parts[1]
+}
+
+// parse adds the records from a hosts file. The first name on each line becomes
+// an A or AAAA record with a PTR record and any other names become CNAMEs for
+// the first name. Loopback, broadcast, multicast and link-local addresses are
+// skipped as hosts files have them for localhost and the IPv6 multicast groups.
+func (t *Client) parse(r io.Reader, file string, records *Records) error {
+
+	src := source + ":" + file
+	line := 0
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+
+		line++
+
+		text := strings.SplitN(scanner.Text(), "#", 2)[0]
+		fields := strings.Fields(text)
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) < 2 {
+			return fmt.Errorf("%s line %d: expected an IP and at least one name", file, line)
+		}
+
+		// An IPv6 address may have a zone such as fe80::1%lo0 on macOS
+		address, _, _ := strings.Cut(fields[0], "%")
+
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return fmt.Errorf("%s line %d: IP %s is invalid", file, line, fields[0])
+		}
+
+		if ip.IsLoopback() || ip.IsUnspecified() || ip.Equal(net.IPv4bcast) || ip.IsMulticast() || ip.IsLinkLocalUnicast() || reserved.Contains(ip) {
+			zap.L().Debug(fmt.Sprintf("%s line %d: skipping %s", file, line, fields[0]))
+			continue
+		}
+
+		hostname, domain := t.splitName(fields[1])
+
+		a := &ARecord{
+			Hostname: hostname,
+			Domain:   domain,
+			IP:       ip.String(),
+			SRC:      src,
+		}
+
+		if ip.To4() != nil {
+			records.AddARecords(a)
+		} else {
+			records.AddAAAARecords(a)
+		}
+
+		arpa, err := util.GetARPA(ip.String())
+		if err != nil {
+			return fmt.Errorf("%s line %d: %s", file, line, err.Error())
+		}
+
+		records.AddPtrRecords(&PTRrecord{
+			ARPA:     arpa,
+			Hostname: hostname,
+			Domain:   domain,
+			SRC:      src,
+		})
+
+		for _, alias := range fields[2:] {
+
+			aliasHostname, aliasDomain := t.splitName(alias)
+
+			// An alias that is the short form of the name would point at itself
+			if aliasHostname+"."+aliasDomain == hostname+"."+domain {
+				continue
+			}
+
+			records.AddCNameRecords(&CNameRecord{
+				AliasHostname:  aliasHostname,
+				AliasDomain:    aliasDomain,
+				TargetHostname: hostname,
+				TargetDomain:   domain,
+				SRC:            src,
+			})
+		}
+	}
+
+	return scanner.Err()
+}
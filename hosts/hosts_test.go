@@ -0,0 +1,70 @@
+package hosts
+
+import (
+	"strings"
+	"testing"
+)
+
+// The defaults of macOS and Debian hosts files followed by the entries of a
+// home network
+const hostsFile = `##
+# Host Database
+##
+127.0.0.1	localhost
+255.255.255.255	broadcasthost
+::1             localhost
+fe80::1%lo0	localhost
+
+127.0.1.1	workstation.home	workstation
+::1     ip6-localhost ip6-loopback
+fe00::0 ip6-localnet
+ff00::0 ip6-mcastprefix
+ff02::1 ip6-allnodes
+ff02::2 ip6-allrouters
+169.254.10.1	link-local
+
+192.168.1.10	nas.home	nas files
+2001:db8:0:1::10	nas6.home
+2001:DB8:0:1:0:0:0:20%eth0	printer6.home
+`
+
+func TestParse(t *testing.T) {
+
+	client := New(&Config{Files: []string{"hosts"}})
+
+	records := &Records{}
+	if err := client.parse(strings.NewReader(hostsFile), "hosts", records); err != nil {
+		t.Fatal(err)
+	}
+
+	var addresses []string
+	for _, r := range append(records.ARecords, records.AAAARecords...) {
+		addresses = append(addresses, r.Hostname+"."+r.Domain+"="+r.IP)
+	}
+
+	// The zone is dropped and the IP is in its canonical form
+	expected := "nas.home=192.168.1.10 nas6.home=2001:db8:0:1::10 printer6.home=2001:db8:0:1::20"
+	if strings.Join(addresses, " ") != expected {
+		t.Errorf("expected %s, got %s", expected, strings.Join(addresses, " "))
+	}
+
+	if len(records.PtrRecords) != 3 {
+		t.Errorf("expected 3 PTR records, got %d", len(records.PtrRecords))
+	}
+
+	// nas is the short form of nas.home so only files is an alias
+	if len(records.CnameRecords) != 1 || records.CnameRecords[0].AliasHostname != "files" {
+		t.Errorf("unexpected CNAME records %+v", records.CnameRecords)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+
+	client := New(&Config{Files: []string{"hosts"}})
+
+	for _, text := range []string{"192.168.1.300 nas\n", "fe80::1%lo0\n", "nas 192.168.1.10\n"} {
+		if err := client.parse(strings.NewReader(text), "hosts", &Records{}); err == nil {
+			t.Errorf("expected an error for %q", text)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package http
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jodydadescott/home-server/types"
+)
+
+// eventSource sends the events it is given to the subscriber
+type eventSource struct {
+	events       chan *RecordEvent
+	unsubscribed chan struct{}
+}
+
+func (t *eventSource) Subscribe() (<-chan *RecordEvent, func()) {
+	return t.events, func() { close(t.unsubscribed) }
+}
+
+func TestStreamEvents(t *testing.T) {
+
+	source := &eventSource{events: make(chan *RecordEvent, 3), unsubscribed: make(chan struct{})}
+
+	ts := httptest.NewServer(New(&Config{
+		Listener:       &NetPort{IP: "127.0.0.1"},
+		RecordProvider: &fixedRecords{},
+		EventSource:    source,
+	}))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("expected text/event-stream, got %s", contentType)
+	}
+
+	now := time.Date(2023, 10, 17, 20, 0, 0, 0, time.UTC)
+
+	sent := []*RecordEvent{
+		{Time: now, Action: types.RecordAdded, Type: "A", Name: "printer.home.", New: "192.168.1.50", SRC: "unifi:udm", Provider: "unifi"},
+		{Time: now, Action: types.RecordChanged, Type: "A", Name: "nas.home.", Old: "192.168.1.10", New: "192.168.1.11", SRC: "static", Provider: "static"},
+		{Time: now, Action: types.RecordRemoved, Type: "AAAA", Name: "tv.home.", Old: "2001:db8::60", SRC: "lease:dnsmasq", Provider: "lease"},
+	}
+
+	for _, event := range sent {
+		source.events <- event
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+
+	for _, expected := range sent {
+
+		var name string
+		var event RecordEvent
+
+		// Each event is an event line and a data line followed by a blank line
+		for scanner.Scan() && scanner.Text() != "" {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		if name != expected.Action {
+			t.Errorf("expected event %s, got %s", expected.Action, name)
+		}
+
+		if !event.Time.Equal(expected.Time) || event.Action != expected.Action || event.Type != expected.Type || event.Name != expected.Name ||
+			event.Old != expected.Old || event.New != expected.New || event.SRC != expected.SRC || event.Provider != expected.Provider {
+			t.Errorf("expected %+v, got %+v", expected, event)
+		}
+	}
+
+	// The subscription ends when the client disconnects
+	resp.Body.Close()
+
+	select {
+	case <-source.unsubscribed:
+	case <-time.After(time.Second):
+		t.Error("expected the client to be unsubscribed")
+	}
+}
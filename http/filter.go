@@ -0,0 +1,177 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/jodydadescott/home-server/util"
+)
+
+const (
+	recordTypeA     = "a"
+	recordTypeAAAA  = "aaaa"
+	recordTypeCNAME = "cname"
+	recordTypePTR   = "ptr"
+	recordTypeSRV   = "srv"
+	recordTypeTXT   = "txt"
+)
+
+// filter selects records based on the query parameters of a request. Every
+// parameter that is set must match for a record to be selected.
+type filter struct {
+	types  map[string]bool
+	prefix string
+	domain string
+	src    string
+	ipNet  *net.IPNet
+	regex  *regexp.Regexp
+}
+
+// newFilter parses the filter from the query parameters. The supported
+// parameters are type (comma separated list of a, aaaa, cname, ptr, srv and txt),
+// filter (hostname prefix), domain, src, ip (an IP or CIDR) and regex (matched
+// against the hostname).
+func newFilter(query url.Values) (*filter, error) {
+
+	f := &filter{
+		prefix: query.Get("filter"),
+		domain: normalizeDomain(query.Get("domain")),
+		src:    query.Get("src"),
+	}
+
+	if types := query.Get("type"); types != "" {
+		f.types = make(map[string]bool)
+		for _, v := range strings.Split(types, ",") {
+			v = strings.ToLower(strings.TrimSpace(v))
+			switch v {
+			case recordTypeA, recordTypeAAAA, recordTypeCNAME, recordTypePTR, recordTypeSRV, recordTypeTXT:
+				f.types[v] = true
+			default:
+				return nil, fmt.Errorf("type %s is invalid", v)
+			}
+		}
+	}
+
+	if ip := query.Get("ip"); ip != "" {
+		ipNet, err := util.ParseNetwork(ip)
+		if err != nil {
+			return nil, err
+		}
+		f.ipNet = ipNet
+	}
+
+	if regex := query.Get("regex"); regex != "" {
+		r, err := regexp.Compile(regex)
+		if err != nil {
+			return nil, fmt.Errorf("regex %s is invalid; error %s", regex, err.Error())
+		}
+		f.regex = r
+	}
+
+	return f, nil
+}
+
+func normalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(domain), ".")
+}
+
+func (t *filter) matchType(recordType string) bool {
+	if t.types == nil {
+		return true
+	}
+	return t.types[recordType]
+}
+
+func (t *filter) match(hostname, domain, src, ip string) bool {
+
+	if t.prefix != "" && !strings.HasPrefix(hostname, t.prefix) {
+		return false
+	}
+
+	if t.domain != "" && t.domain != normalizeDomain(domain) {
+		return false
+	}
+
+	if t.src != "" && t.src != src {
+		return false
+	}
+
+	if t.ipNet != nil {
+		parsed := net.ParseIP(ip)
+		if parsed == nil || !t.ipNet.Contains(parsed) {
+			return false
+		}
+	}
+
+	if t.regex != nil && !t.regex.MatchString(hostname) {
+		return false
+	}
+
+	return true
+}
+
+// apply returns a new DomainRecords containing only the matching records
+func (t *filter) apply(records *DomainRecords) *DomainRecords {
+
+	result := &DomainRecords{}
+
+	if t.matchType(recordTypeA) {
+		for _, record := range records.ARecords {
+			if t.match(record.Hostname, record.Domain, record.SRC, record.IP) {
+				result.AddARecords(record)
+			}
+		}
+	}
+
+	if t.matchType(recordTypeAAAA) {
+		for _, record := range records.AAAARecords {
+			if t.match(record.Hostname, record.Domain, record.SRC, record.IP) {
+				result.AddAAAARecords(record)
+			}
+		}
+	}
+
+	if t.matchType(recordTypeCNAME) {
+		for _, record := range records.CnameRecords {
+			// A CNAME has no IP of its own so it never matches an IP filter
+			if t.ipNet != nil {
+				continue
+			}
+			if t.match(record.AliasHostname, record.AliasDomain, record.SRC, "") {
+				result.AddCNameRecords(record)
+			}
+		}
+	}
+
+	if t.matchType(recordTypePTR) {
+		for _, record := range records.PtrRecords {
+			ip, _ := util.GetIP(record.ARPA)
+			if t.match(record.Hostname, record.Domain, record.SRC, ip) {
+				result.AddPtrRecords(record)
+			}
+		}
+	}
+
+	// SRV and TXT records have no IP of their own so they never match an IP
+	// filter
+	if t.matchType(recordTypeSRV) && t.ipNet == nil {
+		for _, record := range records.SrvRecords {
+			if t.match(record.Name, record.Domain, record.SRC, "") {
+				result.AddSrvRecords(record)
+			}
+		}
+	}
+
+	if t.matchType(recordTypeTXT) && t.ipNet == nil {
+		for _, record := range records.TxtRecords {
+			if t.match(record.Name, record.Domain, record.SRC, "") {
+				result.AddTxtRecords(record)
+			}
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,151 @@
+package http
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/jodydadescott/home-server/types"
+)
+
+// newRecords returns a record of each type from two domains and two sources
+func newRecords() *DomainRecords {
+
+	r := &DomainRecords{}
+
+	r.AddARecords(
+		&types.ARecord{Hostname: "nas", Domain: "home", IP: "192.168.1.10", SRC: "static"},
+		&types.ARecord{Hostname: "kitchen-light", Domain: "iot.home", IP: "192.168.20.40", SRC: "unifi"},
+	)
+	r.AddAAAARecords(&types.ARecord{Hostname: "nas", Domain: "home", IP: "2001:db8::10", SRC: "static"})
+	r.AddCNameRecords(&types.CNameRecord{AliasHostname: "files", AliasDomain: "home", TargetHostname: "nas", TargetDomain: "home", SRC: "static"})
+	r.AddPtrRecords(&types.PTRrecord{ARPA: "40.20.168.192.in-addr.arpa.", Hostname: "kitchen-light", Domain: "iot.home", SRC: "unifi"})
+	r.AddSrvRecords(&types.SRVRecord{Name: "_smb._tcp", Domain: "home", TargetHostname: "nas", TargetDomain: "home", Port: 445, SRC: "static"})
+	r.AddTxtRecords(&types.TXTRecord{Name: "nas", Domain: "home", Text: []string{"model=ds920"}, SRC: "static"})
+
+	return r
+}
+
+// recordsString returns the type and name of each record
+func recordsString(records *DomainRecords) string {
+
+	var s []string
+
+	for _, r := range records.ARecords {
+		s = append(s, "A "+r.Hostname+"."+r.Domain)
+	}
+	for _, r := range records.AAAARecords {
+		s = append(s, "AAAA "+r.Hostname+"."+r.Domain)
+	}
+	for _, r := range records.CnameRecords {
+		s = append(s, "CNAME "+r.AliasHostname+"."+r.AliasDomain)
+	}
+	for _, r := range records.PtrRecords {
+		s = append(s, "PTR "+r.Hostname+"."+r.Domain)
+	}
+	for _, r := range records.SrvRecords {
+		s = append(s, "SRV "+r.Name+"."+r.Domain)
+	}
+	for _, r := range records.TxtRecords {
+		s = append(s, "TXT "+r.Name+"."+r.Domain)
+	}
+
+	return strings.Join(s, ", ")
+}
+
+func TestFilter(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{
+			name:     "none",
+			query:    "",
+			expected: "A nas.home, A kitchen-light.iot.home, AAAA nas.home, CNAME files.home, PTR kitchen-light.iot.home, SRV _smb._tcp.home, TXT nas.home",
+		},
+		{
+			name:     "type",
+			query:    "type=A,%20ptr",
+			expected: "A nas.home, A kitchen-light.iot.home, PTR kitchen-light.iot.home",
+		},
+		{
+			name:     "prefix",
+			query:    "filter=kitchen",
+			expected: "A kitchen-light.iot.home, PTR kitchen-light.iot.home",
+		},
+		{
+			name:     "domain",
+			query:    "domain=IOT.home.",
+			expected: "A kitchen-light.iot.home, PTR kitchen-light.iot.home",
+		},
+		{
+			name:     "src",
+			query:    "src=static&type=a,aaaa",
+			expected: "A nas.home, AAAA nas.home",
+		},
+		{
+			// Records without an IP never match
+			name:     "ip",
+			query:    "ip=192.168.1.10",
+			expected: "A nas.home",
+		},
+		{
+			// The PTR record matches on the IP of its ARPA name
+			name:     "CIDR",
+			query:    "ip=192.168.0.0/16",
+			expected: "A nas.home, A kitchen-light.iot.home, PTR kitchen-light.iot.home",
+		},
+		{
+			name:     "IPv6 CIDR",
+			query:    "ip=2001:db8::/64",
+			expected: "AAAA nas.home",
+		},
+		{
+			name:     "regex",
+			query:    "regex=^(nas|files)$",
+			expected: "A nas.home, AAAA nas.home, CNAME files.home, TXT nas.home",
+		},
+		{
+			name:     "combined",
+			query:    "type=a&domain=home&regex=s$",
+			expected: "A nas.home",
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			query, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := newFilter(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := recordsString(f.apply(newRecords())); got != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestInvalidFilter(t *testing.T) {
+
+	for _, query := range []string{"type=mx", "ip=192.168.1.300", "ip=192.168.1.0/33", "regex=("} {
+
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := newFilter(values); err == nil {
+			t.Errorf("%s: expected an error", query)
+		}
+	}
+}
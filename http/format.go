@@ -0,0 +1,224 @@
+package http
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+	formatCSV   = "csv"
+	formatHosts = "hosts"
+	formatZone  = "zone"
+
+	zoneTTL = 3600
+)
+
+var contentTypes = map[string]string{
+	formatJSON:  "application/json",
+	formatYAML:  "application/yaml",
+	formatCSV:   "text/csv",
+	formatHosts: "text/plain",
+	formatZone:  "text/dns",
+}
+
+var acceptFormats = map[string]string{
+	"application/json":   formatJSON,
+	"application/yaml":   formatYAML,
+	"application/x-yaml": formatYAML,
+	"text/yaml":          formatYAML,
+	"text/csv":           formatCSV,
+	"text/x-hosts":       formatHosts,
+	"text/dns":           formatZone,
+}
+
+// getFormat returns the output format from the format query parameter or, if
+// it is not set, from the Accept header. JSON is the default.
+func getFormat(format, accept string) (string, error) {
+
+	if format != "" {
+		format = strings.ToLower(format)
+		if _, ok := contentTypes[format]; !ok {
+			return "", fmt.Errorf("format %s is invalid", format)
+		}
+		return format, nil
+	}
+
+	for _, v := range strings.Split(accept, ",") {
+		mediaType := strings.ToLower(strings.TrimSpace(strings.Split(v, ";")[0]))
+		if f, ok := acceptFormats[mediaType]; ok {
+			return f, nil
+		}
+	}
+
+	return formatJSON, nil
+}
+
+// encodeRecords returns the records encoded in the specified format
+func encodeRecords(format string, records *DomainRecords) ([]byte, error) {
+
+	switch format {
+
+	case formatJSON:
+		return json.Marshal(records)
+
+	case formatYAML:
+		return yaml.Marshal(records)
+
+	case formatCSV:
+		return encodeCSV(records)
+
+	case formatHosts:
+		return encodeHosts(records), nil
+
+	case formatZone:
+		return encodeZone(records), nil
+
+	}
+
+	return nil, fmt.Errorf("format %s is invalid", format)
+}
+
+func encodeCSV(records *DomainRecords) ([]byte, error) {
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	w.Write([]string{"type", "hostname", "domain", "name", "value", "src"})
+
+	for _, r := range records.ARecords {
+		w.Write([]string{"A", r.Hostname, r.Domain, r.GetKey(), r.GetValue(), r.SRC})
+	}
+
+	for _, r := range records.AAAARecords {
+		w.Write([]string{"AAAA", r.Hostname, r.Domain, r.GetKey(), r.GetValue(), r.SRC})
+	}
+
+	for _, r := range records.CnameRecords {
+		w.Write([]string{"CNAME", r.AliasHostname, r.AliasDomain, r.GetKey(), r.GetValue(), r.SRC})
+	}
+
+	for _, r := range records.PtrRecords {
+		w.Write([]string{"PTR", r.Hostname, r.Domain, r.GetKey(), r.GetValue(), r.SRC})
+	}
+
+	for _, r := range records.SrvRecords {
+		w.Write([]string{"SRV", r.Name, r.Domain, r.GetKey(), r.GetValue(), r.SRC})
+	}
+
+	for _, r := range records.TxtRecords {
+		w.Write([]string{"TXT", r.Name, r.Domain, r.GetKey(), r.GetValue(), r.SRC})
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// encodeHosts returns the records in /etc/hosts format. Each A and AAAA record
+// becomes a line with the FQDN and the short name. CNAMEs are added as aliases
+// to the lines of their target. PTR records are implied and not written.
+func encodeHosts(records *DomainRecords) []byte {
+
+	type line struct {
+		ip    string
+		names []string
+	}
+
+	var lines []*line
+	byName := make(map[string][]*line)
+
+	add := func(ip, fqdn string) {
+		fqdn = strings.TrimSuffix(fqdn, ".")
+		l := &line{ip: ip, names: []string{fqdn, strings.Split(fqdn, ".")[0]}}
+		lines = append(lines, l)
+		byName[fqdn] = append(byName[fqdn], l)
+	}
+
+	for _, r := range records.ARecords {
+		add(r.GetValue(), r.GetKey())
+	}
+
+	for _, r := range records.AAAARecords {
+		add(r.GetValue(), r.GetKey())
+	}
+
+	for _, r := range records.CnameRecords {
+		alias := strings.TrimSuffix(r.GetKey(), ".")
+		for _, l := range byName[strings.TrimSuffix(r.GetValue(), ".")] {
+			l.names = append(l.names, alias, strings.Split(alias, ".")[0])
+		}
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].names[0] < lines[j].names[0]
+	})
+
+	var buf bytes.Buffer
+	for _, l := range lines {
+		fmt.Fprintf(&buf, "%s\t%s\n", l.ip, strings.Join(l.names, " "))
+	}
+
+	return buf.Bytes()
+}
+
+// encodeZone returns the records as an RFC 1035 zone file. All names are
+// absolute so records from different domains can share the same file.
+func encodeZone(records *DomainRecords) []byte {
+
+	hdr := func(name string, rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: zoneTTL}
+	}
+
+	var rrs []dns.RR
+
+	for _, r := range records.ARecords {
+		rrs = append(rrs, &dns.A{Hdr: hdr(r.GetKey(), dns.TypeA), A: net.ParseIP(r.GetValue())})
+	}
+
+	for _, r := range records.AAAARecords {
+		rrs = append(rrs, &dns.AAAA{Hdr: hdr(r.GetKey(), dns.TypeAAAA), AAAA: net.ParseIP(r.GetValue())})
+	}
+
+	for _, r := range records.CnameRecords {
+		rrs = append(rrs, &dns.CNAME{Hdr: hdr(r.GetKey(), dns.TypeCNAME), Target: r.GetValue()})
+	}
+
+	for _, r := range records.PtrRecords {
+		rrs = append(rrs, &dns.PTR{Hdr: hdr(r.GetKey(), dns.TypePTR), Ptr: r.GetValue()})
+	}
+
+	for _, r := range records.SrvRecords {
+		rrs = append(rrs, &dns.SRV{
+			Hdr:      hdr(r.GetKey(), dns.TypeSRV),
+			Priority: r.Priority,
+			Weight:   r.Weight,
+			Port:     r.Port,
+			Target:   r.GetTarget(),
+		})
+	}
+
+	for _, r := range records.TxtRecords {
+		rrs = append(rrs, &dns.TXT{Hdr: hdr(r.GetKey(), dns.TypeTXT), Txt: r.Text})
+	}
+
+	sort.SliceStable(rrs, func(i, j int) bool {
+		return rrs[i].Header().Name < rrs[j].Header().Name
+	})
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "$TTL %d\n", zoneTTL)
+	for _, rr := range rrs {
+		fmt.Fprintln(&buf, rr.String())
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,127 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fixedRecords provides the records from newRecords
+type fixedRecords struct{}
+
+func (t *fixedRecords) GetRecords() *DomainRecords {
+	return newRecords()
+}
+
+func TestFormat(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		query       string
+		accept      string
+		status      int
+		contentType string
+		expected    string
+	}{
+		{
+			name:        "default",
+			query:       "type=a&domain=home",
+			status:      http.StatusOK,
+			contentType: "application/json",
+			expected:    `{"aRecords":[{"domain":"home","hostname":"nas","ip":"192.168.1.10","src":"static"}]}`,
+		},
+		{
+			name:        "yaml",
+			query:       "type=a&domain=home&format=YAML",
+			status:      http.StatusOK,
+			contentType: "application/yaml",
+			expected:    "aRecords:\n- domain: home\n  hostname: nas\n  ip: 192.168.1.10\n  src: static\n",
+		},
+		{
+			name:        "yaml from accept",
+			query:       "type=a&domain=home",
+			accept:      "text/html, application/x-yaml;q=0.9",
+			status:      http.StatusOK,
+			contentType: "application/yaml",
+			expected:    "aRecords:\n- domain: home\n  hostname: nas\n  ip: 192.168.1.10\n  src: static\n",
+		},
+		{
+			name:        "format over accept",
+			query:       "type=a&domain=home&format=csv",
+			accept:      "application/yaml",
+			status:      http.StatusOK,
+			contentType: "text/csv",
+			expected:    "type,hostname,domain,name,value,src\nA,nas,home,nas.home.,192.168.1.10,static\n",
+		},
+		{
+			name:        "csv from accept",
+			query:       "type=srv,txt",
+			accept:      "text/csv",
+			status:      http.StatusOK,
+			contentType: "text/csv",
+			expected:    "type,hostname,domain,name,value,src\nSRV,_smb._tcp,home,_smb._tcp.home.,0 0 445 nas.home.,static\nTXT,nas,home,nas.home.,\"\"\"model=ds920\"\"\",static\n",
+		},
+		{
+			// The CNAME is an alias on the lines of its target
+			name:        "hosts",
+			query:       "domain=home&format=hosts",
+			status:      http.StatusOK,
+			contentType: "text/plain",
+			expected:    "192.168.1.10\tnas.home nas files.home files\n2001:db8::10\tnas.home nas files.home files\n",
+		},
+		{
+			name:        "zone",
+			query:       "type=a,cname,ptr",
+			accept:      "text/dns",
+			status:      http.StatusOK,
+			contentType: "text/dns",
+			expected:    "$TTL 3600\n40.20.168.192.in-addr.arpa.\t3600\tIN\tPTR\tkitchen-light.iot.home.\nfiles.home.\t3600\tIN\tCNAME\tnas.home.\nkitchen-light.iot.home.\t3600\tIN\tA\t192.168.20.40\nnas.home.\t3600\tIN\tA\t192.168.1.10\n",
+		},
+		{
+			name:   "invalid format",
+			query:  "format=xml",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "invalid filter",
+			query:  "type=mx",
+			status: http.StatusBadRequest,
+		},
+	}
+
+	s := New(&Config{
+		Listener:       &NetPort{IP: "127.0.0.1"},
+		RecordProvider: &fixedRecords{},
+	})
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			r := httptest.NewRequest(http.MethodGet, "http://home-server.home:8080/getdevices?"+test.query, nil)
+			if test.accept != "" {
+				r.Header.Set("Accept", test.accept)
+			}
+
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, r)
+
+			if w.Code != test.status {
+				t.Fatalf("expected %d, got %d: %s", test.status, w.Code, w.Body.String())
+			}
+
+			if test.status != http.StatusOK {
+				return
+			}
+
+			if contentType := w.Header().Get("Content-Type"); contentType != test.contentType {
+				t.Errorf("expected content type %s, got %s", test.contentType, contentType)
+			}
+
+			if got := strings.TrimSpace(w.Body.String()); got != strings.TrimSpace(test.expected) {
+				t.Errorf("expected\n%s\ngot\n%s", test.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/jodydadescott/home-server/types"
+)
+
+// recentDevices is the number of new devices that the sensor keeps
+const recentDevices = 10
+
+// sensor counts the new devices from the record events. A new device is an A
+// or AAAA record that was added after the server started.
+type sensor struct {
+	mutex      sync.Mutex
+	newDevices int
+	recent     []*NewDevice
+}
+
+// watch counts the new devices from the events until the context is done
+func (t *sensor) watch(ctx context.Context, eventSource EventSource) {
+
+	events, unsubscribe := eventSource.Subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+
+		case <-ctx.Done():
+			return
+
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			t.add(event)
+		}
+	}
+}
+
+func (t *sensor) add(event *RecordEvent) {
+
+	if event.Action != types.RecordAdded || (event.Type != "A" && event.Type != "AAAA") {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.newDevices++
+
+	t.recent = append([]*NewDevice{{
+		Name:     strings.TrimSuffix(event.Name, "."),
+		IP:       event.New,
+		Provider: event.Provider,
+		Time:     event.Time,
+	}}, t.recent...)
+
+	if len(t.recent) > recentDevices {
+		t.recent = t.recent[:recentDevices]
+	}
+}
+
+// getSensor writes the record counts and the new devices for the RESTful
+// sensor of Home Assistant. The state of the sensor is records and the other
+// fields are its attributes.
+func (t *Server) getSensor(w http.ResponseWriter, r *http.Request) {
+
+	records := t.recordProvider.GetRecords()
+
+	s := &Sensor{
+		ARecords:     len(records.ARecords),
+		AAAARecords:  len(records.AAAARecords),
+		PTRRecords:   len(records.PtrRecords),
+		CNameRecords: len(records.CnameRecords),
+		SRVRecords:   len(records.SrvRecords),
+		TXTRecords:   len(records.TxtRecords),
+	}
+
+	s.Records = s.ARecords + s.AAAARecords + s.PTRRecords + s.CNameRecords + s.SRVRecords + s.TXTRecords
+
+	if t.statusProvider != nil {
+		for _, status := range t.statusProvider.GetProviderStatus() {
+			s.Providers++
+			if status.LastError != "" {
+				s.FailingProviders++
+			}
+		}
+	}
+
+	t.sensor.mutex.Lock()
+	s.NewDevices = t.sensor.newDevices
+	s.RecentNewDevices = append([]*NewDevice{}, t.sensor.recent...)
+	t.sensor.mutex.Unlock()
+
+	if len(s.RecentNewDevices) > 0 {
+		s.LastNewDevice = s.RecentNewDevices[0]
+	}
+
+	writeJSON(w, s)
+}
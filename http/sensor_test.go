@@ -0,0 +1,91 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jodydadescott/home-server/types"
+)
+
+type records struct{}
+
+func (t *records) GetRecords() *DomainRecords {
+	r := &DomainRecords{}
+	r.AddARecords(&types.ARecord{Hostname: "kitchen-light", Domain: "iot.home", IP: "192.168.20.40"})
+	r.AddARecords(&types.ARecord{Hostname: "printer", Domain: "home", IP: "192.168.20.5"})
+	r.AddPtrRecords(&types.PTRrecord{ARPA: "40.20.168.192.in-addr.arpa", Hostname: "kitchen-light", Domain: "iot.home"})
+	return r
+}
+
+type events chan *RecordEvent
+
+func (t events) Subscribe() (<-chan *RecordEvent, func()) {
+	return t, func() {}
+}
+
+func TestSensor(t *testing.T) {
+
+	source := make(events)
+
+	s := New(&Config{
+		Listener:       &NetPort{IP: "127.0.0.1", Port: 0},
+		RecordProvider: &records{},
+		EventSource:    source,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go s.sensor.watch(ctx, source)
+
+	now := time.Now()
+
+	// Only added A and AAAA records are new devices
+	source <- &RecordEvent{Time: now, Action: types.RecordAdded, Type: "A", Name: "kitchen-light.iot.home.", New: "192.168.20.40", Provider: "homeassistant:homeassistant.home:8123"}
+	source <- &RecordEvent{Time: now, Action: types.RecordAdded, Type: "PTR", Name: "40.20.168.192.in-addr.arpa.", New: "kitchen-light.iot.home."}
+	source <- &RecordEvent{Time: now, Action: types.RecordRemoved, Type: "A", Name: "old.home.", Old: "192.168.20.9"}
+	source <- &RecordEvent{Time: now, Action: types.RecordAdded, Type: "A", Name: "printer.home.", New: "192.168.20.5", Provider: "unifi:udm"}
+
+	var sensor *Sensor
+
+	for i := 0; i < 50; i++ {
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/sensor", nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+
+		sensor = &Sensor{}
+		if err := json.Unmarshal(w.Body.Bytes(), sensor); err != nil {
+			t.Fatal(err)
+		}
+
+		if sensor.NewDevices == 2 {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if sensor.Records != 3 || sensor.ARecords != 2 || sensor.PTRRecords != 1 {
+		t.Errorf("unexpected record counts %+v", sensor)
+	}
+
+	if sensor.NewDevices != 2 {
+		t.Fatalf("expected 2 new devices, got %d", sensor.NewDevices)
+	}
+
+	if sensor.LastNewDevice == nil || sensor.LastNewDevice.Name != "printer.home" || sensor.LastNewDevice.IP != "192.168.20.5" {
+		t.Errorf("unexpected last new device %+v", sensor.LastNewDevice)
+	}
+
+	if len(sensor.RecentNewDevices) != 2 || sensor.RecentNewDevices[1].Name != "kitchen-light.iot.home" {
+		t.Errorf("unexpected recent new devices %+v", sensor.RecentNewDevices)
+	}
+}
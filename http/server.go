@@ -2,11 +2,16 @@ package http
 
 import (
 	"context"
+	"embed"
 	"encoding/json"
 	"fmt"
+	"io/fs"
+	"mime"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -22,9 +27,25 @@ type HTTPRequest struct {
 	Header http.Header `json:"header,omitempty"`
 }
 
+const (
+	eventKeepAlive    = time.Second * 30
+	defaultAuditLimit = 1000
+)
+
+//go:embed ui
+var uiFS embed.FS
+
 type Server struct {
-	s              *http.Server
-	recordProvider RecordProvider
+	s               *http.Server
+	ui              http.Handler
+	recordProvider  RecordProvider
+	statusProvider  StatusProvider
+	recordEditor    RecordEditor
+	eventSource     EventSource
+	auditLog        AuditLog
+	conflictSource  ConflictSource
+	collisionSource CollisionSource
+	sensor          *sensor
 }
 
 // NewServer ...
@@ -42,8 +63,21 @@ func New(config *Config) *Server {
 		panic("RecordProvider is required")
 	}
 
+	ui, err := fs.Sub(uiFS, "ui")
+	if err != nil {
+		panic(err)
+	}
+
 	s := &Server{
-		recordProvider: config.RecordProvider,
+		ui:              http.FileServer(http.FS(ui)),
+		recordProvider:  config.RecordProvider,
+		statusProvider:  config.StatusProvider,
+		recordEditor:    config.RecordEditor,
+		eventSource:     config.EventSource,
+		auditLog:        config.AuditLog,
+		conflictSource:  config.ConflictSource,
+		collisionSource: config.CollisionSource,
+		sensor:          &sensor{},
 	}
 	s.s = &http.Server{Addr: config.Listener.GetIPColonPort(), Handler: s}
 	return s
@@ -51,6 +85,10 @@ func New(config *Config) *Server {
 
 func (t *Server) Run(ctx context.Context) error {
 
+	if t.eventSource != nil {
+		go t.sensor.watch(ctx, t.eventSource)
+	}
+
 	go func() {
 		<-ctx.Done()
 		zap.L().Info("Shutting down HTTP server on signal")
@@ -63,51 +101,339 @@ func (t *Server) Run(ctx context.Context) error {
 
 func (t *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
-	filter := r.URL.Query().Get("filter")
-
 	switch r.URL.Path {
 
 	case "/getdevices":
-		w.Header().Set("Content-Type", "application/json")
+		t.getDevices(w, r)
+		return
+
+	case "/api/status":
+		t.getStatus(w, r)
+		return
+
+	case "/api/querylog":
+		t.getQueryLog(w, r)
+		return
+
+	case "/api/records":
+		t.editRecords(w, r)
+		return
+
+	case "/api/events":
+		t.streamEvents(w, r)
+		return
+
+	case "/api/audit":
+		t.getAudit(w, r)
+		return
+
+	case "/api/conflicts":
+		t.getConflicts(w, r)
+		return
+
+	case "/api/collisions":
+		t.getCollisions(w, r)
+		return
+
+	case "/api/sensor":
+		t.getSensor(w, r)
+		return
+	}
+
+	t.ui.ServeHTTP(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		zap.L().Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// getStatus writes the provider refresh status and the upstream nameserver
+// health
+func (t *Server) getStatus(w http.ResponseWriter, r *http.Request) {
+
+	if t.statusProvider == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeJSON(w, &Status{
+		Providers:      t.statusProvider.GetProviderStatus(),
+		Upstreams:      t.statusProvider.GetUpstreamStatus(),
+		RuntimeEnabled: t.recordEditor != nil,
+		ACL:            t.statusProvider.GetACLStatus(),
+	})
+}
+
+// getQueryLog writes the most recent DNS queries
+func (t *Server) getQueryLog(w http.ResponseWriter, r *http.Request) {
+
+	if t.statusProvider == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeJSON(w, t.statusProvider.GetQueryLog())
+}
+
+// getConflicts writes the names that more than one provider has records for
+// with the record from each provider and which of them are used
+func (t *Server) getConflicts(w http.ResponseWriter, r *http.Request) {
+
+	if t.conflictSource == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	conflicts := t.conflictSource.GetConflicts()
+	if conflicts == nil {
+		conflicts = []*Conflict{}
+	}
+
+	writeJSON(w, conflicts)
+}
+
+// getCollisions writes the names that more than one client had with the name
+// each client was given
+func (t *Server) getCollisions(w http.ResponseWriter, r *http.Request) {
+
+	if t.collisionSource == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	collisions := t.collisionSource.GetCollisions()
+	if collisions == nil {
+		collisions = []*NameCollision{}
+	}
+
+	writeJSON(w, collisions)
+}
+
+// streamEvents writes record change events as Server-Sent Events until the
+// client disconnects. A comment is sent periodically to keep the connection
+// open through proxies.
+func (t *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+
+	if t.eventSource == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := t.eventSource.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
 
-		write := func(records *DomainRecords) {
-			j, err := json.Marshal(records)
+	for {
+		select {
+
+		case <-r.Context().Done():
+			return
+
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			b, err := json.Marshal(event)
 			if err != nil {
 				zap.L().Error(err.Error())
+				continue
 			}
-			fmt.Fprintf(w, string(j))
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Action, b)
+			flusher.Flush()
 		}
+	}
+}
+
+// getAudit writes the record events from the audit log. The since and until
+// query parameters are either RFC 3339 times or durations before now (such as
+// 24h). The hostname query parameter limits the events to a single host and
+// the limit query parameter is the number of most recent events (1000 if not
+// set).
+func (t *Server) getAudit(w http.ResponseWriter, r *http.Request) {
+
+	if t.auditLog == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
 
-		records := t.recordProvider.GetRecords()
+	since, err := parseTime(query.Get("since"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-		if filter == "" {
-			write(records)
+	until, err := parseTime(query.Get("until"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultAuditLimit
+	if v := query.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			http.Error(w, fmt.Sprintf("limit %s is invalid; must be a positive number", v), http.StatusBadRequest)
 			return
 		}
+	}
 
-		newRecords := &DomainRecords{}
+	events, err := t.auditLog.Query(since, until, query.Get("hostname"), limit)
+	if err != nil {
+		zap.L().Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-		for _, record := range records.ARecords {
-			if strings.HasPrefix(record.Hostname, filter) {
-				newRecords.AddARecords(record)
-			}
+	writeJSON(w, events)
+}
+
+func parseTime(input string) (time.Time, error) {
+
+	if input == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(input); err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, input)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("time %s is invalid; must be RFC 3339 or a duration", input)
+	}
+
+	return t, nil
+}
+
+// editRecords lists (GET), adds (POST) or removes (DELETE) runtime records. The
+// body for POST and DELETE is a DomainRecords in JSON. See checkEdit for the
+// requests that are allowed to change the records.
+func (t *Server) editRecords(w http.ResponseWriter, r *http.Request) {
+
+	if t.recordEditor == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		records, err := t.recordEditor.GetRecords()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
+		writeJSON(w, records)
+		return
+	}
 
-		for _, record := range records.AAAARecords {
-			if strings.HasPrefix(record.Hostname, filter) {
-				newRecords.AddAAAARecords(record)
-			}
+	if status, err := checkEdit(r); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	var records DomainRecords
+
+	err := json.NewDecoder(r.Body).Decode(&records)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+
+	case http.MethodPost:
+		err = t.recordEditor.AddRecords(&records)
+
+	case http.MethodDelete:
+		err = t.recordEditor.RemoveRecords(&records)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkEdit returns an error and the status for it if the request to change
+// the records could be a cross-site request. A form on another site can only
+// POST with a content type that is not JSON and a browser always sends the
+// Origin of a cross-site fetch, so the body must be JSON and the Origin, if
+// there is one, must be this server.
+func checkEdit(r *http.Request) (int, error) {
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return http.StatusUnsupportedMediaType, fmt.Errorf("Content-Type must be application/json")
+	}
+
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || !strings.EqualFold(u.Host, r.Host) {
+			return http.StatusForbidden, fmt.Errorf("Origin %s is not allowed", origin)
 		}
+	}
+
+	return 0, nil
+}
+
+// getDevices writes the records matching the query parameters (see newFilter)
+// in the format selected by the format query parameter or the Accept header
+// (see getFormat)
+func (t *Server) getDevices(w http.ResponseWriter, r *http.Request) {
 
-		write(newRecords)
+	query := r.URL.Query()
 
+	format, err := getFormat(query.Get("format"), r.Header.Get("Accept"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/html")
+	f, err := newFilter(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	fmt.Fprintf(w, "<p>Hello</p>")
-	fmt.Fprintf(w, "<p>You probably want to make one of the following calls</p>")
-	fmt.Fprintf(w, fmt.Sprintf("<p><a href=\"http:/%s/getdevices\">/getdevices?filter=shelly</a></p>", r.Host))
+	b, err := encodeRecords(format, f.apply(t.recordProvider.GetRecords()))
+	if err != nil {
+		zap.L().Error(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
+	w.Header().Set("Content-Type", contentTypes[format])
+	w.Write(b)
 }
@@ -0,0 +1,188 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jodydadescott/home-server/memory"
+	"github.com/jodydadescott/home-server/types"
+)
+
+// editor counts the records it is asked to add or remove
+type editor struct {
+	added   int
+	removed int
+}
+
+func (t *editor) GetRecords() (*DomainRecords, error) {
+	return &DomainRecords{}, nil
+}
+
+func (t *editor) AddRecords(records *DomainRecords) error {
+	t.added += len(records.ARecords)
+	return nil
+}
+
+func (t *editor) RemoveRecords(records *DomainRecords) error {
+	t.removed += len(records.ARecords)
+	return nil
+}
+
+func TestEditRecords(t *testing.T) {
+
+	body := `{"aRecords":[{"hostname":"printer","domain":"home","ip":"192.168.1.5"}]}`
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		origin      string
+		status      int
+	}{
+		{"add", http.MethodPost, "application/json", "", http.StatusNoContent},
+		{"add with charset", http.MethodPost, "application/json; charset=utf-8", "", http.StatusNoContent},
+		{"add from the dashboard", http.MethodPost, "application/json", "http://home-server.home:8080", http.StatusNoContent},
+		{"remove", http.MethodDelete, "application/json", "", http.StatusNoContent},
+		{"form", http.MethodPost, "text/plain", "", http.StatusUnsupportedMediaType},
+		{"no content type", http.MethodPost, "", "", http.StatusUnsupportedMediaType},
+		{"cross-site", http.MethodPost, "application/json", "http://evil.example.com", http.StatusForbidden},
+		{"cross-site remove", http.MethodDelete, "application/json", "http://evil.example.com", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			e := &editor{}
+
+			s := New(&Config{
+				Listener:       &NetPort{IP: "127.0.0.1"},
+				RecordProvider: &fixedRecords{},
+				RecordEditor:   e,
+			})
+
+			r := httptest.NewRequest(test.method, "http://home-server.home:8080/api/records", strings.NewReader(body))
+			if test.contentType != "" {
+				r.Header.Set("Content-Type", test.contentType)
+			}
+			if test.origin != "" {
+				r.Header.Set("Origin", test.origin)
+			}
+
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, r)
+
+			if w.Code != test.status {
+				t.Fatalf("expected %d, got %d: %s", test.status, w.Code, w.Body.String())
+			}
+
+			changed := e.added + e.removed
+			if (test.status == http.StatusNoContent) != (changed == 1) {
+				t.Errorf("expected the records to change only if allowed; added %d, removed %d", e.added, e.removed)
+			}
+		})
+	}
+}
+
+func TestRuntimeRecords(t *testing.T) {
+
+	runtime := memory.New(&types.RuntimeConfig{})
+
+	s := New(&Config{
+		Listener:       &NetPort{IP: "127.0.0.1"},
+		RecordProvider: &fixedRecords{},
+		RecordEditor:   runtime,
+	})
+
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		status   int
+		expected string
+		ip       string
+	}{
+		{
+			name:     "add",
+			method:   http.MethodPost,
+			body:     `{"aRecords":[{"hostname":"printer","ip":"192.168.1.5"}],"cnameRecords":[{"aliasHostname":"print","targetHostname":"printer"}]}`,
+			status:   http.StatusNoContent,
+			expected: "A printer.home, CNAME print.home, PTR printer.home",
+			ip:       "192.168.1.5",
+		},
+		{
+			// A record with the same name replaces the existing record
+			name:     "replace",
+			method:   http.MethodPost,
+			body:     `{"aRecords":[{"hostname":"printer","domain":"home","ip":"192.168.1.6"}]}`,
+			status:   http.StatusNoContent,
+			expected: "A printer.home, CNAME print.home, PTR printer.home",
+			ip:       "192.168.1.6",
+		},
+		{
+			name:     "invalid IP",
+			method:   http.MethodPost,
+			body:     `{"aaaRecords":[{"hostname":"printer","ip":"192.168.1.5"}]}`,
+			status:   http.StatusBadRequest,
+			expected: "A printer.home, CNAME print.home, PTR printer.home",
+			ip:       "192.168.1.6",
+		},
+		{
+			name:     "PTR",
+			method:   http.MethodPost,
+			body:     `{"ptrRecords":[{"arpa":"5.1.168.192.in-addr.arpa.","hostname":"printer"}]}`,
+			status:   http.StatusBadRequest,
+			expected: "A printer.home, CNAME print.home, PTR printer.home",
+			ip:       "192.168.1.6",
+		},
+		{
+			name:     "invalid JSON",
+			method:   http.MethodPost,
+			body:     `{"aRecords":`,
+			status:   http.StatusBadRequest,
+			expected: "A printer.home, CNAME print.home, PTR printer.home",
+			ip:       "192.168.1.6",
+		},
+		{
+			name:     "remove",
+			method:   http.MethodDelete,
+			body:     `{"aRecords":[{"hostname":"printer"}]}`,
+			status:   http.StatusNoContent,
+			expected: "CNAME print.home",
+		},
+	}
+
+	for _, test := range tests {
+
+		r := httptest.NewRequest(test.method, "http://home-server.home:8080/api/records", strings.NewReader(test.body))
+		r.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+
+		if w.Code != test.status {
+			t.Fatalf("%s: expected %d, got %d: %s", test.name, test.status, w.Code, w.Body.String())
+		}
+
+		w = httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://home-server.home:8080/api/records", nil))
+
+		var got DomainRecords
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+
+		if s := recordsString(&got); s != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, s)
+		}
+
+		for _, r := range got.ARecords {
+			if r.IP != test.ip {
+				t.Errorf("%s: expected %s, got %s", test.name, test.ip, r.IP)
+			}
+		}
+	}
+}
@@ -1,22 +1,112 @@
 package http
 
 import (
+	"time"
+
 	"github.com/jinzhu/copier"
 
 	"github.com/jodydadescott/home-server/types"
 )
 
 type DomainRecords = types.DomainRecords
+type ProviderStatus = types.ProviderStatus
+type UpstreamStatus = types.UpstreamStatus
+type QueryLogEntry = types.QueryLogEntry
+type RecordEvent = types.RecordEvent
+type ACLStatus = types.ACLStatus
+type Conflict = types.Conflict
+type NameCollision = types.NameCollision
 
 type Config struct {
-	Listener       *NetPort
-	RecordProvider RecordProvider
+	Listener        *NetPort
+	RecordProvider  RecordProvider
+	StatusProvider  StatusProvider
+	RecordEditor    RecordEditor
+	EventSource     EventSource
+	AuditLog        AuditLog
+	ConflictSource  ConflictSource
+	CollisionSource CollisionSource
+}
+
+// Status is the response for /api/status
+type Status struct {
+	Providers      []*ProviderStatus `json:"providers,omitempty"`
+	Upstreams      []*UpstreamStatus `json:"upstreams,omitempty"`
+	RuntimeEnabled bool              `json:"runtimeEnabled"`
+	ACL            *ACLStatus        `json:"acl,omitempty"`
+}
+
+// Sensor is the response for /api/sensor. It is meant to be polled by the
+// RESTful sensor of Home Assistant. NewDevices is the number of A and AAAA
+// records added since the server started and RecentNewDevices are the most
+// recent of them.
+type Sensor struct {
+	Records          int          `json:"records"`
+	ARecords         int          `json:"aRecords"`
+	AAAARecords      int          `json:"aaaaRecords"`
+	PTRRecords       int          `json:"ptrRecords"`
+	CNameRecords     int          `json:"cnameRecords"`
+	SRVRecords       int          `json:"srvRecords"`
+	TXTRecords       int          `json:"txtRecords"`
+	Providers        int          `json:"providers"`
+	FailingProviders int          `json:"failingProviders"`
+	NewDevices       int          `json:"newDevices"`
+	LastNewDevice    *NewDevice   `json:"lastNewDevice"`
+	RecentNewDevices []*NewDevice `json:"recentNewDevices"`
+}
+
+// NewDevice is an A or AAAA record that was added
+type NewDevice struct {
+	Name     string    `json:"name"`
+	IP       string    `json:"ip"`
+	Provider string    `json:"provider,omitempty"`
+	Time     time.Time `json:"time"`
 }
 
 type RecordProvider interface {
 	GetRecords() *DomainRecords
 }
 
+// StatusProvider is optional and provides the provider, upstream and query
+// log status shown on the dashboard
+type StatusProvider interface {
+	GetProviderStatus() []*ProviderStatus
+	GetUpstreamStatus() []*UpstreamStatus
+	GetQueryLog() []*QueryLogEntry
+	GetACLStatus() *ACLStatus
+}
+
+// EventSource is optional and provides the record change events streamed to
+// clients
+type EventSource interface {
+	Subscribe() (<-chan *RecordEvent, func())
+}
+
+// AuditLog is optional and provides the history of record events
+type AuditLog interface {
+	Query(since, until time.Time, hostname string, limit int) ([]*RecordEvent, error)
+}
+
+// ConflictSource is optional and provides the names that more than one
+// provider has records for
+type ConflictSource interface {
+	GetConflicts() []*Conflict
+}
+
+// CollisionSource is optional and provides the names that more than one
+// client of a provider had and the names they were given
+type CollisionSource interface {
+	GetCollisions() []*NameCollision
+}
+
+// RecordEditor is optional and allows records to be added and removed at
+// runtime
+type RecordEditor interface {
+	GetRecords() (*DomainRecords, error)
+	AddRecords(records *DomainRecords) error
+	RemoveRecords(records *DomainRecords) error
+}
+
 // Clone return copy
 func (t *Config) Clone() *Config {
 	c := &Config{}
@@ -0,0 +1,257 @@
+"use strict";
+
+const refreshInterval = 5000;
+
+let records = [];
+
+function el(tag, text, className) {
+  const e = document.createElement(tag);
+  if (text !== undefined && text !== null) {
+    e.textContent = text;
+  }
+  if (className) {
+    e.className = className;
+  }
+  return e;
+}
+
+function row(...cells) {
+  const tr = el("tr");
+  for (const cell of cells) {
+    const td = el("td");
+    if (cell instanceof Node) {
+      td.appendChild(cell);
+    } else {
+      td.textContent = cell === undefined || cell === null ? "" : cell;
+    }
+    tr.appendChild(td);
+  }
+  return tr;
+}
+
+function formatTime(t) {
+  if (!t || t.startsWith("0001-")) {
+    return "never";
+  }
+  return new Date(t).toLocaleString();
+}
+
+async function getJSON(url) {
+  const resp = await fetch(url, { headers: { Accept: "application/json" } });
+  if (!resp.ok) {
+    throw new Error(await resp.text());
+  }
+  return resp.json();
+}
+
+// flatten converts DomainRecords into a list of rows
+function flatten(domainRecords) {
+  const result = [];
+  for (const r of domainRecords.aRecords || []) {
+    result.push({ type: "A", name: r.hostname, domain: r.domain, value: r.ip, src: r.src, stale: r.stale, lastSeen: r.lastSeen });
+  }
+  for (const r of domainRecords.aaaRecords || []) {
+    result.push({ type: "AAAA", name: r.hostname, domain: r.domain, value: r.ip, src: r.src, stale: r.stale, lastSeen: r.lastSeen });
+  }
+  for (const r of domainRecords.cnameRecords || []) {
+    result.push({ type: "CNAME", name: r.aliasHostname, domain: r.aliasDomain, value: r.targetHostname + "." + r.targetDomain, src: r.src });
+  }
+  for (const r of domainRecords.ptrRecords || []) {
+    result.push({ type: "PTR", name: r.arpa, domain: r.domain, value: r.hostname + "." + r.domain, src: r.src, stale: r.stale, lastSeen: r.lastSeen });
+  }
+  for (const r of domainRecords.srvRecords || []) {
+    result.push({ type: "SRV", name: r.name, domain: r.domain, value: (r.port || 0) + " " + r.targetHostname + "." + r.targetDomain, src: r.src });
+  }
+  for (const r of domainRecords.txtRecords || []) {
+    result.push({ type: "TXT", name: r.name, domain: r.domain, value: (r.text || []).join(" "), src: r.src });
+  }
+  return result;
+}
+
+function renderRecords() {
+  const search = document.getElementById("search").value.toLowerCase();
+  const container = document.getElementById("records");
+  container.replaceChildren();
+
+  const groups = new Map();
+  for (const r of records) {
+    if (r.type === "PTR" && !search) {
+      continue;
+    }
+    const text = [r.name, r.domain, r.value, r.src].join(" ").toLowerCase();
+    if (search && !text.includes(search)) {
+      continue;
+    }
+    const key = (r.domain || "") + " / " + (r.src || "unknown");
+    if (!groups.has(key)) {
+      groups.set(key, []);
+    }
+    groups.get(key).push(r);
+  }
+
+  const keys = [...groups.keys()].sort();
+  if (keys.length === 0) {
+    container.appendChild(el("p", "No matching records"));
+    return;
+  }
+
+  for (const key of keys) {
+    container.appendChild(el("h3", key));
+    const table = el("table");
+    const tbody = el("tbody");
+    const rows = groups.get(key).sort((a, b) => a.name.localeCompare(b.name));
+    for (const r of rows) {
+      const seen = r.stale ? el("span", "stale; last seen " + formatTime(r.lastSeen), "error") : "";
+      tbody.appendChild(row(r.type, r.name, r.value, seen));
+    }
+    table.appendChild(tbody);
+    container.appendChild(table);
+  }
+}
+
+async function loadRecords() {
+  try {
+    records = flatten(await getJSON("getdevices"));
+    renderRecords();
+  } catch (e) {
+    console.error(e);
+  }
+}
+
+async function loadStatus() {
+  let status;
+  try {
+    status = await getJSON("api/status");
+  } catch (e) {
+    console.error(e);
+    return;
+  }
+
+  const providers = document.getElementById("providers");
+  providers.replaceChildren();
+  for (const p of status.providers || []) {
+    const state = p.lastError ? el("span", p.lastError, "error") : el("span", "ok", "ok");
+    providers.appendChild(row(p.name, p.domain, p.refresh || "on change", p.records, formatTime(p.lastRefresh), state));
+  }
+
+  const upstreams = document.getElementById("upstreams");
+  upstreams.replaceChildren();
+  for (const u of status.upstreams || []) {
+    const health = u.healthy ? el("span", "healthy", "ok") : el("span", "failing (" + u.failures + "): " + (u.lastError || ""), "error");
+    upstreams.appendChild(row(u.nameserver, u.proto, u.view, health, formatTime(u.lastSuccess), formatTime(u.lastFailure)));
+  }
+
+  const acl = document.getElementById("acl");
+  acl.hidden = !status.acl;
+  if (status.acl) {
+    const a = status.acl;
+    document.getElementById("acl-status").replaceChildren(row(a.denied, a.localDenied, a.recursionDenied, formatTime(a.lastDenied), a.lastClient));
+  }
+
+  const runtime = document.getElementById("runtime");
+  if (status.runtimeEnabled && runtime.hidden) {
+    runtime.hidden = false;
+    loadRuntimeRecords();
+  }
+}
+
+async function loadQueryLog() {
+  let entries;
+  try {
+    entries = await getJSON("api/querylog");
+  } catch (e) {
+    console.error(e);
+    return;
+  }
+
+  const tbody = document.getElementById("querylog");
+  tbody.replaceChildren();
+  for (const q of entries || []) {
+    tbody.appendChild(row(formatTime(q.time), q.client, q.view, q.name, q.type, q.rcode, q.source, (q.answer || []).join("\n")));
+  }
+}
+
+async function editRuntimeRecords(method, body) {
+  const error = document.getElementById("runtime-error");
+  error.textContent = "";
+  const resp = await fetch("api/records", {
+    method: method,
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(body),
+  });
+  if (!resp.ok) {
+    error.textContent = await resp.text();
+    return false;
+  }
+  loadRuntimeRecords();
+  loadRecords();
+  return true;
+}
+
+async function loadRuntimeRecords() {
+  let runtimeRecords;
+  try {
+    runtimeRecords = await getJSON("api/records");
+  } catch (e) {
+    console.error(e);
+    return;
+  }
+
+  const tbody = document.getElementById("runtime-records");
+  tbody.replaceChildren();
+
+  const add = (type, name, value, body) => {
+    const button = el("button", "Remove");
+    button.onclick = () => editRuntimeRecords("DELETE", body);
+    tbody.appendChild(row(type, name, value, button));
+  };
+
+  for (const r of runtimeRecords.aRecords || []) {
+    add("A", r.hostname + "." + r.domain, r.ip, { aRecords: [r] });
+  }
+  for (const r of runtimeRecords.aaaRecords || []) {
+    add("AAAA", r.hostname + "." + r.domain, r.ip, { aaaRecords: [r] });
+  }
+  for (const r of runtimeRecords.cnameRecords || []) {
+    add("CNAME", r.aliasHostname + "." + r.aliasDomain, r.targetHostname + "." + r.targetDomain, { cnameRecords: [r] });
+  }
+}
+
+document.getElementById("add-address").onsubmit = async (e) => {
+  e.preventDefault();
+  const form = e.target;
+  const record = { hostname: form.hostname.value, ip: form.ip.value, domain: form.domain.value };
+  const body = record.ip.includes(":") ? { aaaRecords: [record] } : { aRecords: [record] };
+  if (await editRuntimeRecords("POST", body)) {
+    form.reset();
+  }
+};
+
+document.getElementById("add-cname").onsubmit = async (e) => {
+  e.preventDefault();
+  const form = e.target;
+  const record = {
+    aliasHostname: form.aliasHostname.value,
+    targetHostname: form.targetHostname.value,
+    targetDomain: form.targetDomain.value,
+  };
+  if (await editRuntimeRecords("POST", { cnameRecords: [record] })) {
+    form.reset();
+  }
+};
+
+document.getElementById("search").oninput = renderRecords;
+
+loadRecords();
+loadStatus();
+loadQueryLog();
+
+// Reload the records as soon as a provider reports a change
+const events = new EventSource("api/events");
+for (const action of ["added", "removed", "changed"]) {
+  events.addEventListener(action, loadRecords);
+}
+
+setInterval(loadStatus, refreshInterval);
+setInterval(loadQueryLog, refreshInterval);
+setInterval(loadRecords, refreshInterval * 6);
@@ -0,0 +1,167 @@
+package lease
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jodydadescott/home-server/types"
+	"github.com/jodydadescott/home-server/util"
+)
+
+type Config = types.LeaseConfig
+type LeaseFile = types.LeaseFile
+type ARecord = types.ARecord
+type PTRrecord = types.PTRrecord
+type Records = types.DomainRecords
+
+const (
+	source = "lease"
+
+	defaultRefresh = time.Minute
+)
+
+// Client is a provider for the leases in a DHCP server lease file
+type Client struct {
+	path     string
+	format   string
+	domain   string
+	refresh  time.Duration
+	priority int
+}
+
+func New(config *Config) []*Client {
+
+	if config == nil {
+		panic("config is required")
+	}
+
+	config = config.Clone()
+
+	var clients []*Client
+
+	for _, file := range config.Files {
+
+		if file.Path == "" {
+			panic("lease file path is required")
+		}
+
+		switch file.Format {
+		case FormatDhcpd, FormatDnsmasq, FormatKea:
+		default:
+			panic(fmt.Sprintf("lease file %s format %s is invalid", file.Path, file.Format))
+		}
+
+		client := &Client{
+			path:     file.Path,
+			format:   file.Format,
+			domain:   types.DefaultDomain,
+			refresh:  defaultRefresh,
+			priority: config.Priority,
+		}
+
+		if file.Domain != "" {
+			client.domain = file.Domain
+		}
+
+		if file.Refresh > 0 {
+			client.refresh = file.Refresh
+		}
+
+		clients = append(clients, client)
+	}
+
+	return clients
+}
+
+func (t *Client) GetName() string {
+	return source + ":" + t.format + ":" + t.path
+}
+
+func (t *Client) GetDomainName() string {
+	return t.domain
+}
+
+// GetRefreshDuration returns the interval at which expired leases are removed
+func (t *Client) GetRefreshDuration() time.Duration {
+	return t.refresh
+}
+
+// GetPriority implements dns.Prioritized
+func (t *Client) GetPriority() int {
+	return t.priority
+}
+
+// Watch implements dns.Watcher
+func (t *Client) Watch(done <-chan struct{}, changed func()) {
+	util.WatchFiles(done, []string{t.path}, changed)
+}
+
+func (t *Client) GetRecords() (*Records, error) {
+
+	f, err := os.Open(t.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	leases, err := Parse(t.format, f)
+	if err != nil {
+		return nil, fmt.Errorf("lease file %s: %s", t.path, err.Error())
+	}
+
+	return t.getRecords(leases, time.Now()), nil
+}
+
+// getRecords returns the A or AAAA and PTR records for the leases that have a
+// hostname and have not expired
+func (t *Client) getRecords(leases []*Lease, now time.Time) *Records {
+
+	records := &Records{}
+	src := source + ":" + t.format
+
+	for _, lease := range leases {
+
+		if lease.Hostname == "" {
+			zap.L().Debug(fmt.Sprintf("Lease with MAC=%s and IP=%s does not have a hostname", lease.MAC, lease.IP))
+			continue
+		}
+
+		if lease.Expired(now) {
+			zap.L().Debug(fmt.Sprintf("Lease for %s with IP=%s expired at %s", lease.Hostname, lease.IP, lease.Expires.String()))
+			continue
+		}
+
+		arpa, err := util.GetARPA(lease.IP)
+		if err != nil {
+			zap.L().Debug(fmt.Sprintf("Lease for %s has an invalid IP; error %s", lease.Hostname, err.Error()))
+			continue
+		}
+
+		a := &ARecord{
+			Hostname: lease.Hostname,
+			Domain:   t.domain,
+			IP:       lease.IP,
+			MAC:      lease.MAC,
+			SRC:      src,
+		}
+
+		if net.ParseIP(lease.IP).To4() != nil {
+			records.AddARecords(a)
+		} else {
+			records.AddAAAARecords(a)
+		}
+
+		records.AddPtrRecords(&PTRrecord{
+			ARPA:     arpa,
+			Hostname: lease.Hostname,
+			Domain:   t.domain,
+			SRC:      src,
+		})
+	}
+
+	return records
+}
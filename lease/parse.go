@@ -0,0 +1,325 @@
+package lease
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatDhcpd   = "dhcpd"
+	FormatDnsmasq = "dnsmasq"
+	FormatKea     = "kea"
+
+	// keaInfinite is the Kea valid_lifetime for a lease that does not expire
+	keaInfinite = 4294967295
+)
+
+// Lease is a DHCP lease. Expires is zero if the lease does not expire.
+type Lease struct {
+	IP       string
+	MAC      string
+	Hostname string
+	Expires  time.Time
+}
+
+// Expired returns true if the lease expired before now
+func (t *Lease) Expired(now time.Time) bool {
+	return !t.Expires.IsZero() && t.Expires.Before(now)
+}
+
+// Parse returns the leases from the reader in the specified format
+func Parse(format string, r io.Reader) ([]*Lease, error) {
+
+	switch format {
+
+	case FormatDhcpd:
+		return ParseDhcpd(r)
+
+	case FormatDnsmasq:
+		return ParseDnsmasq(r)
+
+	case FormatKea:
+		return ParseKea(r)
+
+	}
+
+	return nil, fmt.Errorf("format %s is invalid", format)
+}
+
+// cleanName returns the first label of the name in lowercase or an empty string
+// if the name is not usable
+func cleanName(name string) string {
+	name = strings.ToLower(strings.Trim(name, "\". "))
+	name = strings.Split(name, ".")[0]
+	if name == "*" {
+		return ""
+	}
+	return name
+}
+
+// ParseDhcpd parses an ISC dhcpd.leases file. Only IPv4 leases in the active
+// binding state are returned. When an address appears more than once the last
+// entry wins as dhcpd appends updates to the end of the file.
+func ParseDhcpd(r io.Reader) ([]*Lease, error) {
+
+	leases := make(map[string]*Lease)
+	var order []string
+
+	var current *Lease
+	active := true
+	line := 0
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+
+		line++
+		text := strings.TrimSpace(scanner.Text())
+
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if current == nil {
+			fields := strings.Fields(text)
+			if len(fields) >= 3 && fields[0] == "lease" && fields[2] == "{" {
+				if net.ParseIP(fields[1]) == nil {
+					return nil, fmt.Errorf("line %d: lease IP %s is invalid", line, fields[1])
+				}
+				current = &Lease{IP: fields[1]}
+				active = true
+			}
+			continue
+		}
+
+		if text == "}" {
+			if active {
+				if _, exist := leases[current.IP]; !exist {
+					order = append(order, current.IP)
+				}
+				leases[current.IP] = current
+			} else {
+				delete(leases, current.IP)
+			}
+			current = nil
+			continue
+		}
+
+		text = strings.TrimSuffix(strings.SplitN(text, ";", 2)[0], ";")
+		fields := strings.Fields(text)
+
+		switch {
+
+		case len(fields) >= 3 && fields[0] == "binding" && fields[1] == "state":
+			active = fields[2] == "active"
+
+		case len(fields) >= 3 && fields[0] == "hardware" && fields[1] == "ethernet":
+			current.MAC = strings.ToLower(fields[2])
+
+		case len(fields) >= 2 && fields[0] == "client-hostname":
+			current.Hostname = cleanName(strings.Join(fields[1:], " "))
+
+		case len(fields) >= 2 && fields[0] == "ends":
+			expires, err := parseDhcpdTime(fields[1:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err.Error())
+			}
+			current.Expires = expires
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var result []*Lease
+	for _, ip := range order {
+		if lease, exist := leases[ip]; exist {
+			result = append(result, lease)
+			delete(leases, ip)
+		}
+	}
+
+	return result, nil
+}
+
+// parseDhcpdTime parses the value of a dhcpd time statement. It is one of
+// "never", "epoch <seconds>" or "<weekday> <yyyy/mm/dd> <hh:mm:ss>" in UTC.
+func parseDhcpdTime(fields []string) (time.Time, error) {
+
+	switch {
+
+	case fields[0] == "never":
+		return time.Time{}, nil
+
+	case fields[0] == "epoch" && len(fields) >= 2:
+		seconds, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("time %s is invalid", strings.Join(fields, " "))
+		}
+		return time.Unix(seconds, 0), nil
+
+	case len(fields) >= 3:
+		t, err := time.Parse("2006/01/02 15:04:05", fields[1]+" "+fields[2])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("time %s is invalid", strings.Join(fields, " "))
+		}
+		return t, nil
+
+	}
+
+	return time.Time{}, fmt.Errorf("time %s is invalid", strings.Join(fields, " "))
+}
+
+// ParseDnsmasq parses a dnsmasq.leases file. IPv4 lines are "expiry mac ip
+// hostname client-id". IPv6 lines follow a "duid" line and have the IAID in
+// place of the MAC. An expiry of 0 means the lease does not expire and a
+// hostname of * means the client did not send one.
+func ParseDnsmasq(r io.Reader) ([]*Lease, error) {
+
+	var leases []*Lease
+	line := 0
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+
+		line++
+		fields := strings.Fields(scanner.Text())
+
+		if len(fields) == 0 || fields[0] == "duid" {
+			continue
+		}
+
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("line %d: expected at least 4 fields", line)
+		}
+
+		seconds, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: expiry %s is invalid", line, fields[0])
+		}
+
+		ip := net.ParseIP(fields[2])
+		if ip == nil {
+			return nil, fmt.Errorf("line %d: IP %s is invalid", line, fields[2])
+		}
+
+		lease := &Lease{
+			IP:       fields[2],
+			Hostname: cleanName(fields[3]),
+		}
+
+		if ip.To4() != nil {
+			lease.MAC = strings.ToLower(fields[1])
+		}
+
+		if seconds > 0 {
+			lease.Expires = time.Unix(seconds, 0)
+		}
+
+		leases = append(leases, lease)
+	}
+
+	return leases, scanner.Err()
+}
+
+// ParseKea parses a Kea memfile lease CSV for either IPv4 or IPv6. Columns are
+// found by the header so both layouts are supported. Only leases in the
+// default (0) state are returned and when an address appears more than once
+// the last entry wins.
+func ParseKea(r io.Reader) ([]*Lease, error) {
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+
+	header, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+
+	for _, required := range []string{"address", "expire", "hostname"} {
+		if _, exist := columns[required]; !exist {
+			return nil, fmt.Errorf("header is missing column %s", required)
+		}
+	}
+
+	get := func(record []string, name string) string {
+		i, exist := columns[name]
+		if !exist || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	leases := make(map[string]*Lease)
+	var order []string
+	line := 1
+
+	for {
+
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line++
+
+		address := get(record, "address")
+		if net.ParseIP(address) == nil {
+			return nil, fmt.Errorf("line %d: address %s is invalid", line, address)
+		}
+
+		if state := get(record, "state"); state != "" && state != "0" {
+			delete(leases, address)
+			continue
+		}
+
+		lease := &Lease{
+			IP:       address,
+			MAC:      strings.ToLower(get(record, "hwaddr")),
+			Hostname: cleanName(get(record, "hostname")),
+		}
+
+		if get(record, "valid_lifetime") != strconv.Itoa(keaInfinite) {
+			seconds, err := strconv.ParseInt(get(record, "expire"), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: expire %s is invalid", line, get(record, "expire"))
+			}
+			lease.Expires = time.Unix(seconds, 0)
+		}
+
+		if _, exist := leases[address]; !exist {
+			order = append(order, address)
+		}
+		leases[address] = lease
+	}
+
+	var result []*Lease
+	for _, address := range order {
+		if lease, exist := leases[address]; exist {
+			result = append(result, lease)
+			delete(leases, address)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,144 @@
+package lease
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+
+	expires := time.Unix(1697572800, 0)
+
+	tests := []struct {
+		format string
+		file   string
+		leases []*Lease
+	}{
+		{
+			// The renewal of .20 replaces it, .22 is free and .24 was released
+			format: FormatDhcpd,
+			file:   "dhcpd.leases",
+			leases: []*Lease{
+				{IP: "192.168.1.20", MAC: "3c:22:fb:11:22:33", Hostname: "jodys-iphone", Expires: time.Date(2023, 10, 17, 22, 0, 0, 0, time.UTC)},
+				{IP: "192.168.1.21", MAC: "00:11:32:aa:bb:cc", Hostname: "nas"},
+				{IP: "192.168.1.23", MAC: "b8:27:eb:01:02:03", Expires: expires},
+			},
+		},
+		{
+			// An expiry of 0 does not expire, * is no hostname and the IPv6
+			// lease has an IAID instead of a MAC
+			format: FormatDnsmasq,
+			file:   "dnsmasq.leases",
+			leases: []*Lease{
+				{IP: "192.168.1.20", MAC: "3c:22:fb:11:22:33", Hostname: "jodys-iphone", Expires: expires},
+				{IP: "192.168.1.21", MAC: "00:11:32:aa:bb:cc", Hostname: "nas"},
+				{IP: "192.168.1.23", MAC: "b8:27:eb:01:02:03", Expires: time.Unix(1697500000, 0)},
+				{IP: "192.168.1.22", MAC: "00:11:22:33:44:55", Hostname: "old-laptop", Expires: time.Unix(1697500000, 0)},
+				{IP: "2001:db8:0:1::20", Hostname: "jodys-iphone", Expires: expires},
+			},
+		},
+		{
+			// .22 was reclaimed and .26 was declined after it was leased
+			format: FormatKea,
+			file:   "kea-leases4.csv",
+			leases: []*Lease{
+				{IP: "192.168.1.20", MAC: "3c:22:fb:11:22:33", Hostname: "jodys-iphone", Expires: expires},
+				{IP: "192.168.1.21", MAC: "00:11:32:aa:bb:cc", Hostname: "nas"},
+				{IP: "192.168.1.25", MAC: "aa:bb:cc:dd:ee:ff", Expires: expires},
+			},
+		},
+		{
+			format: FormatKea,
+			file:   "kea-leases6.csv",
+			leases: []*Lease{
+				{IP: "2001:db8:0:1::20", MAC: "3c:22:fb:11:22:33", Hostname: "jodys-iphone", Expires: expires},
+				{IP: "2001:db8:0:1::21", Hostname: "nas", Expires: time.Unix(1697500000, 0)},
+			},
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.file, func(t *testing.T) {
+
+			f, err := os.Open("testdata/" + test.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			leases, err := Parse(test.format, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(leases) != len(test.leases) {
+				t.Fatalf("expected %d leases, got %d", len(test.leases), len(leases))
+			}
+
+			for i, expected := range test.leases {
+				got := leases[i]
+				if got.IP != expected.IP || got.MAC != expected.MAC || got.Hostname != expected.Hostname || !got.Expires.Equal(expected.Expires) {
+					t.Errorf("lease %d: expected %+v, got %+v", i, expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+
+	tests := []struct {
+		format string
+		text   string
+		err    string
+	}{
+		{FormatDhcpd, "lease 192.168.1.300 {\n}\n", "line 1: lease IP 192.168.1.300 is invalid"},
+		{FormatDhcpd, "lease 192.168.1.20 {\n  ends 2 2023-10-17 20:00:00;\n}\n", "line 2: time 2 2023-10-17 20:00:00 is invalid"},
+		{FormatDnsmasq, "1697572800 3c:22:fb:11:22:33 192.168.1.20\n", "line 1: expected at least 4 fields"},
+		{FormatDnsmasq, "soon 3c:22:fb:11:22:33 192.168.1.20 phone *\n", "line 1: expiry soon is invalid"},
+		{FormatKea, "address,hwaddr,expire\n", "header is missing column hostname"},
+		{FormatKea, "address,expire,hostname\nphone,0,phone\n", "line 2: address phone is invalid"},
+		{"isc", "", "format isc is invalid"},
+	}
+
+	for _, test := range tests {
+		if _, err := Parse(test.format, strings.NewReader(test.text)); err == nil || err.Error() != test.err {
+			t.Errorf("%s: expected error %q, got %v", test.format, test.err, err)
+		}
+	}
+}
+
+func TestGetRecords(t *testing.T) {
+
+	f, err := os.Open("testdata/dnsmasq.leases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	leases, err := ParseDnsmasq(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := New(&Config{Files: []*LeaseFile{{Path: "testdata/dnsmasq.leases", Format: FormatDnsmasq}}})[0]
+
+	// old-laptop has expired and .23 does not have a hostname
+	records := client.getRecords(leases, time.Unix(1697550000, 0))
+
+	var names []string
+	for _, r := range append(records.ARecords, records.AAAARecords...) {
+		names = append(names, r.Hostname+"="+r.IP)
+	}
+
+	if strings.Join(names, " ") != "jodys-iphone=192.168.1.20 nas=192.168.1.21 jodys-iphone=2001:db8:0:1::20" {
+		t.Errorf("unexpected records %v", names)
+	}
+
+	if len(records.PtrRecords) != 3 {
+		t.Errorf("expected 3 PTR records, got %d", len(records.PtrRecords))
+	}
+}
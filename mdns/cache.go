@@ -0,0 +1,106 @@
+package mdns
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+type entry struct {
+	rr      dns.RR
+	expires time.Time
+}
+
+// cache holds the records from mDNS responses until their TTL expires
+type cache struct {
+	mutex   sync.Mutex
+	entries map[string]*entry
+}
+
+func newCache() *cache {
+	return &cache{entries: make(map[string]*entry)}
+}
+
+// nameType returns the name and type part of a cache key
+func nameType(rr dns.RR) string {
+	return strings.ToLower(rr.Header().Name) + " " + dns.TypeToString[rr.Header().Rrtype]
+}
+
+// key returns the cache key of the record which is its name, type and data
+func key(rr dns.RR) string {
+	data := strings.TrimPrefix(rr.String(), rr.Header().String())
+	return nameType(rr) + " " + data
+}
+
+// add adds the records of a response and returns true if the cache changed.
+// A record with a TTL of 0 is a goodbye and is removed. A record with the cache
+// flush bit set replaces the records with the same name and type that are not
+// in the same response.
+func (t *cache) add(rrs []dns.RR, now time.Time) bool {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	flush := make(map[string]bool)
+	before := make(map[string]bool)
+
+	for _, rr := range rrs {
+		if rr.Header().Class&cacheFlush != 0 {
+			flush[nameType(rr)] = true
+		}
+	}
+
+	for k, e := range t.entries {
+		before[k] = true
+		if flush[nameType(e.rr)] {
+			delete(t.entries, k)
+		}
+	}
+
+	for _, rr := range rrs {
+
+		ttl := rr.Header().Ttl
+		rr = normalize(rr)
+		k := key(rr)
+
+		if ttl == 0 {
+			delete(t.entries, k)
+			continue
+		}
+
+		t.entries[k] = &entry{rr: rr, expires: now.Add(time.Duration(ttl) * time.Second)}
+	}
+
+	if len(before) != len(t.entries) {
+		return true
+	}
+
+	for k := range t.entries {
+		if !before[k] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// get returns the records that have not expired and removes the others
+func (t *cache) get(now time.Time) []dns.RR {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var rrs []dns.RR
+
+	for k, e := range t.entries {
+		if e.expires.Before(now) {
+			delete(t.entries, k)
+			continue
+		}
+		rrs = append(rrs, e.rr)
+	}
+
+	return rrs
+}
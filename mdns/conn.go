@@ -0,0 +1,296 @@
+package mdns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Port is the mDNS port
+	Port = 5353
+
+	// cacheFlush is the top bit of the class of a record in an mDNS response.
+	// It is set when the record replaces all others with the same name and
+	// type.
+	cacheFlush = 0x8000
+
+	// unicastResponse is the top bit of the class of a question. It is set
+	// when the querier wants a unicast response.
+	unicastResponse = 0x8000
+
+	maxPacketSize = 9000
+)
+
+var (
+	groupV4 = net.IPv4(224, 0, 0, 251)
+	groupV6 = net.ParseIP("ff02::fb")
+)
+
+// packet is a message received on an interface
+type packet struct {
+	msg     *dns.Msg
+	from    *net.UDPAddr
+	ifIndex int
+}
+
+// conn is an mDNS socket for IPv4 and optionally IPv6 that has joined the mDNS
+// group on each of its interfaces
+type conn struct {
+	mutex  sync.Mutex
+	port   int
+	ifaces []net.Interface
+	v4     *ipv4.PacketConn
+	v6     *ipv6.PacketConn
+}
+
+// getInterfaces returns the interfaces with the names or, if there are none,
+// every interface that is up, supports multicast and is not a loopback
+func getInterfaces(names []string) ([]net.Interface, error) {
+
+	if len(names) > 0 {
+		var ifaces []net.Interface
+		for _, name := range names {
+			ifi, err := net.InterfaceByName(name)
+			if err != nil {
+				return nil, fmt.Errorf("interface %s; error %s", name, err.Error())
+			}
+			ifaces = append(ifaces, *ifi)
+		}
+		return ifaces, nil
+	}
+
+	all, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var ifaces []net.Interface
+	for _, ifi := range all {
+		if ifi.Flags&net.FlagUp == 0 || ifi.Flags&net.FlagMulticast == 0 || ifi.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		ifaces = append(ifaces, ifi)
+	}
+
+	if len(ifaces) == 0 {
+		return nil, fmt.Errorf("no multicast interfaces found")
+	}
+
+	return ifaces, nil
+}
+
+// reuse allows other mDNS implementations on the host to bind the port too
+func reuse(network, address string, c syscall.RawConn) error {
+	var err error
+	c.Control(func(fd uintptr) {
+		err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+		if err == nil {
+			err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+		}
+	})
+	return err
+}
+
+// listen returns a conn on the port that has joined the mDNS group on each of
+// the interfaces. The port is a parameter so a test can use another one. If it
+// is 0 an ephemeral port is used.
+func listen(ifaces []net.Interface, useIPv6 bool, port int) (*conn, error) {
+
+	lc := net.ListenConfig{Control: reuse}
+
+	pc4, err := lc.ListenPacket(context.Background(), "udp4", "0.0.0.0:"+strconv.Itoa(port))
+	if err != nil {
+		return nil, err
+	}
+
+	if port == 0 {
+		port = pc4.LocalAddr().(*net.UDPAddr).Port
+	}
+
+	c := &conn{port: port, ifaces: ifaces, v4: ipv4.NewPacketConn(pc4)}
+
+	joined := 0
+	for i := range ifaces {
+		if err := c.v4.JoinGroup(&ifaces[i], &net.UDPAddr{IP: groupV4}); err != nil {
+			zap.L().Debug(fmt.Sprintf("Unable to join mDNS group on %s; error %s", ifaces[i].Name, err.Error()))
+			continue
+		}
+		joined++
+	}
+
+	if joined == 0 {
+		c.close()
+		return nil, fmt.Errorf("unable to join the mDNS group on any interface")
+	}
+
+	c.v4.SetControlMessage(ipv4.FlagInterface, true)
+	c.v4.SetMulticastTTL(255)
+	c.v4.SetMulticastLoopback(true)
+
+	if !useIPv6 {
+		return c, nil
+	}
+
+	pc6, err := lc.ListenPacket(context.Background(), "udp6", "[::]:"+strconv.Itoa(port))
+	if err != nil {
+		zap.L().Debug(fmt.Sprintf("Unable to listen for IPv6 mDNS; error %s", err.Error()))
+		return c, nil
+	}
+
+	c.v6 = ipv6.NewPacketConn(pc6)
+
+	for i := range ifaces {
+		if err := c.v6.JoinGroup(&ifaces[i], &net.UDPAddr{IP: groupV6}); err != nil {
+			zap.L().Debug(fmt.Sprintf("Unable to join IPv6 mDNS group on %s; error %s", ifaces[i].Name, err.Error()))
+		}
+	}
+
+	c.v6.SetControlMessage(ipv6.FlagInterface, true)
+	c.v6.SetMulticastHopLimit(255)
+	c.v6.SetMulticastLoopback(true)
+
+	return c, nil
+}
+
+// hasInterface returns true if the packet arrived on one of the interfaces of
+// the conn. The other interfaces of the host may deliver to the socket too.
+func (t *conn) hasInterface(ifIndex int) bool {
+	for _, ifi := range t.ifaces {
+		if ifi.Index == ifIndex {
+			return true
+		}
+	}
+	return false
+}
+
+// read calls handler with each valid message until the conn is closed
+func (t *conn) read(handler func(*packet)) {
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		buf := make([]byte, maxPacketSize)
+		for {
+			n, cm, from, err := t.v4.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			ifIndex := 0
+			if cm != nil {
+				ifIndex = cm.IfIndex
+			}
+			t.handle(buf[:n], from, ifIndex, handler)
+		}
+	}()
+
+	if t.v6 != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, maxPacketSize)
+			for {
+				n, cm, from, err := t.v6.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				ifIndex := 0
+				if cm != nil {
+					ifIndex = cm.IfIndex
+				}
+				t.handle(buf[:n], from, ifIndex, handler)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (t *conn) handle(buf []byte, from net.Addr, ifIndex int, handler func(*packet)) {
+
+	if ifIndex != 0 && !t.hasInterface(ifIndex) {
+		return
+	}
+
+	msg := new(dns.Msg)
+	if err := msg.Unpack(buf); err != nil {
+		zap.L().Debug(fmt.Sprintf("Invalid mDNS message from %s; error %s", from.String(), err.Error()))
+		return
+	}
+
+	addr, _ := from.(*net.UDPAddr)
+	handler(&packet{msg: msg, from: addr, ifIndex: ifIndex})
+}
+
+// send multicasts the message on the interface with the index or on every
+// interface if the index is 0
+func (t *conn) send(msg *dns.Msg, ifIndex int) error {
+
+	buf, err := msg.Pack()
+	if err != nil {
+		return err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for i := range t.ifaces {
+
+		ifi := &t.ifaces[i]
+
+		if ifIndex != 0 && ifi.Index != ifIndex {
+			continue
+		}
+
+		if err := t.v4.SetMulticastInterface(ifi); err == nil {
+			t.v4.WriteTo(buf, nil, &net.UDPAddr{IP: groupV4, Port: t.port})
+		}
+
+		if t.v6 != nil {
+			if err := t.v6.SetMulticastInterface(ifi); err == nil {
+				t.v6.WriteTo(buf, nil, &net.UDPAddr{IP: groupV6, Port: t.port, Zone: ifi.Name})
+			}
+		}
+	}
+
+	return nil
+}
+
+// sendTo sends the message to a single address
+func (t *conn) sendTo(msg *dns.Msg, addr *net.UDPAddr) error {
+
+	buf, err := msg.Pack()
+	if err != nil {
+		return err
+	}
+
+	if addr.IP.To4() != nil {
+		_, err = t.v4.WriteTo(buf, nil, addr)
+		return err
+	}
+
+	if t.v6 == nil {
+		return fmt.Errorf("IPv6 is not enabled")
+	}
+
+	_, err = t.v6.WriteTo(buf, nil, addr)
+	return err
+}
+
+func (t *conn) close() {
+	t.v4.Close()
+	if t.v6 != nil {
+		t.v6.Close()
+	}
+}
@@ -0,0 +1,443 @@
+package mdns
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+
+	"github.com/jodydadescott/home-server/types"
+	"github.com/jodydadescott/home-server/util"
+)
+
+type Config = types.MDNSConfig
+type ARecord = types.ARecord
+type PTRrecord = types.PTRrecord
+type SRVRecord = types.SRVRecord
+type TXTRecord = types.TXTRecord
+type Records = types.DomainRecords
+
+const (
+	source = "mdns"
+
+	localDomain = "local."
+
+	// metaQuery is the DNS-SD name that lists the service types on the link
+	metaQuery = "_services._dns-sd._udp.local."
+
+	defaultInterval = time.Minute
+
+	// cacheRefresh is how often expired records are removed
+	cacheRefresh = time.Second * 30
+
+	// changeDelay collects the responses that arrive together into one refresh
+	changeDelay = time.Second
+)
+
+// Client is a provider that bridges the hosts and services announced over
+// multicast DNS into a unicast domain
+type Client struct {
+	mutex      sync.Mutex
+	domain     string
+	interfaces []string
+	ipv6       bool
+	services   bool
+	browse     []string
+	interval   time.Duration
+	priority   int
+	port       int
+	cache      *cache
+	asked      map[string]bool
+}
+
+func New(config *Config) *Client {
+
+	if config == nil {
+		panic("config is required")
+	}
+
+	config = config.Clone()
+
+	client := &Client{
+		domain:     types.DefaultDomain,
+		interfaces: config.Interfaces,
+		ipv6:       config.IPv6,
+		services:   config.Services,
+		interval:   defaultInterval,
+		priority:   config.Priority,
+		port:       Port,
+		cache:      newCache(),
+		asked:      make(map[string]bool),
+	}
+
+	if config.Domain != "" {
+		client.domain = config.Domain
+	}
+
+	if config.Interval > 0 {
+		client.interval = config.Interval
+	}
+
+	for _, serviceType := range config.Browse {
+		serviceType = strings.TrimSuffix(strings.TrimSuffix(serviceType, "."), "."+strings.TrimSuffix(localDomain, "."))
+		client.browse = append(client.browse, serviceType+"."+localDomain)
+	}
+
+	return client
+}
+
+func (t *Client) GetName() string {
+	return source
+}
+
+func (t *Client) GetDomainName() string {
+	return t.domain
+}
+
+// GetRefreshDuration returns the interval at which expired records are removed
+func (t *Client) GetRefreshDuration() time.Duration {
+	return cacheRefresh
+}
+
+// GetPriority implements dns.Prioritized
+func (t *Client) GetPriority() int {
+	return t.priority
+}
+
+// Watch implements dns.Watcher. It listens for mDNS responses and browses for
+// services until done is closed.
+func (t *Client) Watch(done <-chan struct{}, changed func()) {
+
+	ifaces, err := getInterfaces(t.interfaces)
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("mDNS bridge is not running; error %s", err.Error()))
+		return
+	}
+
+	c, err := listen(ifaces, t.ipv6, t.port)
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("mDNS bridge is not running; error %s", err.Error()))
+		return
+	}
+
+	for _, ifi := range ifaces {
+		zap.L().Info(fmt.Sprintf("mDNS bridge is listening on %s", ifi.Name))
+	}
+
+	dirty := make(chan struct{}, 1)
+
+	go c.read(func(p *packet) {
+		if t.handle(c, p) {
+			select {
+			case dirty <- struct{}{}:
+			default:
+			}
+		}
+	})
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	t.query(c)
+
+	var pending <-chan time.Time
+
+	for {
+		select {
+
+		case <-done:
+			c.close()
+			return
+
+		case <-ticker.C:
+			t.query(c)
+
+		case <-dirty:
+			if pending == nil {
+				pending = time.After(changeDelay)
+			}
+
+		case <-pending:
+			pending = nil
+			changed()
+
+		}
+	}
+}
+
+// query browses for the service types. The names asked about since the last
+// browse are forgotten so they are asked again.
+func (t *Client) query(c *conn) {
+
+	t.mutex.Lock()
+	t.asked = make(map[string]bool)
+	t.mutex.Unlock()
+
+	if len(t.browse) == 0 {
+		t.ask(c, metaQuery, dns.TypePTR)
+		return
+	}
+
+	for _, serviceType := range t.browse {
+		t.ask(c, serviceType, dns.TypePTR)
+	}
+}
+
+// ask sends a query unless the same question was already asked since the last
+// browse
+func (t *Client) ask(c *conn, name string, qtype uint16) {
+
+	question := name + " " + dns.TypeToString[qtype]
+
+	t.mutex.Lock()
+	asked := t.asked[question]
+	t.asked[question] = true
+	t.mutex.Unlock()
+
+	if asked {
+		return
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.Id = 0
+	m.RecursionDesired = false
+
+	if err := c.send(m, 0); err != nil {
+		zap.L().Debug(fmt.Sprintf("mDNS query for %s failed; error %s", question, err.Error()))
+	}
+}
+
+// handle caches the records of a response and asks for the records the
+// response refers to but does not have. It returns true if the cache changed.
+func (t *Client) handle(c *conn, p *packet) bool {
+
+	if !p.msg.Response {
+		return false
+	}
+
+	rrs := append(p.msg.Answer, p.msg.Extra...)
+
+	have := make(map[string]bool)
+	for _, rr := range rrs {
+		have[nameType(rr)] = true
+	}
+
+	for _, rr := range rrs {
+
+		switch v := rr.(type) {
+
+		case *dns.PTR:
+			if strings.EqualFold(v.Hdr.Name, metaQuery) {
+				t.ask(c, v.Ptr, dns.TypePTR)
+				continue
+			}
+			if !have[strings.ToLower(v.Ptr)+" SRV"] {
+				t.ask(c, v.Ptr, dns.TypeSRV)
+			}
+			if t.services && !have[strings.ToLower(v.Ptr)+" TXT"] {
+				t.ask(c, v.Ptr, dns.TypeTXT)
+			}
+
+		case *dns.SRV:
+			if !have[strings.ToLower(v.Target)+" A"] {
+				t.ask(c, v.Target, dns.TypeA)
+			}
+			if t.ipv6 && !have[strings.ToLower(v.Target)+" AAAA"] {
+				t.ask(c, v.Target, dns.TypeAAAA)
+			}
+
+		}
+	}
+
+	return t.cache.add(rrs, time.Now())
+}
+
+func (t *Client) GetRecords() (*Records, error) {
+	return t.getRecords(t.cache.get(time.Now())), nil
+}
+
+// getRecords maps the cached mDNS records into the domain. Hosts get A, AAAA
+// and PTR records and service instances get SRV and TXT records if services
+// are enabled. Link local addresses are not reachable from other links so
+// they are skipped.
+func (t *Client) getRecords(rrs []dns.RR) *Records {
+
+	records := &Records{}
+
+	addA := func(name string, ip net.IP) {
+
+		if ip.IsLinkLocalUnicast() {
+			return
+		}
+
+		hostname, ok := getHostname(name)
+		if !ok {
+			zap.L().Debug(fmt.Sprintf("mDNS name %s is not a host in the local domain", name))
+			return
+		}
+
+		a := &ARecord{
+			Hostname: hostname,
+			Domain:   t.domain,
+			IP:       ip.String(),
+			SRC:      source + ":host",
+		}
+
+		if ip.To4() != nil {
+			records.AddARecords(a)
+		} else {
+			records.AddAAAARecords(a)
+		}
+
+		arpa, err := util.GetARPA(ip.String())
+		if err != nil {
+			zap.L().Debug(fmt.Sprintf("mDNS host %s has an invalid IP; error %s", hostname, err.Error()))
+			return
+		}
+
+		records.AddPtrRecords(&PTRrecord{
+			ARPA:     arpa,
+			Hostname: hostname,
+			Domain:   t.domain,
+			SRC:      source + ":host",
+		})
+	}
+
+	for _, rr := range rrs {
+
+		switch v := rr.(type) {
+
+		case *dns.A:
+			addA(v.Hdr.Name, v.A)
+
+		case *dns.AAAA:
+			if t.ipv6 {
+				addA(v.Hdr.Name, v.AAAA)
+			}
+
+		case *dns.SRV:
+			if !t.services {
+				continue
+			}
+			name, ok := getInstance(v.Hdr.Name)
+			if !ok {
+				continue
+			}
+			target, ok := getHostname(v.Target)
+			if !ok {
+				continue
+			}
+			records.AddSrvRecords(&SRVRecord{
+				Name:           name,
+				Domain:         t.domain,
+				TargetHostname: target,
+				TargetDomain:   t.domain,
+				Port:           v.Port,
+				Priority:       v.Priority,
+				Weight:         v.Weight,
+				SRC:            source + ":service",
+			})
+
+		case *dns.TXT:
+			if !t.services {
+				continue
+			}
+			name, ok := getInstance(v.Hdr.Name)
+			if !ok {
+				continue
+			}
+			if len(v.Txt) == 0 || (len(v.Txt) == 1 && v.Txt[0] == "") {
+				continue
+			}
+			records.AddTxtRecords(&TXTRecord{
+				Name:   name,
+				Domain: t.domain,
+				Text:   v.Txt,
+				SRC:    source + ":service",
+			})
+
+		}
+	}
+
+	return records
+}
+
+// getLabels returns the unescaped labels of a name in the local domain
+func getLabels(name string) ([]string, bool) {
+
+	name = strings.ToLower(dns.Fqdn(name))
+
+	if !strings.HasSuffix(name, "."+localDomain) {
+		return nil, false
+	}
+
+	var labels []string
+	for _, label := range dns.SplitDomainName(strings.TrimSuffix(name, localDomain)) {
+		labels = append(labels, unescape(label))
+	}
+
+	return labels, len(labels) > 0
+}
+
+// getHostname returns the hostname for a name such as printer.local
+func getHostname(name string) (string, bool) {
+
+	labels, ok := getLabels(name)
+	if !ok || len(labels) != 1 {
+		return "", false
+	}
+
+	hostname := util.ToLabel(labels[0])
+	return hostname, hostname != ""
+}
+
+// getInstance returns the name relative to the local domain for a service
+// instance such as "Office Printer._ipp._tcp.local". The instance label may
+// have any characters so it is cleaned up to be a valid hostname label.
+func getInstance(name string) (string, bool) {
+
+	labels, ok := getLabels(name)
+	if !ok || len(labels) < 3 {
+		return "", false
+	}
+
+	instance := util.ToLabel(labels[0])
+	if instance == "" {
+		return "", false
+	}
+
+	return instance + "." + strings.Join(labels[1:], "."), true
+}
+
+// unescape reverses the \DDD and \X escapes of the presentation format
+func unescape(label string) string {
+
+	var b strings.Builder
+
+	for i := 0; i < len(label); i++ {
+
+		if label[i] != '\\' || i+1 >= len(label) {
+			b.WriteByte(label[i])
+			continue
+		}
+
+		if i+3 < len(label) {
+			if n, err := strconv.Atoi(label[i+1 : i+4]); err == nil && n < 256 {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+
+		b.WriteByte(label[i+1])
+		i++
+	}
+
+	return b.String()
+}
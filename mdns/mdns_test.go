@@ -0,0 +1,294 @@
+package mdns
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func newRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rr
+}
+
+func newResponse(rrs ...dns.RR) *packet {
+	m := new(dns.Msg)
+	m.Response = true
+	m.Authoritative = true
+	m.Answer = rrs
+	return &packet{msg: m}
+}
+
+func recordsString(records *Records) string {
+
+	var s []string
+
+	for _, r := range records.ARecords {
+		s = append(s, "A "+r.Hostname+"."+r.Domain+"="+r.IP)
+	}
+	for _, r := range records.AAAARecords {
+		s = append(s, "AAAA "+r.Hostname+"."+r.Domain+"="+r.IP)
+	}
+	for _, r := range records.PtrRecords {
+		s = append(s, "PTR "+r.ARPA+"="+r.Hostname+"."+r.Domain)
+	}
+	for _, r := range records.SrvRecords {
+		s = append(s, "SRV "+r.Name+"."+r.Domain+"="+r.TargetHostname+"."+r.TargetDomain)
+	}
+	for _, r := range records.TxtRecords {
+		s = append(s, "TXT "+r.Name+"."+r.Domain+"="+strings.Join(r.Text, ","))
+	}
+
+	sort.Strings(s)
+	return strings.Join(s, " ")
+}
+
+// loopback returns the loopback interface
+func loopback(t *testing.T) net.Interface {
+	t.Helper()
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ifi := range ifaces {
+		if ifi.Flags&net.FlagLoopback != 0 && ifi.Flags&net.FlagUp != 0 {
+			return ifi
+		}
+	}
+
+	t.Skip("no loopback interface")
+	return net.Interface{}
+}
+
+// peer is an mDNS host on the loopback interface that answers the questions it
+// has responses for and remembers every question it is asked
+type peer struct {
+	conn      *conn
+	responses [][]dns.RR
+	mutex     sync.Mutex
+	questions []string
+}
+
+// newPeer listens on an ephemeral port. Each response is sent when a question
+// matches the name and type of its first record.
+func newPeer(t *testing.T, responses ...[]dns.RR) *peer {
+	t.Helper()
+
+	c, err := listen([]net.Interface{loopback(t)}, false, 0)
+	if err != nil {
+		t.Skipf("unable to listen for mDNS on the loopback interface; error %s", err.Error())
+	}
+
+	p := &peer{conn: c, responses: responses}
+
+	go c.read(p.handle)
+	t.Cleanup(c.close)
+
+	return p
+}
+
+func (t *peer) handle(p *packet) {
+
+	if p.msg.Response {
+		return
+	}
+
+	for _, q := range p.msg.Question {
+
+		t.mutex.Lock()
+		t.questions = append(t.questions, strings.ToLower(q.Name)+" "+dns.TypeToString[q.Qtype])
+		t.mutex.Unlock()
+
+		for _, rrs := range t.responses {
+			if strings.EqualFold(rrs[0].Header().Name, q.Name) && rrs[0].Header().Rrtype == q.Qtype {
+				m := new(dns.Msg)
+				m.Response = true
+				m.Authoritative = true
+				m.Answer = rrs[:1]
+				m.Extra = rrs[1:]
+				t.conn.send(m, 0)
+			}
+		}
+	}
+}
+
+func (t *peer) asked(question string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, q := range t.questions {
+		if q == question {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWatch(t *testing.T) {
+
+	instance := `Jody\'s\ Printer._ipp._tcp.local.`
+
+	// The browse finds the service type and its instance. The SRV record comes
+	// with the PTR record so only the TXT and A records are asked for.
+	p := newPeer(t,
+		[]dns.RR{newRR(t, metaQuery+" 4500 IN PTR _ipp._tcp.local.")},
+		[]dns.RR{
+			newRR(t, "_ipp._tcp.local. 4500 IN PTR "+instance),
+			newRR(t, instance+" 120 IN SRV 0 0 631 printer.local."),
+		},
+		[]dns.RR{newRR(t, instance+` 4500 IN TXT "rp=ipp/print" "ty=Office Printer"`)},
+		[]dns.RR{
+			newRR(t, "printer.local. 120 IN A 192.168.1.50"),
+			newRR(t, "printer.local. 120 IN A 169.254.1.50"),
+		},
+	)
+
+	client := New(&Config{Interfaces: []string{p.conn.ifaces[0].Name}, Services: true})
+	client.port = p.conn.port
+
+	done := make(chan struct{})
+	defer close(done)
+
+	changed := make(chan struct{}, 1)
+
+	go client.Watch(done, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	expected := "A printer.home=192.168.1.50 PTR 50.1.168.192.in-addr.arpa.=printer.home " +
+		"SRV jodys-printer._ipp._tcp.home=printer.home TXT jodys-printer._ipp._tcp.home=rp=ipp/print,ty=Office Printer"
+
+	var got string
+	timeout := time.After(time.Second * 5)
+
+	for got != expected {
+		select {
+		case <-changed:
+			records, _ := client.GetRecords()
+			got = recordsString(records)
+		case <-timeout:
+			t.Fatalf("expected %s, got %s", expected, got)
+		}
+	}
+
+	for _, question := range []string{"_ipp._tcp.local. PTR", strings.ToLower(instance) + " TXT", "printer.local. A"} {
+		if !p.asked(question) {
+			t.Errorf("expected the question %s", question)
+		}
+	}
+
+	for _, question := range []string{strings.ToLower(instance) + " SRV", "printer.local. AAAA"} {
+		if p.asked(question) {
+			t.Errorf("did not expect the question %s", question)
+		}
+	}
+}
+
+func TestHandle(t *testing.T) {
+
+	client := New(&Config{})
+
+	// Only the PTR and SRV records lead to questions so no conn is needed
+	a := newRR(t, "printer.local. 1 IN A 192.168.1.50")
+	b := newRR(t, "nas.local. 120 IN A 192.168.1.51")
+
+	query := new(dns.Msg)
+	query.SetQuestion("printer.local.", dns.TypeA)
+
+	if client.handle(nil, &packet{msg: query}) {
+		t.Error("expected a query to be ignored")
+	}
+
+	if !client.handle(nil, newResponse(a, b)) {
+		t.Error("expected the cache to change")
+	}
+
+	if client.handle(nil, newResponse(a, b)) {
+		t.Error("expected the same records to not change the cache")
+	}
+
+	// The TTL of the printer expires
+	expected := "A nas.home=192.168.1.51 PTR 51.1.168.192.in-addr.arpa.=nas.home"
+	if got := recordsString(client.getRecords(client.cache.get(time.Now().Add(time.Second * 2)))); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	// A new address with the cache flush bit replaces the old one
+	flush := newRR(t, "nas.local. 120 IN A 192.168.1.52")
+	flush.Header().Class |= cacheFlush
+
+	if !client.handle(nil, newResponse(flush)) {
+		t.Error("expected the cache to change")
+	}
+
+	expected = "A nas.home=192.168.1.52 PTR 52.1.168.192.in-addr.arpa.=nas.home"
+	if got := recordsString(client.getRecords(client.cache.get(time.Now()))); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	// A TTL of 0 is a goodbye
+	goodbye := newRR(t, "nas.local. 0 IN A 192.168.1.52")
+
+	if !client.handle(nil, newResponse(goodbye)) {
+		t.Error("expected the cache to change")
+	}
+
+	if rrs := client.cache.get(time.Now()); len(rrs) != 0 {
+		t.Errorf("expected an empty cache, got %v", rrs)
+	}
+}
+
+func TestGetRecords(t *testing.T) {
+
+	rrs := []dns.RR{
+		newRR(t, "Printer.local. 120 IN A 192.168.1.50"),
+		newRR(t, "Printer.local. 120 IN AAAA 2001:db8::50"),
+		newRR(t, "printer.local. 120 IN AAAA fe80::50"),
+		newRR(t, "laptop.local. 120 IN A 169.254.1.60"),
+		newRR(t, "a.b.local. 120 IN A 192.168.1.70"),
+		newRR(t, "printer.example.com. 120 IN A 192.168.1.80"),
+		newRR(t, `Jody\'s\ iPhone._companion-link._tcp.local. 120 IN SRV 0 0 49152 Jodys-iPhone.local.`),
+		newRR(t, `Jody\'s\ iPhone._companion-link._tcp.local. 120 IN TXT "rpBA=AA:BB"`),
+		newRR(t, `Office._ipp._tcp.local. 120 IN TXT ""`),
+		newRR(t, `_ipp._tcp.local. 120 IN SRV 0 0 631 printer.local.`),
+	}
+
+	tests := []struct {
+		config   *Config
+		expected string
+	}{
+		{
+			// Link local addresses and names that are not hosts in the local
+			// domain are skipped
+			config:   &Config{},
+			expected: "A printer.home=192.168.1.50 PTR 50.1.168.192.in-addr.arpa.=printer.home",
+		},
+		{
+			config: &Config{Domain: "lan", IPv6: true, Services: true},
+			expected: "A printer.lan=192.168.1.50 AAAA printer.lan=2001:db8::50 " +
+				"PTR 0.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.=printer.lan " +
+				"PTR 50.1.168.192.in-addr.arpa.=printer.lan " +
+				"SRV jodys-iphone._companion-link._tcp.lan=jodys-iphone.lan " +
+				"TXT jodys-iphone._companion-link._tcp.lan=rpBA=AA:BB",
+		},
+	}
+
+	for _, test := range tests {
+		if got := recordsString(New(test.config).getRecords(rrs)); got != test.expected {
+			t.Errorf("expected %s, got %s", test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,698 @@
+package mdns
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+
+	"github.com/jodydadescott/home-server/types"
+	"github.com/jodydadescott/home-server/util"
+)
+
+type ResponderConfig = types.MDNSResponderConfig
+type RecordEvent = types.RecordEvent
+
+const (
+	// hostTTL is the TTL that RFC 6762 recommends for host name records
+	hostTTL = 120
+
+	// legacyTTL is the maximum TTL for a response to a legacy unicast query
+	legacyTTL = 10
+
+	probeCount    = 3
+	probeInterval = time.Millisecond * 250
+
+	announceCount    = 2
+	announceInterval = time.Second
+
+	// reprobeDelay is how long a conflicting name waits before it is probed
+	// for again. It doubles with each conflict in a row up to maxReprobeDelay
+	// so a name that another host keeps is not probed for more than every few
+	// minutes.
+	reprobeDelay    = time.Second * 5
+	maxReprobeDelay = time.Minute * 5
+
+	syncInterval = time.Second * 10
+)
+
+const (
+	stateProbing = iota
+	stateAnnounced
+	stateConflict
+)
+
+// Source provides the records to answer for and the events for when they
+// change
+type Source interface {
+	GetRecords() *Records
+	Subscribe() (<-chan *RecordEvent, func())
+}
+
+// host is a name.local that is answered for
+type host struct {
+	name      string
+	ips       []string
+	state     int
+	conflicts int
+	reprobe   *time.Timer
+}
+
+// Responder answers multicast DNS queries for name.local with the addresses
+// of the hosts in the configured domains. Each name is probed for before it is
+// announced and a name that another host on the link has is not answered for
+// until it is probed for again as described in RFC 6762.
+type Responder struct {
+	mutex      sync.Mutex
+	interfaces []string
+	domains    map[string]bool
+	ipv6       bool
+	port       int
+	source     Source
+	conn       *conn
+	hosts      map[string]*host
+}
+
+func NewResponder(config *ResponderConfig, source Source) *Responder {
+
+	if config == nil {
+		panic("config is required")
+	}
+
+	if source == nil {
+		panic("source is required")
+	}
+
+	config = config.Clone()
+
+	responder := &Responder{
+		interfaces: config.Interfaces,
+		domains:    make(map[string]bool),
+		ipv6:       config.IPv6,
+		port:       Port,
+		source:     source,
+		hosts:      make(map[string]*host),
+	}
+
+	for _, domain := range config.Domains {
+		responder.domains[strings.TrimSuffix(strings.ToLower(domain), ".")] = true
+	}
+
+	if len(responder.domains) == 0 {
+		responder.domains[types.DefaultDomain] = true
+	}
+
+	return responder
+}
+
+// Run answers queries until the context is done. The records are synced when
+// they change and at an interval.
+func (t *Responder) Run(ctx context.Context) error {
+
+	ifaces, err := getInterfaces(t.interfaces)
+	if err != nil {
+		return err
+	}
+
+	c, err := listen(ifaces, t.ipv6, t.port)
+	if err != nil {
+		return err
+	}
+
+	for _, ifi := range ifaces {
+		zap.L().Info(fmt.Sprintf("mDNS responder is listening on %s", ifi.Name))
+	}
+
+	t.mutex.Lock()
+	t.conn = c
+	t.mutex.Unlock()
+
+	go c.read(t.handle)
+
+	events, cancel := t.source.Subscribe()
+	defer cancel()
+
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+
+	// The providers load when the DNS server starts so the first sync waits
+	// for them
+	pending := time.After(changeDelay)
+
+	for {
+		select {
+
+		case <-ctx.Done():
+			t.goodbye()
+			t.stop()
+			c.close()
+			return nil
+
+		case <-events:
+			if pending == nil {
+				pending = time.After(changeDelay)
+			}
+
+		case <-pending:
+			pending = nil
+			t.sync()
+
+		case <-ticker.C:
+			t.sync()
+
+		}
+	}
+}
+
+// getHosts returns the names and sorted IPs of the hosts to answer for.
+// Records bridged from mDNS are skipped as their hosts answer for themselves.
+func (t *Responder) getHosts() map[string][]string {
+
+	records := t.source.GetRecords()
+	hosts := make(map[string][]string)
+
+	add := func(r *ARecord) {
+
+		if !t.domains[strings.ToLower(r.Domain)] || strings.HasPrefix(r.SRC, source+":") {
+			return
+		}
+
+		if strings.Contains(r.Hostname, ".") {
+			return
+		}
+
+		hostname := util.ToLabel(r.Hostname)
+		if hostname == "" {
+			return
+		}
+
+		name := hostname + "." + localDomain
+		for _, ip := range hosts[name] {
+			if ip == r.IP {
+				return
+			}
+		}
+
+		hosts[name] = append(hosts[name], r.IP)
+	}
+
+	for _, r := range records.ARecords {
+		add(r)
+	}
+
+	if t.ipv6 {
+		for _, r := range records.AAAARecords {
+			add(r)
+		}
+	}
+
+	for _, ips := range hosts {
+		sort.Strings(ips)
+	}
+
+	return hosts
+}
+
+// sync probes for new names and sends goodbyes for names that were removed or
+// whose addresses changed
+func (t *Responder) sync() {
+
+	hosts := t.getHosts()
+
+	var goodbyes []*host
+	var probes []*host
+
+	t.mutex.Lock()
+
+	for name, h := range t.hosts {
+		ips, exist := hosts[name]
+		if exist && equal(ips, h.ips) {
+			continue
+		}
+		if h.state == stateAnnounced {
+			goodbyes = append(goodbyes, h)
+		}
+		if h.reprobe != nil {
+			h.reprobe.Stop()
+		}
+		delete(t.hosts, name)
+	}
+
+	for name, ips := range hosts {
+		if _, exist := t.hosts[name]; exist {
+			continue
+		}
+		h := &host{name: name, ips: ips, state: stateProbing}
+		t.hosts[name] = h
+		probes = append(probes, h)
+	}
+
+	t.mutex.Unlock()
+
+	for _, h := range goodbyes {
+		t.send(&dns.Msg{MsgHdr: dns.MsgHdr{Response: true, Authoritative: true}, Answer: h.getRecords(0, true)}, 0)
+	}
+
+	for _, h := range probes {
+		go t.probe(h)
+	}
+}
+
+// probe claims the name of the host. Three probes are sent 250ms apart and if
+// no other host has the name it is announced.
+func (t *Responder) probe(h *host) {
+
+	time.Sleep(time.Duration(rand.Int63n(int64(probeInterval))))
+
+	for i := 0; i < probeCount; i++ {
+
+		m := new(dns.Msg)
+		m.Question = []dns.Question{{Name: h.name, Qtype: dns.TypeANY, Qclass: dns.ClassINET | unicastResponse}}
+		m.Ns = h.getRecords(hostTTL, false)
+		t.send(m, 0)
+
+		time.Sleep(probeInterval)
+
+		if t.getState(h) != stateProbing {
+			return
+		}
+	}
+
+	t.mutex.Lock()
+	if t.hosts[h.name] != h || h.state != stateProbing {
+		t.mutex.Unlock()
+		return
+	}
+	h.state = stateAnnounced
+	h.conflicts = 0
+	t.mutex.Unlock()
+
+	zap.L().Debug(fmt.Sprintf("mDNS responder claimed %s", h.name))
+
+	for i := 0; i < announceCount; i++ {
+		if i > 0 {
+			time.Sleep(announceInterval)
+		}
+		if t.getState(h) != stateAnnounced {
+			return
+		}
+		t.send(&dns.Msg{MsgHdr: dns.MsgHdr{Response: true, Authoritative: true}, Answer: h.getRecords(hostTTL, true)}, 0)
+	}
+}
+
+func (t *Responder) getState(h *host) int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return h.state
+}
+
+// conflict marks the name of the host as in use by another host. The name is
+// not answered for until it is probed for again after a back-off as described
+// in RFC 6762 section 9. The caller must hold the mutex.
+func (t *Responder) conflict(h *host, reason string) {
+
+	if h.state == stateConflict {
+		return
+	}
+
+	h.state = stateConflict
+	h.conflicts++
+
+	delay := getReprobeDelay(h.conflicts)
+	h.reprobe = time.AfterFunc(delay, func() { t.probeAgain(h) })
+
+	zap.L().Warn(fmt.Sprintf("mDNS name %s conflicts with another host and will be probed for again in %s; %s", h.name, delay, reason))
+}
+
+// probeAgain probes for the name of a conflicting host if it is still to be
+// answered for
+func (t *Responder) probeAgain(h *host) {
+
+	t.mutex.Lock()
+	if t.hosts[h.name] != h || h.state != stateConflict {
+		t.mutex.Unlock()
+		return
+	}
+	h.state = stateProbing
+	t.mutex.Unlock()
+
+	t.probe(h)
+}
+
+// getReprobeDelay returns the back-off before the name is probed for again
+// after the number of conflicts in a row
+func getReprobeDelay(conflicts int) time.Duration {
+
+	delay := reprobeDelay
+	for i := 1; i < conflicts && delay < maxReprobeDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxReprobeDelay {
+		return maxReprobeDelay
+	}
+
+	return delay
+}
+
+// stop cancels the pending probes and forgets the hosts
+func (t *Responder) stop() {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, h := range t.hosts {
+		if h.reprobe != nil {
+			h.reprobe.Stop()
+		}
+	}
+
+	t.hosts = make(map[string]*host)
+}
+
+// goodbye sends records with a TTL of 0 for the announced hosts
+func (t *Responder) goodbye() {
+
+	t.mutex.Lock()
+	var rrs []dns.RR
+	for _, h := range t.hosts {
+		if h.state == stateAnnounced {
+			rrs = append(rrs, h.getRecords(0, true)...)
+		}
+	}
+	t.mutex.Unlock()
+
+	if len(rrs) > 0 {
+		t.send(&dns.Msg{MsgHdr: dns.MsgHdr{Response: true, Authoritative: true}, Answer: rrs}, 0)
+	}
+}
+
+func (t *Responder) send(m *dns.Msg, ifIndex int) {
+
+	t.mutex.Lock()
+	c := t.conn
+	t.mutex.Unlock()
+
+	if c == nil {
+		return
+	}
+
+	if err := c.send(m, ifIndex); err != nil {
+		zap.L().Debug(fmt.Sprintf("mDNS responder send failed; error %s", err.Error()))
+	}
+}
+
+// handle checks responses and probes from other hosts for conflicts and
+// answers queries
+func (t *Responder) handle(p *packet) {
+
+	if p.msg.Response {
+		t.checkResponse(p.msg)
+		return
+	}
+
+	t.checkProbe(p.msg)
+	t.answer(p)
+}
+
+// checkResponse marks a host as conflicting when another host responds with an
+// address of the same type for its name that it does not have. Identical
+// records, including our own responses, are not conflicts.
+func (t *Responder) checkResponse(m *dns.Msg) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, rr := range append(m.Answer, m.Extra...) {
+
+		h := t.hosts[strings.ToLower(rr.Header().Name)]
+		if h == nil || h.state == stateConflict {
+			continue
+		}
+
+		ip := getIP(rr)
+		if ip == nil || !h.hasFamily(ip) || h.hasIP(ip) {
+			continue
+		}
+
+		t.conflict(h, fmt.Sprintf("another host responded with %s", ip.String()))
+	}
+}
+
+// checkProbe breaks a tie with another host probing for the same name at the
+// same time. The host with the lexicographically later data wins. The same
+// data, including our own probes, is not a conflict.
+func (t *Responder) checkProbe(m *dns.Msg) {
+
+	if len(m.Ns) == 0 {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, q := range m.Question {
+
+		h := t.hosts[strings.ToLower(q.Name)]
+		if h == nil || h.state != stateProbing {
+			continue
+		}
+
+		var theirs []string
+		for _, rr := range m.Ns {
+			if strings.EqualFold(rr.Header().Name, q.Name) {
+				if ip := getIP(rr); ip != nil {
+					theirs = append(theirs, ip.String())
+				}
+			}
+		}
+		sort.Strings(theirs)
+
+		if equal(theirs, h.ips) {
+			continue
+		}
+
+		if isLater(theirs, h.ips) {
+			t.conflict(h, "another host is probing for the name")
+		}
+	}
+}
+
+// answer responds to the questions for the announced hosts. Answers the
+// querier already has are suppressed. The response is unicast if the querier
+// asked for it or is a legacy resolver not using the mDNS port.
+func (t *Responder) answer(p *packet) {
+
+	legacy := p.from != nil && p.from.Port != t.port
+	unicast := legacy
+
+	known := make(map[string]bool)
+	for _, rr := range p.msg.Answer {
+		if rr.Header().Ttl >= hostTTL/2 {
+			known[key(normalize(rr))] = true
+		}
+	}
+
+	var answers []dns.RR
+
+	t.mutex.Lock()
+
+	for _, q := range p.msg.Question {
+
+		if q.Qclass&unicastResponse != 0 {
+			unicast = true
+		}
+
+		name := strings.ToLower(q.Name)
+
+		var rrs []dns.RR
+
+		if h := t.hosts[name]; h != nil && h.state == stateAnnounced {
+			for _, rr := range h.getRecords(hostTTL, !legacy) {
+				if q.Qtype == dns.TypeANY || q.Qtype == rr.Header().Rrtype {
+					rrs = append(rrs, rr)
+				}
+			}
+		}
+
+		if q.Qtype == dns.TypePTR || q.Qtype == dns.TypeANY {
+			for _, h := range t.hosts {
+				if h.state != stateAnnounced {
+					continue
+				}
+				for _, rr := range h.getPTRRecords(hostTTL, !legacy) {
+					if strings.EqualFold(rr.Header().Name, name) {
+						rrs = append(rrs, rr)
+					}
+				}
+			}
+		}
+
+		for _, rr := range rrs {
+			if !known[key(normalize(rr))] {
+				answers = append(answers, rr)
+			}
+		}
+	}
+
+	t.mutex.Unlock()
+
+	if len(answers) == 0 {
+		return
+	}
+
+	resp := &dns.Msg{MsgHdr: dns.MsgHdr{Response: true, Authoritative: true}, Answer: answers}
+
+	if legacy {
+		resp.Id = p.msg.Id
+		resp.Question = p.msg.Question
+		for _, rr := range resp.Answer {
+			rr.Header().Ttl = legacyTTL
+		}
+	}
+
+	if unicast && p.from != nil {
+		t.mutex.Lock()
+		c := t.conn
+		t.mutex.Unlock()
+		if err := c.sendTo(resp, p.from); err != nil {
+			zap.L().Debug(fmt.Sprintf("mDNS responder send to %s failed; error %s", p.from.String(), err.Error()))
+		}
+		return
+	}
+
+	t.send(resp, p.ifIndex)
+}
+
+// getRecords returns the A and AAAA records of the host. The cache flush bit
+// is set when the records are unique to the host.
+func (t *host) getRecords(ttl uint32, flush bool) []dns.RR {
+
+	class := uint16(dns.ClassINET)
+	if flush {
+		class |= cacheFlush
+	}
+
+	var rrs []dns.RR
+
+	for _, v := range t.ips {
+		ip := net.ParseIP(v)
+		if ip.To4() != nil {
+			rrs = append(rrs, &dns.A{Hdr: dns.RR_Header{Name: t.name, Rrtype: dns.TypeA, Class: class, Ttl: ttl}, A: ip.To4()})
+		} else {
+			rrs = append(rrs, &dns.AAAA{Hdr: dns.RR_Header{Name: t.name, Rrtype: dns.TypeAAAA, Class: class, Ttl: ttl}, AAAA: ip})
+		}
+	}
+
+	return rrs
+}
+
+// getPTRRecords returns the reverse records for the addresses of the host
+func (t *host) getPTRRecords(ttl uint32, flush bool) []dns.RR {
+
+	class := uint16(dns.ClassINET)
+	if flush {
+		class |= cacheFlush
+	}
+
+	var rrs []dns.RR
+
+	for _, ip := range t.ips {
+		arpa, err := dns.ReverseAddr(ip)
+		if err != nil {
+			continue
+		}
+		rrs = append(rrs, &dns.PTR{Hdr: dns.RR_Header{Name: arpa, Rrtype: dns.TypePTR, Class: class, Ttl: ttl}, Ptr: t.name})
+	}
+
+	return rrs
+}
+
+func (t *host) hasIP(ip net.IP) bool {
+	for _, v := range t.ips {
+		if net.ParseIP(v).Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasFamily returns true if the host has an address of the same family
+func (t *host) hasFamily(ip net.IP) bool {
+	for _, v := range t.ips {
+		if (net.ParseIP(v).To4() != nil) == (ip.To4() != nil) {
+			return true
+		}
+	}
+	return false
+}
+
+// getIP returns the address of an A or AAAA record
+func getIP(rr dns.RR) net.IP {
+	switch v := rr.(type) {
+	case *dns.A:
+		return v.A
+	case *dns.AAAA:
+		return v.AAAA
+	}
+	return nil
+}
+
+// normalize returns a copy of the record without the cache flush bit and TTL
+// so it can be compared
+func normalize(rr dns.RR) dns.RR {
+	rr = dns.Copy(rr)
+	rr.Header().Class &^= cacheFlush
+	rr.Header().Ttl = 0
+	return rr
+}
+
+// isLater compares the addresses as RFC 6762 section 8.2 compares the records
+// of simultaneous probes. The A records sort before the AAAA records and the
+// addresses are compared as bytes so 192.168.1.9 is before 192.168.1.10.
+func isLater(theirs, ours []string) bool {
+
+	rdata := func(ips []string) [][]byte {
+		var data [][]byte
+		for _, v := range ips {
+			ip := net.ParseIP(v)
+			if ip4 := ip.To4(); ip4 != nil {
+				data = append(data, append([]byte{0}, ip4...))
+			} else if ip != nil {
+				data = append(data, append([]byte{1}, ip...))
+			}
+		}
+		sort.Slice(data, func(i, j int) bool { return bytes.Compare(data[i], data[j]) < 0 })
+		return data
+	}
+
+	a, b := rdata(theirs), rdata(ours)
+
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := bytes.Compare(a[i], b[i]); c != 0 {
+			return c > 0
+		}
+	}
+
+	return len(a) > len(b)
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,171 @@
+package mdns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// emptySource has no records
+type emptySource struct{}
+
+func (t *emptySource) GetRecords() *Records {
+	return &Records{}
+}
+
+func (t *emptySource) Subscribe() (<-chan *RecordEvent, func()) {
+	return make(chan *RecordEvent), func() {}
+}
+
+// newTestResponder returns a responder without a conn that answers for nas.local
+// in the state
+func newTestResponder(t *testing.T, state int) (*Responder, *host) {
+
+	r := NewResponder(&ResponderConfig{}, &emptySource{})
+	h := &host{name: "nas.local.", ips: []string{"192.168.1.10"}, state: state}
+	r.hosts[h.name] = h
+
+	t.Cleanup(r.stop)
+
+	return r, h
+}
+
+func newProbe(t *testing.T, name string, rrs ...string) *dns.Msg {
+	m := new(dns.Msg)
+	m.Question = []dns.Question{{Name: name, Qtype: dns.TypeANY, Qclass: dns.ClassINET | unicastResponse}}
+	for _, s := range rrs {
+		m.Ns = append(m.Ns, newRR(t, s))
+	}
+	return m
+}
+
+func TestCheckResponse(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		rr       string
+		conflict bool
+	}{
+		{"same address", "nas.local. 120 IN A 192.168.1.10", false},
+		{"same address in uppercase", "NAS.local. 120 IN A 192.168.1.10", false},
+		{"other family", "nas.local. 120 IN AAAA 2001:db8::10", false},
+		{"other name", "printer.local. 120 IN A 192.168.1.50", false},
+		{"other address", "nas.local. 120 IN A 192.168.1.99", true},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			r, h := newTestResponder(t, stateAnnounced)
+
+			rr := newRR(t, test.rr)
+			rr.Header().Class |= cacheFlush
+
+			r.checkResponse(&dns.Msg{MsgHdr: dns.MsgHdr{Response: true}, Answer: []dns.RR{rr}})
+
+			if (h.state == stateConflict) != test.conflict {
+				t.Errorf("expected conflict %t, got state %d", test.conflict, h.state)
+			}
+		})
+	}
+}
+
+func TestCheckProbe(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		state    int
+		probe    *dns.Msg
+		conflict bool
+	}{
+		{"same address", stateProbing, newProbe(t, "nas.local.", "nas.local. 120 IN A 192.168.1.10"), false},
+		{"earlier address", stateProbing, newProbe(t, "nas.local.", "nas.local. 120 IN A 192.168.1.9"), false},
+		{"later address", stateProbing, newProbe(t, "nas.local.", "nas.local. 120 IN A 192.168.1.99"), true},
+		{"more addresses", stateProbing, newProbe(t, "nas.local.", "nas.local. 120 IN A 192.168.1.10", "nas.local. 120 IN AAAA 2001:db8::10"), true},
+		{"other name", stateProbing, newProbe(t, "printer.local.", "printer.local. 120 IN A 192.168.1.99"), false},
+		{"announced", stateAnnounced, newProbe(t, "nas.local.", "nas.local. 120 IN A 192.168.1.99"), false},
+		{"query", stateProbing, newProbe(t, "nas.local."), false},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			r, h := newTestResponder(t, test.state)
+			r.checkProbe(test.probe)
+
+			if (h.state == stateConflict) != test.conflict {
+				t.Errorf("expected conflict %t, got state %d", test.conflict, h.state)
+			}
+		})
+	}
+}
+
+func TestOwnPackets(t *testing.T) {
+
+	r, h := newTestResponder(t, stateProbing)
+
+	// Our probe and announcement are looped back to us
+	probe := &dns.Msg{Question: []dns.Question{{Name: h.name, Qtype: dns.TypeANY, Qclass: dns.ClassINET | unicastResponse}}, Ns: h.getRecords(hostTTL, false)}
+	r.handle(&packet{msg: probe})
+
+	h.state = stateAnnounced
+
+	announcement := &dns.Msg{MsgHdr: dns.MsgHdr{Response: true, Authoritative: true}, Answer: h.getRecords(hostTTL, true)}
+	r.handle(&packet{msg: announcement})
+
+	if h.state != stateAnnounced {
+		t.Errorf("expected our own packets to be ignored, got state %d", h.state)
+	}
+}
+
+func TestProbeAgain(t *testing.T) {
+
+	r, h := newTestResponder(t, stateAnnounced)
+
+	r.mutex.Lock()
+	r.conflict(h, "test")
+	r.conflict(h, "test")
+	r.mutex.Unlock()
+
+	if h.state != stateConflict || h.conflicts != 1 || h.reprobe == nil {
+		t.Fatalf("expected one conflict with a probe scheduled, got state %d with %d conflicts", h.state, h.conflicts)
+	}
+
+	// The host was removed so it is not probed for
+	other := &host{name: h.name, state: stateConflict}
+	r.probeAgain(other)
+
+	if other.state != stateConflict {
+		t.Errorf("expected a removed host to not be probed for, got state %d", other.state)
+	}
+
+	// Without a conn the probes are not sent and the name is claimed
+	r.probeAgain(h)
+
+	if h.state != stateAnnounced || h.conflicts != 0 {
+		t.Errorf("expected the name to be claimed, got state %d with %d conflicts", h.state, h.conflicts)
+	}
+}
+
+func TestGetReprobeDelay(t *testing.T) {
+
+	expected := []time.Duration{
+		time.Second * 5,
+		time.Second * 10,
+		time.Second * 20,
+		time.Second * 40,
+		time.Second * 80,
+		time.Second * 160,
+		time.Minute * 5,
+		time.Minute * 5,
+	}
+
+	for i, delay := range expected {
+		if got := getReprobeDelay(i + 1); got != delay {
+			t.Errorf("conflict %d: expected %s, got %s", i+1, delay, got)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package memory
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jodydadescott/home-server/types"
+	"github.com/jodydadescott/home-server/util"
+)
+
+type Config = types.RuntimeConfig
+type ARecord = types.ARecord
+type CNameRecord = types.CNameRecord
+type PTRrecord = types.PTRrecord
+type Records = types.DomainRecords
+
+const (
+	source = "runtime"
+)
+
+// Client is a provider for records that are added and removed at runtime. The
+// records are held in memory only.
+type Client struct {
+	mutex        sync.RWMutex
+	domain       string
+	aRecords     map[string]*ARecord
+	aaaaRecords  map[string]*ARecord
+	cnameRecords map[string]*CNameRecord
+	priority     int
+	changed      func()
+}
+
+func New(config *Config) *Client {
+
+	if config == nil {
+		panic("config is required")
+	}
+
+	domain := types.DefaultDomain
+	if config.Domain != "" {
+		domain = config.Domain
+	}
+
+	return &Client{
+		domain:       domain,
+		aRecords:     make(map[string]*ARecord),
+		aaaaRecords:  make(map[string]*ARecord),
+		cnameRecords: make(map[string]*CNameRecord),
+		priority:     config.Priority,
+	}
+}
+
+func (t *Client) GetName() string {
+	return source
+}
+
+func (t *Client) GetDomainName() string {
+	return t.domain
+}
+
+func (t *Client) GetRefreshDuration() time.Duration {
+	return 0
+}
+
+// GetPriority implements dns.Prioritized
+func (t *Client) GetPriority() int {
+	return t.priority
+}
+
+// Static implements dns.Static
+func (t *Client) Static() bool {
+	return true
+}
+
+// Watch implements dns.Watcher
+func (t *Client) Watch(done <-chan struct{}, changed func()) {
+
+	t.mutex.Lock()
+	t.changed = changed
+	t.mutex.Unlock()
+
+	<-done
+
+	t.mutex.Lock()
+	t.changed = nil
+	t.mutex.Unlock()
+}
+
+func (t *Client) notify() {
+
+	t.mutex.RLock()
+	changed := t.changed
+	t.mutex.RUnlock()
+
+	if changed != nil {
+		changed()
+	}
+}
+
+// GetRecords returns the runtime records along with a PTR record for each
+// A and AAAA record
+func (t *Client) GetRecords() (*Records, error) {
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	records := &Records{}
+
+	addPTR := func(a *ARecord) {
+		arpa, err := util.GetARPA(a.IP)
+		if err != nil {
+			return
+		}
+		records.AddPtrRecords(&PTRrecord{
+			ARPA:     arpa,
+			Hostname: a.Hostname,
+			Domain:   a.Domain,
+			SRC:      a.SRC,
+		})
+	}
+
+	for _, r := range t.aRecords {
+		records.AddARecords(r.Clone())
+		addPTR(r)
+	}
+
+	for _, r := range t.aaaaRecords {
+		records.AddAAAARecords(r.Clone())
+		addPTR(r)
+	}
+
+	for _, r := range t.cnameRecords {
+		records.AddCNameRecords(r.Clone())
+	}
+
+	return records, nil
+}
+
+// AddRecords adds the A, AAAA and CNAME records. A record with the same name
+// as an existing record replaces it. PTR records are generated and can not be
+// added directly.
+func (t *Client) AddRecords(records *Records) error {
+
+	if records == nil {
+		return fmt.Errorf("records is required")
+	}
+
+	if len(records.PtrRecords) > 0 {
+		return fmt.Errorf("PTR records can not be added; they are generated from A and AAAA records")
+	}
+
+	var aRecords, aaaaRecords []*ARecord
+	var cnameRecords []*CNameRecord
+
+	check := func(r *ARecord, v4 bool) (*ARecord, error) {
+
+		if r.Hostname == "" {
+			return nil, fmt.Errorf("Record must have a hostname")
+		}
+
+		ip := net.ParseIP(r.IP)
+		if ip == nil || (ip.To4() != nil) != v4 {
+			return nil, fmt.Errorf("Record %s has an invalid IP %s", r.Hostname, r.IP)
+		}
+
+		r = r.Clone()
+		if r.Domain == "" {
+			r.Domain = t.domain
+		}
+		r.SRC = source + ":http"
+
+		return r, nil
+	}
+
+	for _, r := range records.ARecords {
+		r, err := check(r, true)
+		if err != nil {
+			return err
+		}
+		aRecords = append(aRecords, r)
+	}
+
+	for _, r := range records.AAAARecords {
+		r, err := check(r, false)
+		if err != nil {
+			return err
+		}
+		aaaaRecords = append(aaaaRecords, r)
+	}
+
+	for _, r := range records.CnameRecords {
+
+		if r.AliasHostname == "" {
+			return fmt.Errorf("CNAME must have AliasHostname")
+		}
+
+		if r.TargetHostname == "" {
+			return fmt.Errorf("CNAME must have TargetHostname")
+		}
+
+		r = r.Clone()
+
+		if r.AliasDomain == "" {
+			r.AliasDomain = t.domain
+		}
+
+		if r.TargetDomain == "" {
+			r.TargetDomain = t.domain
+		}
+
+		r.SRC = source + ":http"
+		cnameRecords = append(cnameRecords, r)
+	}
+
+	t.mutex.Lock()
+
+	for _, r := range aRecords {
+		t.aRecords[r.GetKey()] = r
+	}
+
+	for _, r := range aaaaRecords {
+		t.aaaaRecords[r.GetKey()] = r
+	}
+
+	for _, r := range cnameRecords {
+		t.cnameRecords[r.GetKey()] = r
+	}
+
+	t.mutex.Unlock()
+
+	t.notify()
+	return nil
+}
+
+// RemoveRecords removes the A, AAAA and CNAME records with the same name
+func (t *Client) RemoveRecords(records *Records) error {
+
+	if records == nil {
+		return fmt.Errorf("records is required")
+	}
+
+	t.mutex.Lock()
+
+	for _, r := range records.ARecords {
+		r = r.Clone()
+		if r.Domain == "" {
+			r.Domain = t.domain
+		}
+		delete(t.aRecords, r.GetKey())
+	}
+
+	for _, r := range records.AAAARecords {
+		r = r.Clone()
+		if r.Domain == "" {
+			r.Domain = t.domain
+		}
+		delete(t.aaaaRecords, r.GetKey())
+	}
+
+	for _, r := range records.CnameRecords {
+		r = r.Clone()
+		if r.AliasDomain == "" {
+			r.AliasDomain = t.domain
+		}
+		delete(t.cnameRecords, r.GetKey())
+	}
+
+	t.mutex.Unlock()
+
+	t.notify()
+	return nil
+}
@@ -0,0 +1,307 @@
+package neighbor
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jodydadescott/home-server/types"
+	"github.com/jodydadescott/home-server/util"
+)
+
+type Config = types.NeighborConfig
+type ARecord = types.ARecord
+type PTRrecord = types.PTRrecord
+type Records = types.DomainRecords
+
+const (
+	source = "neighbor"
+
+	defaultArpFile  = "/proc/net/arp"
+	defaultRefresh  = time.Minute
+	defaultLearnAge = time.Hour * 24 * 7
+)
+
+// RecordSource provides the records of the other providers. The MACs on their
+// records are used to name neighbors that are not in the config.
+type RecordSource interface {
+	GetRecords() *Records
+}
+
+// Client is a provider for the hosts in the kernel ARP and NDP neighbor tables.
+// Only the hosts that have a name and are not already served by another
+// provider get records.
+type Client struct {
+	mutex        sync.Mutex
+	domain       string
+	refresh      time.Duration
+	arpFile      string
+	ipv6         bool
+	learn        bool
+	learnAge     time.Duration
+	hosts        map[string]string
+	priority     int
+	learned      map[string]*name
+	recordSource RecordSource
+}
+
+func New(config *Config) *Client {
+
+	if config == nil {
+		panic("config is required")
+	}
+
+	config = config.Clone()
+
+	client := &Client{
+		domain:   types.DefaultDomain,
+		refresh:  defaultRefresh,
+		arpFile:  defaultArpFile,
+		ipv6:     config.IPv6,
+		learn:    config.Learn,
+		learnAge: defaultLearnAge,
+		priority: config.Priority,
+		hosts:    make(map[string]string),
+		learned:  make(map[string]*name),
+	}
+
+	if config.Domain != "" {
+		client.domain = config.Domain
+	}
+
+	if config.Refresh > 0 {
+		client.refresh = config.Refresh
+	}
+
+	if config.ArpFile != "" {
+		client.arpFile = config.ArpFile
+	}
+
+	if config.LearnAge > 0 {
+		client.learnAge = config.LearnAge
+	}
+
+	for mac, hostname := range config.Hosts {
+		hw, err := net.ParseMAC(mac)
+		if err != nil {
+			panic(fmt.Sprintf("neighbor host MAC %s is invalid", mac))
+		}
+		client.hosts[hw.String()] = hostname
+	}
+
+	return client
+}
+
+// SetRecordSource sets the source of the records that MACs are learned from
+func (t *Client) SetRecordSource(recordSource RecordSource) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.recordSource = recordSource
+}
+
+func (t *Client) GetName() string {
+	return source
+}
+
+func (t *Client) GetDomainName() string {
+	return t.domain
+}
+
+func (t *Client) GetRefreshDuration() time.Duration {
+	return t.refresh
+}
+
+// GetPriority implements dns.Prioritized
+func (t *Client) GetPriority() int {
+	return t.priority
+}
+
+func (t *Client) GetRecords() (*Records, error) {
+
+	f, err := os.Open(t.arpFile)
+	if err != nil {
+		return nil, err
+	}
+
+	neighbors, err := ParseARP(f)
+	f.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", t.arpFile, err.Error())
+	}
+
+	if t.ipv6 {
+
+		var stdout bytes.Buffer
+
+		cmd := exec.Command("ip", "-6", "neigh", "show")
+		cmd.Stdout = &stdout
+
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("ip -6 neigh show failed; error %s", err.Error())
+		}
+
+		ndp, err := ParseNeigh(&stdout)
+		if err != nil {
+			return nil, fmt.Errorf("ip -6 neigh show: %s", err.Error())
+		}
+
+		neighbors = append(neighbors, ndp...)
+	}
+
+	known := &Records{}
+
+	t.mutex.Lock()
+	recordSource := t.recordSource
+	t.mutex.Unlock()
+
+	if recordSource != nil {
+		known = recordSource.GetRecords()
+	}
+
+	return t.join(neighbors, known), nil
+}
+
+// name is a hostname and domain. Seen is when a learned name was last in the
+// known records or its MAC was last in the neighbor tables.
+type name struct {
+	hostname string
+	domain   string
+	seen     time.Time
+}
+
+// join returns the records for the neighbors that have a name. Names from the
+// config take precedence over names learned from the known records. Learned
+// names are kept so a host still has a name after the provider it was learned
+// from drops it until they have not been seen for the learn age. Names that the known records already have for the address type
+// are skipped as are link local addresses.
+func (t *Client) join(neighbors []*Neighbor, known *Records) *Records {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	served := make(map[string]bool)
+	servedPTR := make(map[string]bool)
+
+	for _, r := range known.ARecords {
+		if !strings.HasPrefix(r.SRC, source+":") {
+			served["A "+r.GetKey()] = true
+		}
+	}
+
+	for _, r := range known.AAAARecords {
+		if !strings.HasPrefix(r.SRC, source+":") {
+			served["AAAA "+r.GetKey()] = true
+		}
+	}
+
+	for _, r := range known.PtrRecords {
+		if !strings.HasPrefix(r.SRC, source+":") {
+			servedPTR[r.GetKey()] = true
+		}
+	}
+
+	if t.learn {
+		for _, r := range append(known.ARecords, known.AAAARecords...) {
+			if r.MAC == "" || strings.HasPrefix(r.SRC, source+":") {
+				continue
+			}
+			if mac, err := net.ParseMAC(r.MAC); err == nil {
+				t.learned[mac.String()] = &name{hostname: r.Hostname, domain: r.Domain, seen: now}
+			}
+		}
+	}
+
+	for _, neighbor := range neighbors {
+		if n := t.learned[neighbor.MAC]; n != nil {
+			n.seen = now
+		}
+	}
+
+	for mac, n := range t.learned {
+		if now.Sub(n.seen) > t.learnAge {
+			zap.L().Debug(fmt.Sprintf("Forgetting learned name %s.%s for MAC=%s", n.hostname, n.domain, mac))
+			delete(t.learned, mac)
+		}
+	}
+
+	names := make(map[string]*name)
+
+	for mac, n := range t.learned {
+		names[mac] = n
+	}
+
+	for mac, hostname := range t.hosts {
+		names[mac] = &name{hostname: hostname, domain: t.domain}
+	}
+
+	records := &Records{}
+
+	for _, neighbor := range neighbors {
+
+		ip := net.ParseIP(neighbor.IP)
+		if ip == nil || ip.IsLinkLocalUnicast() || ip.IsMulticast() {
+			continue
+		}
+
+		n := names[neighbor.MAC]
+		if n == nil {
+			zap.L().Debug(fmt.Sprintf("Neighbor with MAC=%s and IP=%s does not have a name", neighbor.MAC, neighbor.IP))
+			continue
+		}
+
+		recordType := "A"
+		src := source + ":arp"
+		if ip.To4() == nil {
+			recordType = "AAAA"
+			src = source + ":ndp"
+		}
+
+		a := &ARecord{
+			Hostname: n.hostname,
+			Domain:   n.domain,
+			IP:       neighbor.IP,
+			MAC:      neighbor.MAC,
+			SRC:      src,
+		}
+
+		if served[recordType+" "+a.GetKey()] {
+			continue
+		}
+		served[recordType+" "+a.GetKey()] = true
+
+		if recordType == "A" {
+			records.AddARecords(a)
+		} else {
+			records.AddAAAARecords(a)
+		}
+
+		arpa, err := util.GetARPA(neighbor.IP)
+		if err != nil {
+			zap.L().Debug(fmt.Sprintf("Neighbor %s has an invalid IP; error %s", n.hostname, err.Error()))
+			continue
+		}
+
+		if servedPTR[arpa] {
+			continue
+		}
+		servedPTR[arpa] = true
+
+		records.AddPtrRecords(&PTRrecord{
+			ARPA:     arpa,
+			Hostname: n.hostname,
+			Domain:   n.domain,
+			SRC:      src,
+		})
+	}
+
+	return records
+}
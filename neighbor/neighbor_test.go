@@ -0,0 +1,178 @@
+package neighbor
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseFile(t *testing.T, file string, parse func(io.Reader) ([]*Neighbor, error)) []*Neighbor {
+	t.Helper()
+
+	f, err := os.Open("testdata/" + file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	neighbors, err := parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return neighbors
+}
+
+func neighborsString(neighbors []*Neighbor) string {
+	var s []string
+	for _, n := range neighbors {
+		s = append(s, n.IP+"="+n.MAC+"@"+n.Device)
+	}
+	return strings.Join(s, " ")
+}
+
+func recordsString(records *Records) string {
+	var s []string
+	for _, r := range records.ARecords {
+		s = append(s, "A "+r.Hostname+"."+r.Domain+"="+r.IP)
+	}
+	for _, r := range records.AAAARecords {
+		s = append(s, "AAAA "+r.Hostname+"."+r.Domain+"="+r.IP)
+	}
+	return strings.Join(s, " ")
+}
+
+func TestParseARP(t *testing.T) {
+
+	// .40 and .41 are incomplete and .42 does not have a MAC
+	expected := "192.168.1.20=3c:22:fb:11:22:33@eth0 192.168.1.21=00:11:32:aa:bb:cc@eth0 " +
+		"192.168.1.23=b8:27:eb:01:02:03@eth0 192.168.1.1=74:ac:b9:00:00:01@eth0 " +
+		"169.254.10.1=3c:22:fb:11:22:33@eth0"
+
+	if got := neighborsString(parseFile(t, "proc_net_arp", ParseARP)); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	for _, text := range []string{
+		"header\n192.168.1.20 0x1 0x2 3c:22:fb:11:22:33 *\n",
+		"header\n192.168.1.300 0x1 0x2 3c:22:fb:11:22:33 * eth0\n",
+		"header\n192.168.1.20 0x1 2 3c:22:fb:11:22:33 * eth0\n",
+		"header\n192.168.1.20 0x1 0x2 3c:22:fb * eth0\n",
+	} {
+		if _, err := ParseARP(strings.NewReader(text)); err == nil {
+			t.Errorf("expected an error for %q", text)
+		}
+	}
+}
+
+func TestParseNeigh(t *testing.T) {
+
+	// The FAILED and INCOMPLETE entries are skipped with or without a MAC
+	expected := "2001:db8:0:1::20=3c:22:fb:11:22:33@eth0 fe80::3e22:fbff:fe11:2233=3c:22:fb:11:22:33@eth0 " +
+		"2001:db8:0:1::1=74:ac:b9:00:00:01@eth0 2001:db8:0:1::21=00:11:32:aa:bb:cc@eth0"
+
+	if got := neighborsString(parseFile(t, "ip6_neigh", ParseNeigh)); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	for _, text := range []string{"nas dev eth0 lladdr 00:11:32:aa:bb:cc STALE\n", "fd00::10 dev eth0 lladdr 00:11 STALE\n"} {
+		if _, err := ParseNeigh(strings.NewReader(text)); err == nil {
+			t.Errorf("expected an error for %q", text)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+
+	client := New(&Config{
+		Domain: "home",
+		Learn:  true,
+		Hosts:  map[string]string{"3C:22:FB:11:22:33": "phone"},
+	})
+
+	neighbors := append(parseFile(t, "proc_net_arp", ParseARP), parseFile(t, "ip6_neigh", ParseNeigh)...)
+
+	known := &Records{}
+	known.AddARecords(
+		// The name from the config beats the learned name
+		&ARecord{Hostname: "jodys-iphone", Domain: "home", IP: "192.168.1.20", MAC: "3c:22:fb:11:22:33", SRC: "lease:dnsmasq"},
+		// The lease already serves the A record but not the AAAA record
+		&ARecord{Hostname: "nas", Domain: "home", IP: "192.168.1.21", MAC: "00:11:32:aa:bb:cc", SRC: "lease:dnsmasq"},
+		// Names are not learned from our own records
+		&ARecord{Hostname: "pi", Domain: "home", IP: "192.168.1.23", MAC: "b8:27:eb:01:02:03", SRC: "neighbor:arp"},
+	)
+
+	// The link local addresses of the phone are skipped
+	expected := "A phone.home=192.168.1.20 AAAA phone.home=2001:db8:0:1::20 AAAA nas.home=2001:db8:0:1::21"
+
+	records := client.join(neighbors, known)
+	if got := recordsString(records); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	if len(records.PtrRecords) != 3 {
+		t.Errorf("expected 3 PTR records, got %d", len(records.PtrRecords))
+	}
+
+	// The lease has gone but the learned name of the nas is kept
+	expected = "A phone.home=192.168.1.20 A nas.home=192.168.1.21 AAAA phone.home=2001:db8:0:1::20 AAAA nas.home=2001:db8:0:1::21"
+
+	if got := recordsString(client.join(neighbors, &Records{})); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
+
+func TestJoinWithoutLearn(t *testing.T) {
+
+	client := New(&Config{Hosts: map[string]string{"00:11:32:aa:bb:cc": "nas"}})
+
+	known := &Records{}
+	known.AddARecords(&ARecord{Hostname: "jodys-iphone", Domain: "home", IP: "192.168.1.20", MAC: "3c:22:fb:11:22:33", SRC: "lease:dnsmasq"})
+
+	expected := "A nas." + client.GetDomainName() + "=192.168.1.21"
+
+	if got := recordsString(client.join(parseFile(t, "proc_net_arp", ParseARP), known)); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
+
+func TestLearnAge(t *testing.T) {
+
+	client := New(&Config{Domain: "home", Learn: true, LearnAge: time.Hour})
+
+	neighbors := parseFile(t, "proc_net_arp", ParseARP)
+
+	known := &Records{}
+	known.AddARecords(
+		&ARecord{Hostname: "nas", Domain: "home", IP: "192.168.1.21", MAC: "00:11:32:aa:bb:cc", SRC: "lease:dnsmasq"},
+		&ARecord{Hostname: "tv", Domain: "home", IP: "192.168.1.60", MAC: "a4:5e:60:01:02:03", SRC: "lease:dnsmasq"},
+	)
+
+	client.join(neighbors, known)
+
+	if len(client.learned) != 2 {
+		t.Fatalf("expected 2 learned names, got %d", len(client.learned))
+	}
+
+	// Neither has been in the records for longer than the learn age but the nas
+	// is still in the neighbor table
+	for _, n := range client.learned {
+		n.seen = n.seen.Add(-time.Hour * 2)
+	}
+
+	expected := "A nas.home=192.168.1.21"
+
+	if got := recordsString(client.join(neighbors, &Records{})); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	if n := client.learned["00:11:32:aa:bb:cc"]; n == nil || time.Since(n.seen) > time.Minute {
+		t.Error("expected the learned name of the nas to be kept")
+	}
+
+	if client.learned["a4:5e:60:01:02:03"] != nil {
+		t.Error("expected the learned name of the tv to be forgotten")
+	}
+}
@@ -0,0 +1,137 @@
+package neighbor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+const (
+	// arpComplete is the ATF_COM flag for a resolved ARP entry
+	arpComplete = 0x2
+)
+
+// Neighbor is an entry in a kernel neighbor table
+type Neighbor struct {
+	IP     string
+	MAC    string
+	Device string
+}
+
+// ParseARP parses /proc/net/arp. Entries that are not resolved are skipped.
+func ParseARP(r io.Reader) ([]*Neighbor, error) {
+
+	var neighbors []*Neighbor
+	line := 0
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+
+		line++
+
+		// The first line is the header
+		if line == 1 {
+			continue
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) < 6 {
+			return nil, fmt.Errorf("line %d: expected 6 fields", line)
+		}
+
+		if net.ParseIP(fields[0]) == nil {
+			return nil, fmt.Errorf("line %d: IP %s is invalid", line, fields[0])
+		}
+
+		var flags int
+		if _, err := fmt.Sscanf(fields[2], "0x%x", &flags); err != nil {
+			return nil, fmt.Errorf("line %d: flags %s are invalid", line, fields[2])
+		}
+
+		mac, err := net.ParseMAC(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: MAC %s is invalid", line, fields[3])
+		}
+
+		if flags&arpComplete == 0 || isZero(mac) {
+			continue
+		}
+
+		neighbors = append(neighbors, &Neighbor{
+			IP:     fields[0],
+			MAC:    mac.String(),
+			Device: fields[5],
+		})
+	}
+
+	return neighbors, scanner.Err()
+}
+
+// ParseNeigh parses the output of "ip neigh show", for example
+// "fd00::10 dev eth0 lladdr aa:bb:cc:dd:ee:ff router REACHABLE". Entries
+// without a link layer address or in the FAILED or INCOMPLETE state are
+// skipped.
+func ParseNeigh(r io.Reader) ([]*Neighbor, error) {
+
+	var neighbors []*Neighbor
+	line := 0
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+
+		line++
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if net.ParseIP(fields[0]) == nil {
+			return nil, fmt.Errorf("line %d: IP %s is invalid", line, fields[0])
+		}
+
+		neighbor := &Neighbor{IP: fields[0]}
+		state := fields[len(fields)-1]
+
+		for i := 1; i < len(fields)-1; i++ {
+			switch fields[i] {
+
+			case "dev":
+				neighbor.Device = fields[i+1]
+
+			case "lladdr":
+				mac, err := net.ParseMAC(fields[i+1])
+				if err != nil {
+					return nil, fmt.Errorf("line %d: MAC %s is invalid", line, fields[i+1])
+				}
+				neighbor.MAC = mac.String()
+
+			}
+		}
+
+		if neighbor.MAC == "" || state == "FAILED" || state == "INCOMPLETE" {
+			continue
+		}
+
+		neighbors = append(neighbors, neighbor)
+	}
+
+	return neighbors, scanner.Err()
+}
+
+func isZero(mac net.HardwareAddr) bool {
+	for _, b := range mac {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,258 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jodydadescott/home-server/types"
+)
+
+type Config = types.NotifyConfig
+type RecordEvent = types.RecordEvent
+type DomainRecords = types.DomainRecords
+type ProviderStatus = types.ProviderStatus
+type UpstreamStatus = types.UpstreamStatus
+
+const (
+	EventNewHostname     = "new-hostname"
+	EventIPChanged       = "ip-changed"
+	EventProviderFailing = "provider-failing"
+	EventUpstreamDown    = "upstream-down"
+
+	defaultProviderFailing  = time.Minute * 15
+	defaultUpstreamFailures = 3
+	defaultInterval         = time.Minute
+)
+
+// Notification is what is sent to webhooks. It is also the data for webhook
+// templates.
+type Notification struct {
+	Event    string    `json:"event,omitempty"`
+	Time     time.Time `json:"time,omitempty"`
+	Title    string    `json:"title,omitempty"`
+	Message  string    `json:"message,omitempty"`
+	Name     string    `json:"name,omitempty"`
+	Old      string    `json:"old,omitempty"`
+	New      string    `json:"new,omitempty"`
+	SRC      string    `json:"src,omitempty"`
+	Provider string    `json:"provider,omitempty"`
+}
+
+// StatusProvider provides the records and the status checked by the notifier
+type StatusProvider interface {
+	GetRecords() *DomainRecords
+	GetProviderStatus() []*ProviderStatus
+	GetUpstreamStatus() []*UpstreamStatus
+}
+
+// Notifier sends notifications to webhooks for record events and for failing
+// providers and upstream nameservers
+type Notifier struct {
+	mutex            sync.Mutex
+	statusProvider   StatusProvider
+	webhooks         []*webhook
+	providerFailing  time.Duration
+	upstreamFailures int
+	interval         time.Duration
+	seen             map[string]bool
+	done             chan struct{}
+}
+
+func New(config *Config, statusProvider StatusProvider) *Notifier {
+
+	if config == nil {
+		panic("config is required")
+	}
+
+	if statusProvider == nil {
+		panic("statusProvider is required")
+	}
+
+	config = config.Clone()
+
+	n := &Notifier{
+		statusProvider:   statusProvider,
+		providerFailing:  defaultProviderFailing,
+		upstreamFailures: defaultUpstreamFailures,
+		interval:         defaultInterval,
+		done:             make(chan struct{}),
+	}
+
+	if config.ProviderFailing > 0 {
+		n.providerFailing = config.ProviderFailing
+	}
+
+	if config.UpstreamFailures > 0 {
+		n.upstreamFailures = config.UpstreamFailures
+	}
+
+	if config.Interval > 0 {
+		n.interval = config.Interval
+	}
+
+	for _, webhook := range config.Webhooks {
+		n.webhooks = append(n.webhooks, newWebhook(webhook))
+	}
+
+	return n
+}
+
+// HandleEvents sends notifications for new hostnames and changed IPs. It has
+// the signature of a dns event handler.
+func (t *Notifier) HandleEvents(events []*RecordEvent) {
+
+	for _, event := range events {
+
+		if event.Type != "A" && event.Type != "AAAA" {
+			continue
+		}
+
+		switch event.Action {
+
+		case types.RecordAdded:
+			if !t.isNew(event.Name, events) {
+				continue
+			}
+			t.notify(&Notification{
+				Event:    EventNewHostname,
+				Time:     event.Time,
+				Title:    "New hostname " + strings.TrimSuffix(event.Name, "."),
+				Message:  fmt.Sprintf("%s was seen for the first time with %s %s from %s", strings.TrimSuffix(event.Name, "."), event.Type, event.New, event.SRC),
+				Name:     event.Name,
+				New:      event.New,
+				SRC:      event.SRC,
+				Provider: event.Provider,
+			})
+
+		case types.RecordChanged:
+			t.notify(&Notification{
+				Event:    EventIPChanged,
+				Time:     event.Time,
+				Title:    "IP changed for " + strings.TrimSuffix(event.Name, "."),
+				Message:  fmt.Sprintf("%s %s changed from %s to %s", strings.TrimSuffix(event.Name, "."), event.Type, event.Old, event.New),
+				Name:     event.Name,
+				Old:      event.Old,
+				New:      event.New,
+				SRC:      event.SRC,
+				Provider: event.Provider,
+			})
+		}
+	}
+}
+
+// isNew returns true the first time a name is seen. The names known when the
+// first events arrive, other than those the events add, are the baseline.
+func (t *Notifier) isNew(name string, events []*RecordEvent) bool {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.seen == nil {
+
+		added := make(map[string]bool)
+		for _, event := range events {
+			if event.Action == types.RecordAdded {
+				added[event.Name] = true
+			}
+		}
+
+		t.seen = make(map[string]bool)
+		records := t.statusProvider.GetRecords()
+
+		for _, r := range append(records.ARecords, records.AAAARecords...) {
+			if !added[r.GetKey()] {
+				t.seen[r.GetKey()] = true
+			}
+		}
+	}
+
+	if t.seen[name] {
+		return false
+	}
+
+	t.seen[name] = true
+	return true
+}
+
+// Run sends the queued notifications and checks provider and upstream status
+// until the context is done
+func (t *Notifier) Run(ctx context.Context) error {
+
+	defer close(t.done)
+
+	for _, webhook := range t.webhooks {
+		go webhook.run(t.done)
+	}
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+
+		case <-ctx.Done():
+			return nil
+
+		case <-ticker.C:
+			t.checkStatus()
+
+		}
+	}
+}
+
+func (t *Notifier) checkStatus() {
+
+	now := time.Now()
+
+	for _, status := range t.statusProvider.GetProviderStatus() {
+
+		if status.FailingSince.IsZero() || now.Sub(status.FailingSince) < t.providerFailing {
+			continue
+		}
+
+		t.notify(&Notification{
+			Event:    EventProviderFailing,
+			Time:     now,
+			Title:    "Provider " + status.Name + " is failing",
+			Message:  fmt.Sprintf("Refresh for %s has been failing since %s; error %s", status.Name, status.FailingSince.Format(time.RFC3339), status.LastError),
+			Name:     status.Name,
+			Provider: status.Name,
+		})
+	}
+
+	for _, status := range t.statusProvider.GetUpstreamStatus() {
+
+		if status.Failures < t.upstreamFailures {
+			continue
+		}
+
+		t.notify(&Notification{
+			Event:   EventUpstreamDown,
+			Time:    now,
+			Title:   "Nameserver " + status.Nameserver + " is down",
+			Message: fmt.Sprintf("Nameserver %s has failed %d times since %s; error %s", status.Nameserver, status.Failures, status.FailingSince.Format(time.RFC3339), status.LastError),
+			Name:    status.Nameserver,
+		})
+	}
+}
+
+func (t *Notifier) notify(n *Notification) {
+
+	sent := false
+
+	for _, webhook := range t.webhooks {
+		if webhook.accept(n) {
+			sent = true
+			webhook.enqueue(n)
+		}
+	}
+
+	if sent {
+		zap.L().Info(fmt.Sprintf("Notification %s: %s", n.Event, n.Message))
+	}
+}
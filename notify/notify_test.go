@@ -0,0 +1,362 @@
+package notify
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jodydadescott/home-server/types"
+)
+
+var now = time.Date(2023, 10, 17, 20, 0, 0, 0, time.UTC)
+
+// request is what a receiver was sent
+type request struct {
+	contentType string
+	title       string
+	body        string
+}
+
+// receiver is a webhook endpoint that fails the number of requests it is told
+// to before it succeeds
+type receiver struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	fail     int
+	attempts int
+	requests chan *request
+}
+
+func newReceiver(t *testing.T, fail int) *receiver {
+
+	r := &receiver{fail: fail, requests: make(chan *request, 10)}
+
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+
+		r.mutex.Lock()
+		r.attempts++
+		attempt := r.attempts
+		r.mutex.Unlock()
+
+		if attempt <= r.fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := io.ReadAll(req.Body)
+		r.requests <- &request{contentType: req.Header.Get("Content-Type"), title: req.Header.Get("Title"), body: string(body)}
+	}))
+
+	t.Cleanup(r.Close)
+
+	return r
+}
+
+func (t *receiver) getAttempts() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.attempts
+}
+
+// next returns the next request or nil if there is not one in time
+func (t *receiver) next(timeout time.Duration) *request {
+
+	select {
+	case r := <-t.requests:
+		return r
+	default:
+	}
+
+	select {
+	case r := <-t.requests:
+		return r
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+// statusProvider has the nas as its only record
+type statusProvider struct {
+	providers []*ProviderStatus
+	upstreams []*UpstreamStatus
+}
+
+func (t *statusProvider) GetRecords() *DomainRecords {
+	records := &DomainRecords{}
+	records.AddARecords(&types.ARecord{Hostname: "nas", Domain: "home", IP: "192.168.1.10"})
+	return records
+}
+
+func (t *statusProvider) GetProviderStatus() []*ProviderStatus { return t.providers }
+func (t *statusProvider) GetUpstreamStatus() []*UpstreamStatus { return t.upstreams }
+
+// run runs the notifier until the test ends
+func run(t *testing.T, n *Notifier) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		n.Run(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestPresets(t *testing.T) {
+
+	n := &Notification{
+		Event:   EventIPChanged,
+		Time:    now,
+		Title:   "IP changed for nas.home",
+		Message: "nas.home A changed from 192.168.1.10 to 192.168.1.11",
+		Name:    "nas.home.",
+		Old:     "192.168.1.10",
+		New:     "192.168.1.11",
+	}
+
+	tests := []struct {
+		preset      string
+		template    string
+		contentType string
+		title       string
+		body        string
+	}{
+		{
+			preset:      "",
+			contentType: "application/json",
+			body:        `{"event":"ip-changed","time":"2023-10-17T20:00:00Z","title":"IP changed for nas.home","message":"nas.home A changed from 192.168.1.10 to 192.168.1.11","name":"nas.home.","old":"192.168.1.10","new":"192.168.1.11"}`,
+		},
+		{
+			preset:      PresetGeneric,
+			template:    `{"host": {{ json .Name }}, "ip": "{{ .New }}"}`,
+			contentType: "application/json",
+			body:        `{"host": "nas.home.", "ip": "192.168.1.11"}`,
+		},
+		{
+			preset:      PresetNtfy,
+			contentType: "text/plain",
+			title:       "IP changed for nas.home",
+			body:        "nas.home A changed from 192.168.1.10 to 192.168.1.11",
+		},
+		{
+			preset:      PresetGotify,
+			contentType: "application/json",
+			body:        `{"message":"nas.home A changed from 192.168.1.10 to 192.168.1.11","priority":5,"title":"IP changed for nas.home"}`,
+		},
+		{
+			preset:      PresetSlack,
+			contentType: "application/json",
+			body:        `{"text":"*IP changed for nas.home*\nnas.home A changed from 192.168.1.10 to 192.168.1.11"}`,
+		},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.preset, func(t *testing.T) {
+
+			r := newReceiver(t, 0)
+
+			newWebhook(&WebhookConfig{URL: r.URL, Preset: test.preset, Template: test.template}).send(n, nil)
+
+			got := r.next(time.Second)
+			if got == nil {
+				t.Fatal("expected a request")
+			}
+
+			if got.contentType != test.contentType || got.title != test.title || got.body != test.body {
+				t.Errorf("expected %s %q %s, got %s %q %s", test.contentType, test.title, test.body, got.contentType, got.title, got.body)
+			}
+		})
+	}
+}
+
+func TestInvalidWebhook(t *testing.T) {
+
+	tests := map[string]*WebhookConfig{
+		"no URL":               {},
+		"invalid preset":       {URL: "http://localhost", Preset: "teams"},
+		"invalid event":        {URL: "http://localhost", Events: []string{"host-down"}},
+		"template with preset": {URL: "http://localhost", Preset: PresetSlack, Template: `{"text": "{{ .Message }}"}`},
+	}
+
+	for name, config := range tests {
+
+		t.Run(name, func(t *testing.T) {
+
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic")
+				}
+			}()
+
+			newWebhook(config)
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		fail     int
+		attempts int
+		sent     bool
+	}{
+		{"succeeds", 0, 1, true},
+		{"succeeds after retries", 2, 3, true},
+		{"fails", 5, 3, false},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			r := newReceiver(t, test.fail)
+
+			w := newWebhook(&WebhookConfig{URL: r.URL, Retries: 2, Backoff: time.Millisecond})
+			w.send(&Notification{Event: EventIPChanged, Time: now}, nil)
+
+			if attempts := r.getAttempts(); attempts != test.attempts {
+				t.Errorf("expected %d attempts, got %d", test.attempts, attempts)
+			}
+
+			if sent := r.next(0) != nil; sent != test.sent {
+				t.Errorf("expected sent %t, got %t", test.sent, sent)
+			}
+		})
+	}
+}
+
+func TestRetryDone(t *testing.T) {
+
+	r := newReceiver(t, 5)
+
+	done := make(chan struct{})
+	close(done)
+
+	// The backoff is not waited for once done is closed
+	w := newWebhook(&WebhookConfig{URL: r.URL, Retries: 2, Backoff: time.Hour})
+	w.send(&Notification{Event: EventIPChanged, Time: now}, done)
+
+	if attempts := r.getAttempts(); attempts != 1 {
+		t.Errorf("expected 1 attempt, got %d", attempts)
+	}
+}
+
+func TestAccept(t *testing.T) {
+
+	w := newWebhook(&WebhookConfig{URL: "http://localhost", Events: []string{EventIPChanged, EventUpstreamDown}, Dedupe: time.Minute})
+
+	tests := []struct {
+		name     string
+		n        *Notification
+		expected bool
+	}{
+		{"first", &Notification{Event: EventIPChanged, Name: "nas.home.", Time: now}, true},
+		{"in the dedupe window", &Notification{Event: EventIPChanged, Name: "nas.home.", Time: now.Add(time.Second * 59)}, false},
+		{"other name", &Notification{Event: EventIPChanged, Name: "printer.home.", Time: now.Add(time.Second * 59)}, true},
+		{"other event", &Notification{Event: EventUpstreamDown, Name: "nas.home.", Time: now.Add(time.Second * 59)}, true},
+		{"after the dedupe window", &Notification{Event: EventIPChanged, Name: "nas.home.", Time: now.Add(time.Minute)}, true},
+		{"not subscribed", &Notification{Event: EventNewHostname, Name: "tv.home.", Time: now}, false},
+	}
+
+	for _, test := range tests {
+		if got := w.accept(test.n); got != test.expected {
+			t.Errorf("%s: expected %t, got %t", test.name, test.expected, got)
+		}
+	}
+}
+
+func TestQueue(t *testing.T) {
+
+	w := newWebhook(&WebhookConfig{URL: "http://localhost"})
+
+	// Nothing is sending so the queue fills up and the rest are dropped
+	for i := 0; i < queueSize+10; i++ {
+		w.enqueue(&Notification{Event: EventIPChanged, Time: now})
+	}
+
+	if len(w.queue) != queueSize {
+		t.Errorf("expected %d queued, got %d", queueSize, len(w.queue))
+	}
+}
+
+func TestHandleEvents(t *testing.T) {
+
+	r := newReceiver(t, 0)
+
+	n := New(&Config{Webhooks: []*WebhookConfig{{URL: r.URL, Template: `{{ .Event }} {{ .Name }}`}}}, &statusProvider{})
+	run(t, n)
+
+	// The nas is in the records when the first events arrive
+	n.HandleEvents([]*RecordEvent{
+		{Time: now, Action: types.RecordAdded, Type: "A", Name: "printer.home.", New: "192.168.1.50"},
+		{Time: now, Action: types.RecordAdded, Type: "PTR", Name: "50.1.168.192.in-addr.arpa.", New: "printer.home."},
+		{Time: now, Action: types.RecordChanged, Type: "A", Name: "nas.home.", Old: "192.168.1.10", New: "192.168.1.11"},
+	})
+
+	// The nas and the printer are not new when an AAAA record is added
+	n.HandleEvents([]*RecordEvent{
+		{Time: now.Add(time.Hour), Action: types.RecordAdded, Type: "AAAA", Name: "printer.home.", New: "2001:db8::50"},
+		{Time: now.Add(time.Hour), Action: types.RecordAdded, Type: "AAAA", Name: "nas.home.", New: "2001:db8::10"},
+		{Time: now.Add(time.Hour), Action: types.RecordAdded, Type: "A", Name: "tv.home.", New: "192.168.1.60"},
+	})
+
+	var got []string
+	for req := r.next(time.Second); req != nil; req = r.next(time.Millisecond * 100) {
+		got = append(got, req.body)
+	}
+
+	expected := "new-hostname printer.home., ip-changed nas.home., new-hostname tv.home."
+	if strings.Join(got, ", ") != expected {
+		t.Errorf("expected %s, got %s", expected, strings.Join(got, ", "))
+	}
+}
+
+func TestCheckStatus(t *testing.T) {
+
+	r := newReceiver(t, 0)
+
+	status := &statusProvider{
+		providers: []*ProviderStatus{
+			{Name: "unifi", FailingSince: time.Now().Add(-time.Hour), LastError: "timeout"},
+			{Name: "docker", FailingSince: time.Now().Add(-time.Minute), LastError: "timeout"},
+			{Name: "static"},
+		},
+		upstreams: []*UpstreamStatus{
+			{Nameserver: "1.1.1.1:53", Failures: 3, FailingSince: time.Now().Add(-time.Minute)},
+			{Nameserver: "8.8.8.8:53", Failures: 2, FailingSince: time.Now().Add(-time.Minute)},
+			{Nameserver: "9.9.9.9:53", Healthy: true},
+		},
+	}
+
+	n := New(&Config{
+		ProviderFailing: time.Minute * 15,
+		Interval:        time.Millisecond * 10,
+		Webhooks:        []*WebhookConfig{{URL: r.URL, Template: `{{ .Event }} {{ .Name }}`}},
+	}, status)
+
+	run(t, n)
+
+	// The status is checked on each interval but only sent once in the dedupe
+	// window
+	var got []string
+	for req := r.next(time.Second); req != nil; req = r.next(time.Millisecond * 100) {
+		got = append(got, req.body)
+	}
+
+	expected := "provider-failing unifi, upstream-down 1.1.1.1:53"
+	if strings.Join(got, ", ") != expected {
+		t.Errorf("expected %s, got %s", expected, strings.Join(got, ", "))
+	}
+}
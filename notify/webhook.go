@@ -0,0 +1,277 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jodydadescott/home-server/types"
+)
+
+type WebhookConfig = types.WebhookConfig
+
+const (
+	PresetGeneric = "generic"
+	PresetNtfy    = "ntfy"
+	PresetGotify  = "gotify"
+	PresetSlack   = "slack"
+
+	defaultRetries = 3
+	defaultBackoff = time.Second * 5
+	defaultDedupe  = time.Minute * 10
+	requestTimeout = time.Second * 10
+	queueSize      = 100
+)
+
+var httpClient = &http.Client{Timeout: requestTimeout}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+type webhook struct {
+	mutex    sync.Mutex
+	name     string
+	url      string
+	preset   string
+	template *template.Template
+	headers  map[string]string
+	events   map[string]bool
+	retries  int
+	backoff  time.Duration
+	dedupe   time.Duration
+	sent     map[string]time.Time
+	queue    chan *Notification
+}
+
+func newWebhook(config *WebhookConfig) *webhook {
+
+	if config.URL == "" {
+		panic("webhook URL is required")
+	}
+
+	w := &webhook{
+		name:    config.Name,
+		url:     config.URL,
+		preset:  strings.ToLower(config.Preset),
+		headers: config.Headers,
+		retries: defaultRetries,
+		backoff: defaultBackoff,
+		dedupe:  defaultDedupe,
+		sent:    make(map[string]time.Time),
+		queue:   make(chan *Notification, queueSize),
+	}
+
+	if w.name == "" {
+		w.name = config.URL
+	}
+
+	switch w.preset {
+
+	case PresetGeneric, PresetNtfy, PresetGotify, PresetSlack:
+
+	case "":
+		w.preset = PresetGeneric
+
+	default:
+		panic(fmt.Sprintf("webhook %s preset %s is invalid", w.name, config.Preset))
+	}
+
+	if config.Template != "" {
+		if w.preset != PresetGeneric {
+			panic(fmt.Sprintf("webhook %s template is only for the generic preset; preset is %s", w.name, w.preset))
+		}
+		w.template = template.Must(template.New(w.name).Funcs(templateFuncs).Parse(config.Template))
+	}
+
+	if len(config.Events) > 0 {
+		w.events = make(map[string]bool)
+		for _, event := range config.Events {
+			switch event {
+			case EventNewHostname, EventIPChanged, EventProviderFailing, EventUpstreamDown:
+				w.events[event] = true
+			default:
+				panic(fmt.Sprintf("webhook %s event %s is invalid", w.name, event))
+			}
+		}
+	}
+
+	if config.Retries > 0 {
+		w.retries = config.Retries
+	}
+
+	if config.Backoff > 0 {
+		w.backoff = config.Backoff
+	}
+
+	if config.Dedupe > 0 {
+		w.dedupe = config.Dedupe
+	}
+
+	return w
+}
+
+// accept returns true if the webhook wants the notification and it has not
+// been sent within the dedupe window
+func (t *webhook) accept(n *Notification) bool {
+
+	if t.events != nil && !t.events[n.Event] {
+		return false
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := n.Event + ":" + n.Name
+
+	if last, exist := t.sent[key]; exist && n.Time.Sub(last) < t.dedupe {
+		zap.L().Debug(fmt.Sprintf("Webhook %s already sent %s for %s", t.name, n.Event, n.Name))
+		return false
+	}
+
+	t.sent[key] = n.Time
+
+	for k, v := range t.sent {
+		if n.Time.Sub(v) >= t.dedupe {
+			delete(t.sent, k)
+		}
+	}
+
+	return true
+}
+
+// body returns the request body and content type for the notification
+func (t *webhook) body(n *Notification) ([]byte, string, error) {
+
+	switch t.preset {
+
+	case PresetNtfy:
+		return []byte(n.Message), "text/plain", nil
+
+	case PresetGotify:
+		b, err := json.Marshal(map[string]any{
+			"title":    n.Title,
+			"message":  n.Message,
+			"priority": 5,
+		})
+		return b, "application/json", err
+
+	case PresetSlack:
+		b, err := json.Marshal(map[string]string{
+			"text": "*" + n.Title + "*\n" + n.Message,
+		})
+		return b, "application/json", err
+
+	}
+
+	if t.template == nil {
+		b, err := json.Marshal(n)
+		return b, "application/json", err
+	}
+
+	var buf bytes.Buffer
+	err := t.template.Execute(&buf, n)
+	return buf.Bytes(), "application/json", err
+}
+
+// enqueue queues the notification to be sent. If the queue is full, such as
+// when the endpoint has been down for a while, the notification is dropped.
+func (t *webhook) enqueue(n *Notification) {
+	select {
+	case t.queue <- n:
+	default:
+		zap.L().Warn(fmt.Sprintf("Webhook %s queue is full; dropping %s for %s", t.name, n.Event, n.Name))
+	}
+}
+
+// run sends the queued notifications one at a time until done is closed
+func (t *webhook) run(done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case n := <-t.queue:
+			t.send(n, done)
+		}
+	}
+}
+
+// send posts the notification, retrying with exponential backoff. It returns
+// early if done is closed.
+func (t *webhook) send(n *Notification, done <-chan struct{}) {
+
+	body, contentType, err := t.body(n)
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("Webhook %s failed to create body; error %s", t.name, err.Error()))
+		return
+	}
+
+	backoff := t.backoff
+
+	for attempt := 0; ; attempt++ {
+
+		err = t.post(n, body, contentType)
+		if err == nil {
+			zap.L().Debug(fmt.Sprintf("Webhook %s sent %s for %s", t.name, n.Event, n.Name))
+			return
+		}
+
+		if attempt >= t.retries {
+			zap.L().Error(fmt.Sprintf("Webhook %s failed after %d attempts; error %s", t.name, attempt+1, err.Error()))
+			return
+		}
+
+		zap.L().Debug(fmt.Sprintf("Webhook %s failed; retrying in %s; error %s", t.name, backoff.String(), err.Error()))
+
+		select {
+		case <-done:
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+}
+
+func (t *webhook) post(n *Notification, body []byte, contentType string) error {
+
+	req, err := http.NewRequest(http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+
+	if t.preset == PresetNtfy {
+		req.Header.Set("Title", n.Title)
+		req.Header.Set("Tags", n.Event)
+	}
+
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package remote
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// step is a map key or, if key is empty, a list index
+type step struct {
+	key   string
+	index int
+}
+
+// parsePath parses the subset of JSONPath made of keys separated by dots with
+// optional list indexes, such as $.data.hosts or results[0].primary_ip.address.
+// The leading $ is optional.
+func parsePath(path string) ([]step, error) {
+
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+
+	var steps []step
+
+	if path == "" {
+		return steps, nil
+	}
+
+	for _, segment := range strings.Split(path, ".") {
+
+		key := segment
+		var indexes []string
+
+		if i := strings.Index(segment, "["); i >= 0 {
+			key = segment[:i]
+			rest := segment[i:]
+			for rest != "" {
+				end := strings.Index(rest, "]")
+				if !strings.HasPrefix(rest, "[") || end < 0 {
+					return nil, fmt.Errorf("path %s is invalid", path)
+				}
+				indexes = append(indexes, rest[1:end])
+				rest = rest[end+1:]
+			}
+		}
+
+		if key == "" && len(indexes) == 0 {
+			return nil, fmt.Errorf("path %s is invalid", path)
+		}
+
+		if key != "" {
+			steps = append(steps, step{key: key})
+		}
+
+		for _, v := range indexes {
+			index, err := strconv.Atoi(v)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("path %s has an invalid index %s", path, v)
+			}
+			steps = append(steps, step{index: index})
+		}
+	}
+
+	return steps, nil
+}
+
+// lookup returns the value at the path in the document
+func lookup(doc any, steps []step) (any, bool) {
+
+	current := doc
+
+	for _, s := range steps {
+
+		if s.key != "" {
+			m, ok := current.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			current, ok = m[s.key]
+			if !ok {
+				return nil, false
+			}
+			continue
+		}
+
+		list, ok := current.([]any)
+		if !ok || s.index >= len(list) {
+			return nil, false
+		}
+		current = list[s.index]
+	}
+
+	return current, true
+}
+
+// normalize converts the maps decoded from YAML to the map type decoded from
+// JSON so both can be looked up the same way
+func normalize(v any) any {
+
+	switch x := v.(type) {
+
+	case map[any]any:
+		m := make(map[string]any, len(x))
+		for k, v := range x {
+			m[fmt.Sprint(k)] = normalize(v)
+		}
+		return m
+
+	case map[string]any:
+		for k, v := range x {
+			x[k] = normalize(v)
+		}
+		return x
+
+	case []any:
+		for i, v := range x {
+			x[i] = normalize(v)
+		}
+		return x
+
+	}
+
+	return v
+}
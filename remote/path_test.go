@@ -0,0 +1,78 @@
+package remote
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+
+	tests := []struct {
+		path  string
+		steps []step
+	}{
+		{"", nil},
+		{"$", nil},
+		{"$.a[0].b", []step{{key: "a"}, {index: 0}, {key: "b"}}},
+		{"a[0].b", []step{{key: "a"}, {index: 0}, {key: "b"}}},
+		{"$.data.hosts", []step{{key: "data"}, {key: "hosts"}}},
+		{"rows[1][2]", []step{{key: "rows"}, {index: 1}, {index: 2}}},
+		{"[0].ip", []step{{index: 0}, {key: "ip"}}},
+	}
+
+	for _, test := range tests {
+
+		steps, err := parsePath(test.path)
+		if err != nil {
+			t.Errorf("%s: %s", test.path, err.Error())
+			continue
+		}
+
+		if len(steps) != len(test.steps) || (len(steps) > 0 && !reflect.DeepEqual(steps, test.steps)) {
+			t.Errorf("%s: expected %+v, got %+v", test.path, test.steps, steps)
+		}
+	}
+
+	for _, path := range []string{"a[x]", "a[-1]", "a[0", "a]0[", "a..b", "$.a.", "a[0]b"} {
+		if _, err := parsePath(path); err == nil {
+			t.Errorf("expected an error for %s", path)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+
+	var doc any
+	if err := json.Unmarshal([]byte(`{"a":[{"b":"nas"},{"b":null}],"c":"d"}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path  string
+		value any
+		found bool
+	}{
+		{"$.a[0].b", "nas", true},
+		{"a[1].b", nil, true},
+		{"$.c", "d", true},
+		{"a[2].b", nil, false},
+		{"a[0].missing", nil, false},
+		{"missing", nil, false},
+		{"c[0]", nil, false},
+		{"c.d", nil, false},
+	}
+
+	for _, test := range tests {
+
+		steps, err := parsePath(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		value, found := lookup(doc, steps)
+		if found != test.found || value != test.value {
+			t.Errorf("%s: expected %v %t, got %v %t", test.path, test.value, test.found, value, found)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package remote
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+
+	"github.com/jodydadescott/home-server/types"
+	"github.com/jodydadescott/home-server/util"
+)
+
+type Config = types.RemoteConfig
+type Source = types.RemoteSource
+type ARecord = types.ARecord
+type PTRrecord = types.PTRrecord
+type Records = types.DomainRecords
+
+const (
+	source = "remote"
+
+	FormatRecords = "records"
+	FormatList    = "list"
+
+	defaultRefresh       = time.Minute * 5
+	defaultHostnameField = "hostname"
+	defaultIPField       = "ip"
+	requestTimeout       = time.Second * 30
+	maxBodySize          = 16 << 20
+)
+
+// Client is a provider for the records returned by a URL
+type Client struct {
+	mutex         sync.Mutex
+	url           string
+	name          string
+	domain        string
+	refresh       time.Duration
+	priority      int
+	format        string
+	path          []step
+	hostnameField []step
+	ipField       []step
+	domainField   []step
+	username      string
+	password      string
+	token         string
+	httpClient    *http.Client
+	etag          string
+	lastModified  string
+	records       *Records
+}
+
+func New(config *Config) []*Client {
+
+	if config == nil {
+		panic("config is required")
+	}
+
+	config = config.Clone()
+
+	var clients []*Client
+
+	for _, s := range config.Sources {
+		clients = append(clients, newClient(s))
+	}
+
+	return clients
+}
+
+func newClient(config *Source) *Client {
+
+	if config.URL == "" {
+		panic("remote source URL is required")
+	}
+
+	u, err := url.Parse(config.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		panic(fmt.Sprintf("remote source URL %s is invalid", config.URL))
+	}
+
+	// The name is logged and shown over HTTP so it must not have credentials
+	u.User = nil
+
+	client := &Client{
+		url:      config.URL,
+		name:     source + ":" + u.String(),
+		domain:   types.DefaultDomain,
+		refresh:  defaultRefresh,
+		priority: config.Priority,
+		format:   FormatRecords,
+		username: config.Username,
+		password: config.Password,
+		token:    config.Token,
+	}
+
+	if config.Domain != "" {
+		client.domain = config.Domain
+	}
+
+	if config.Refresh > 0 {
+		client.refresh = config.Refresh
+	}
+
+	if config.Format != "" {
+		client.format = strings.ToLower(config.Format)
+	}
+
+	mustParsePath := func(path, fallback string) []step {
+		if path == "" {
+			path = fallback
+		}
+		steps, err := parsePath(path)
+		if err != nil {
+			panic(fmt.Sprintf("remote source %s: %s", client.name, err.Error()))
+		}
+		return steps
+	}
+
+	switch client.format {
+
+	case FormatRecords:
+
+	case FormatList:
+		client.path = mustParsePath(config.Path, "")
+		client.hostnameField = mustParsePath(config.HostnameField, defaultHostnameField)
+		client.ipField = mustParsePath(config.IPField, defaultIPField)
+		if config.DomainField != "" {
+			client.domainField = mustParsePath(config.DomainField, "")
+		}
+
+	default:
+		panic(fmt.Sprintf("remote source %s format %s is invalid", client.name, config.Format))
+
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if config.CAFile != "" {
+
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			panic(fmt.Sprintf("remote source %s CA file %s; error %s", client.name, config.CAFile, err.Error()))
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			panic(fmt.Sprintf("remote source %s CA file %s has no certificates", client.name, config.CAFile))
+		}
+
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	client.httpClient = &http.Client{Timeout: requestTimeout, Transport: transport}
+
+	return client
+}
+
+func (t *Client) GetName() string {
+	return t.name
+}
+
+func (t *Client) GetDomainName() string {
+	return t.domain
+}
+
+func (t *Client) GetRefreshDuration() time.Duration {
+	return t.refresh
+}
+
+// GetPriority implements dns.Prioritized
+func (t *Client) GetPriority() int {
+	return t.priority
+}
+
+// GetRecords fetches the URL. The ETag and Last-Modified of the last response
+// are sent so an unchanged document is not fetched again.
+func (t *Client) GetRecords() (*Records, error) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	req, err := http.NewRequest(http.MethodGet, t.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json, application/yaml;q=0.9")
+
+	switch {
+
+	case t.token != "":
+		req.Header.Set("Authorization", "Bearer "+t.token)
+
+	case t.username != "":
+		req.SetBasicAuth(t.username, t.password)
+
+	}
+
+	if t.records != nil {
+		if t.etag != "" {
+			req.Header.Set("If-None-Match", t.etag)
+		}
+		if t.lastModified != "" {
+			req.Header.Set("If-Modified-Since", t.lastModified)
+		}
+	}
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && t.records != nil {
+		zap.L().Debug(fmt.Sprintf("%s is not modified", t.name))
+		return t.records, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", t.name, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := t.decode(body, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", t.name, err.Error())
+	}
+
+	t.records = records
+	t.etag = resp.Header.Get("ETag")
+	t.lastModified = resp.Header.Get("Last-Modified")
+
+	return records, nil
+}
+
+// isYAML returns true if the content type is YAML. Other content types are
+// decoded as JSON.
+func isYAML(contentType string) bool {
+	return strings.Contains(strings.ToLower(contentType), "yaml")
+}
+
+func (t *Client) decode(body []byte, contentType string) (*Records, error) {
+
+	if t.format == FormatRecords {
+
+		records := &Records{}
+
+		var err error
+		if isYAML(contentType) {
+			err = yaml.Unmarshal(body, records)
+		} else {
+			err = json.Unmarshal(body, records)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		t.setSRC(records)
+		return records, nil
+	}
+
+	var doc any
+
+	var err error
+	if isYAML(contentType) {
+		err = yaml.Unmarshal(body, &doc)
+	} else {
+		err = json.Unmarshal(body, &doc)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return t.getRecords(normalize(doc))
+}
+
+// setSRC sets the SRC of records that do not have one
+func (t *Client) setSRC(records *Records) {
+
+	src := t.name
+
+	for _, r := range records.ARecords {
+		if r.SRC == "" {
+			r.SRC = src
+		}
+	}
+
+	for _, r := range records.AAAARecords {
+		if r.SRC == "" {
+			r.SRC = src
+		}
+	}
+
+	for _, r := range records.CnameRecords {
+		if r.SRC == "" {
+			r.SRC = src
+		}
+	}
+
+	for _, r := range records.PtrRecords {
+		if r.SRC == "" {
+			r.SRC = src
+		}
+	}
+
+	for _, r := range records.SrvRecords {
+		if r.SRC == "" {
+			r.SRC = src
+		}
+	}
+
+	for _, r := range records.TxtRecords {
+		if r.SRC == "" {
+			r.SRC = src
+		}
+	}
+}
+
+// getRecords returns the A or AAAA and PTR records for the hosts in a list.
+// An IP may have a prefix length as in 10.0.0.5/24. Items without a hostname
+// or a valid IP are skipped.
+func (t *Client) getRecords(doc any) (*Records, error) {
+
+	value, ok := lookup(doc, t.path)
+	if !ok {
+		return nil, fmt.Errorf("path was not found")
+	}
+
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("path is not a list")
+	}
+
+	records := &Records{}
+
+	getString := func(item any, path []step) string {
+		v, ok := lookup(item, path)
+		if !ok || v == nil {
+			return ""
+		}
+		return strings.TrimSpace(fmt.Sprint(v))
+	}
+
+	for i, item := range list {
+
+		hostname := getString(item, t.hostnameField)
+		ip := strings.Split(getString(item, t.ipField), "/")[0]
+
+		if hostname == "" {
+			zap.L().Debug(fmt.Sprintf("%s item %d does not have a hostname", t.name, i))
+			continue
+		}
+
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			zap.L().Debug(fmt.Sprintf("%s item %d with hostname %s does not have a valid IP", t.name, i, hostname))
+			continue
+		}
+
+		domain := t.domain
+		if t.domainField != nil {
+			if v := getString(item, t.domainField); v != "" {
+				domain = strings.TrimSuffix(v, ".")
+			}
+		}
+
+		a := &ARecord{
+			Hostname: hostname,
+			Domain:   domain,
+			IP:       parsed.String(),
+			SRC:      t.name,
+		}
+
+		if parsed.To4() != nil {
+			records.AddARecords(a)
+		} else {
+			records.AddAAAARecords(a)
+		}
+
+		arpa, err := util.GetARPA(parsed.String())
+		if err != nil {
+			zap.L().Debug(fmt.Sprintf("%s item %d has an invalid IP; error %s", t.name, i, err.Error()))
+			continue
+		}
+
+		records.AddPtrRecords(&PTRrecord{
+			ARPA:     arpa,
+			Hostname: hostname,
+			Domain:   domain,
+			SRC:      t.name,
+		})
+	}
+
+	return records, nil
+}
@@ -0,0 +1,287 @@
+package remote
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const recordsJSON = `{
+  "aRecords": [{"hostname": "nas", "domain": "home", "ip": "192.168.1.10"}],
+  "cnameRecords": [{"aliasHostname": "files", "aliasDomain": "home", "targetHostname": "nas", "targetDomain": "home", "src": "netbox"}]
+}`
+
+const recordsYAML = `aRecords:
+  - hostname: nas
+    domain: home
+    ip: 192.168.1.10
+cnameRecords:
+  - aliasHostname: files
+    aliasDomain: home
+    targetHostname: nas
+    targetDomain: home
+    src: netbox
+`
+
+// The printer has no IP, the second item has no name and the IPs have prefix
+// lengths as they do in NetBox
+const listJSON = `{
+  "results": [
+    {"name": "nas", "primary_ip": {"address": "192.168.1.10/24"}, "tenant": {"slug": "lab"}},
+    {"name": "nas6", "primary_ip": {"address": "2001:db8::10/64"}},
+    {"name": "printer", "primary_ip": null},
+    {"primary_ip": {"address": "192.168.1.30/24"}}
+  ]
+}`
+
+const listYAML = `results:
+  - name: nas
+    primary_ip:
+      address: 192.168.1.10/24
+    tenant:
+      slug: lab
+  - name: nas6
+    primary_ip:
+      address: 2001:db8::10/64
+  - name: printer
+    primary_ip:
+  - primary_ip:
+      address: 192.168.1.30/24
+`
+
+func recordsString(records *Records) string {
+
+	var s []string
+
+	for _, r := range records.ARecords {
+		s = append(s, "A "+r.Hostname+"."+r.Domain+"="+r.IP+" "+r.SRC)
+	}
+	for _, r := range records.AAAARecords {
+		s = append(s, "AAAA "+r.Hostname+"."+r.Domain+"="+r.IP+" "+r.SRC)
+	}
+	for _, r := range records.CnameRecords {
+		s = append(s, "CNAME "+r.AliasHostname+"."+r.AliasDomain+"="+r.TargetHostname+"."+r.TargetDomain+" "+r.SRC)
+	}
+	for _, r := range records.PtrRecords {
+		s = append(s, "PTR "+r.ARPA+"="+r.Hostname+"."+r.Domain)
+	}
+
+	sort.Strings(s)
+	return strings.Join(s, "\n")
+}
+
+func serve(contentType, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte(body))
+	}
+}
+
+func TestGetRecords(t *testing.T) {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/records.json", serve("application/json", recordsJSON))
+	mux.HandleFunc("/records.yaml", serve("application/yaml", recordsYAML))
+	mux.HandleFunc("/list.json", serve("application/json; charset=utf-8", listJSON))
+	mux.HandleFunc("/list.yaml", serve("text/yaml", listYAML))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	src := "remote:" + server.URL
+
+	records := "A nas.home=192.168.1.10 " + src + "/records.%s\n" +
+		"CNAME files.home=nas.home netbox"
+
+	list := "A nas.lab=192.168.1.10 " + src + "/list.%s\n" +
+		"AAAA nas6.lan=2001:db8::10 " + src + "/list.%s\n" +
+		"PTR 0.1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.=nas6.lan\n" +
+		"PTR 10.1.168.192.in-addr.arpa.=nas.lab"
+
+	for _, ext := range []string{"json", "yaml"} {
+
+		tests := []struct {
+			source   *Source
+			expected string
+		}{
+			{
+				source:   &Source{URL: server.URL + "/records." + ext},
+				expected: strings.ReplaceAll(records, "%s", ext),
+			},
+			{
+				source: &Source{
+					URL:           server.URL + "/list." + ext,
+					Domain:        "lan",
+					Format:        FormatList,
+					Path:          "$.results",
+					HostnameField: "name",
+					IPField:       "primary_ip.address",
+					DomainField:   "tenant.slug",
+				},
+				expected: strings.ReplaceAll(list, "%s", ext),
+			},
+		}
+
+		for _, test := range tests {
+
+			t.Run(test.source.URL, func(t *testing.T) {
+
+				records, err := New(&Config{Sources: []*Source{test.source}})[0].GetRecords()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got := recordsString(records); got != test.expected {
+					t.Errorf("expected\n%s\ngot\n%s", test.expected, got)
+				}
+			})
+		}
+	}
+
+	// The path must be a list
+	client := New(&Config{Sources: []*Source{{URL: server.URL + "/list.json", Format: FormatList, Path: "results[0]"}}})[0]
+	if _, err := client.GetRecords(); err == nil || !strings.HasSuffix(err.Error(), "path is not a list") {
+		t.Errorf("expected a path error, got %v", err)
+	}
+
+	client = New(&Config{Sources: []*Source{{URL: server.URL + "/list.json", Format: FormatList, Path: "hosts"}}})[0]
+	if _, err := client.GetRecords(); err == nil || !strings.HasSuffix(err.Error(), "path was not found") {
+		t.Errorf("expected a path error, got %v", err)
+	}
+}
+
+func TestGetRecordsNotModified(t *testing.T) {
+
+	const etag = `"v1"`
+	const lastModified = "Tue, 17 Oct 2023 20:00:00 GMT"
+
+	var mutex sync.Mutex
+	var requests []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		mutex.Lock()
+		requests = append(requests, r.Header.Get("If-None-Match")+"|"+r.Header.Get("If-Modified-Since"))
+		mutex.Unlock()
+
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		serve("application/json", recordsJSON)(w, r)
+	}))
+	defer server.Close()
+
+	client := New(&Config{Sources: []*Source{{URL: server.URL}}})[0]
+
+	first, err := client.GetRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := client.GetRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second != first {
+		t.Error("expected the cached records for a 304")
+	}
+
+	expected := []string{"|", etag + "|" + lastModified}
+	if strings.Join(requests, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected the requests %v, got %v", expected, requests)
+	}
+}
+
+func TestGetRecordsAuth(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		username, password, basic := r.BasicAuth()
+
+		switch {
+
+		case r.Header.Get("Authorization") == "Bearer secret":
+
+		case basic && username == "admin" && password == "secret":
+
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+
+		}
+
+		serve("application/json", recordsJSON)(w, r)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		source *Source
+		err    string
+	}{
+		{"bearer", &Source{URL: server.URL, Token: "secret"}, ""},
+		{"basic", &Source{URL: server.URL, Username: "admin", Password: "secret"}, ""},
+		{"token before basic", &Source{URL: server.URL, Token: "secret", Username: "admin", Password: "wrong"}, ""},
+		{"wrong password", &Source{URL: server.URL, Username: "admin", Password: "wrong"}, "401 Unauthorized"},
+		{"none", &Source{URL: server.URL}, "401 Unauthorized"},
+	}
+
+	for _, test := range tests {
+
+		t.Run(test.name, func(t *testing.T) {
+
+			_, err := New(&Config{Sources: []*Source{test.source}})[0].GetRecords()
+
+			if test.err == "" && err != nil {
+				t.Fatal(err)
+			}
+
+			if test.err != "" && (err == nil || !strings.HasSuffix(err.Error(), test.err)) {
+				t.Fatalf("expected an error ending with %s, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestGetRecordsCAFile(t *testing.T) {
+
+	server := httptest.NewTLSServer(serve("application/json", recordsJSON))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(&Config{Sources: []*Source{{URL: server.URL}}})[0].GetRecords(); err == nil {
+		t.Error("expected the certificate to not be trusted without the CA file")
+	}
+
+	records, err := New(&Config{Sources: []*Source{{URL: server.URL, CAFile: caFile}}})[0].GetRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records.ARecords) != 1 {
+		t.Errorf("expected 1 A record, got %d", len(records.ARecords))
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for a CA file without certificates")
+		}
+	}()
+
+	New(&Config{Sources: []*Source{{URL: server.URL, CAFile: "remote_test.go"}}})
+}
@@ -2,22 +2,36 @@ package server
 
 import (
 	"context"
+	"fmt"
 
 	logger "github.com/jodydadescott/jody-go-logger"
 	"go.uber.org/zap"
 
+	"github.com/jodydadescott/home-server/audit"
 	"github.com/jodydadescott/home-server/dns"
+	"github.com/jodydadescott/home-server/docker"
+	"github.com/jodydadescott/home-server/homeassistant"
+	"github.com/jodydadescott/home-server/hosts"
 	"github.com/jodydadescott/home-server/http"
+	"github.com/jodydadescott/home-server/lease"
+	"github.com/jodydadescott/home-server/mdns"
+	"github.com/jodydadescott/home-server/memory"
+	"github.com/jodydadescott/home-server/neighbor"
+	"github.com/jodydadescott/home-server/notify"
+	"github.com/jodydadescott/home-server/remote"
 	"github.com/jodydadescott/home-server/static"
 	"github.com/jodydadescott/home-server/types"
 	"github.com/jodydadescott/home-server/unifi"
+	"github.com/jodydadescott/home-server/zone"
 )
 
 type Config = types.Config
 
 type Server struct {
-	dns  *dns.Server
-	http *http.Server
+	dns       *dns.Server
+	http      *http.Server
+	notify    *notify.Notifier
+	responder *mdns.Responder
 }
 
 func New(config *Config) *Server {
@@ -34,18 +48,84 @@ func New(config *Config) *Server {
 	}
 
 	dnsConfig := &dns.Config{
-		Listeners:   config.Listeners,
-		Nameservers: config.Nameservers,
-		Trace:       trace,
+		Listeners:      config.Listeners,
+		Nameservers:    config.Nameservers,
+		Trace:          trace,
+		ConflictPolicy: config.ConflictPolicy,
+		Shuffle:        config.ShuffleAnswers,
+		Views:          config.Views,
+		ACL:            config.ACL,
 	}
 
-	if config.Unifi != nil && config.Unifi.Enabled {
-		zap.L().Debug("Unifi is enabled")
-		dnsConfig.AddProvider(unifi.New(config.Unifi))
+	if config.ACL != nil {
+		zap.L().Debug("ACL is enabled")
 	} else {
+		zap.L().Debug("ACL is not enabled")
+	}
+
+	if len(config.Views) > 0 {
+		for _, view := range config.Views {
+			zap.L().Debug(fmt.Sprintf("view %s is enabled", view.Name))
+		}
+	} else {
+		zap.L().Debug("views are not enabled")
+	}
+
+	unifiConfigs := config.UnifiControllers
+	if config.Unifi != nil {
+		unifiConfigs = append([]*types.UnifiConfig{config.Unifi}, unifiConfigs...)
+	}
+
+	for _, unifiConfig := range unifiConfigs {
+
+		if !unifiConfig.Enabled {
+			zap.L().Debug(fmt.Sprintf("Unifi controller %s is not enabled", unifiConfig.Hostname))
+			continue
+		}
+
+		zap.L().Debug(fmt.Sprintf("Unifi controller %s is enabled", unifiConfig.Hostname))
+		for _, v := range unifi.New(unifiConfig) {
+			dnsConfig.AddProvider(v)
+		}
+	}
+
+	if len(unifiConfigs) == 0 {
 		zap.L().Debug("Unifi is not enabled")
 	}
 
+	var auditLog *audit.Log
+
+	if config.Audit != nil && config.Audit.Enabled {
+		zap.L().Debug("audit log is enabled")
+		auditLog = audit.New(config.Audit)
+		dnsConfig.AddEventHandler(auditLog.Append)
+	} else {
+		zap.L().Debug("audit log is not enabled")
+	}
+
+	// The notifier needs the DNS server for status so it is created after the
+	// server. Events are not produced until the server is running.
+	var notifier *notify.Notifier
+
+	if config.Notify != nil && config.Notify.Enabled {
+		zap.L().Debug("notifications are enabled")
+		dnsConfig.AddEventHandler(func(events []*types.RecordEvent) {
+			notifier.HandleEvents(events)
+		})
+	} else {
+		zap.L().Debug("notifications are not enabled")
+	}
+
+	var runtime *memory.Client
+
+	if config.Runtime != nil && config.Runtime.Enabled {
+		zap.L().Debug("runtime records are enabled")
+		runtime = memory.New(config.Runtime)
+		dnsConfig.AddProvider(runtime)
+	} else {
+		zap.L().Debug("runtime records are not enabled")
+	}
+
 	if config.Static != nil && config.Static.Enabled {
 		zap.L().Debug("static config is enabled")
 		for _, v := range static.New(config.Static) {
@@ -55,16 +135,111 @@ func New(config *Config) *Server {
 		zap.L().Debug("static config is not enabled")
 	}
 
+	if config.Leases != nil && config.Leases.Enabled {
+		zap.L().Debug("lease files are enabled")
+		for _, v := range lease.New(config.Leases) {
+			dnsConfig.AddProvider(v)
+		}
+	} else {
+		zap.L().Debug("lease files are not enabled")
+	}
+
+	if config.Hosts != nil && config.Hosts.Enabled {
+		zap.L().Debug("hosts files are enabled")
+		dnsConfig.AddProvider(hosts.New(config.Hosts))
+	} else {
+		zap.L().Debug("hosts files are not enabled")
+	}
+
+	if config.Zones != nil && config.Zones.Enabled {
+		zap.L().Debug("zone files are enabled")
+		for _, v := range zone.New(config.Zones) {
+			dnsConfig.AddProvider(v)
+		}
+	} else {
+		zap.L().Debug("zone files are not enabled")
+	}
+
+	if config.Remote != nil && config.Remote.Enabled {
+		zap.L().Debug("remote sources are enabled")
+		for _, v := range remote.New(config.Remote) {
+			dnsConfig.AddProvider(v)
+		}
+	} else {
+		zap.L().Debug("remote sources are not enabled")
+	}
+
+	if config.Docker != nil && config.Docker.Enabled {
+		zap.L().Debug("Docker is enabled")
+		dnsConfig.AddProvider(docker.New(config.Docker))
+	} else {
+		zap.L().Debug("Docker is not enabled")
+	}
+
+	if config.HomeAssistant != nil && config.HomeAssistant.Enabled {
+		zap.L().Debug("Home Assistant is enabled")
+		dnsConfig.AddProvider(homeassistant.New(config.HomeAssistant))
+	} else {
+		zap.L().Debug("Home Assistant is not enabled")
+	}
+
+	if config.MDNS != nil && config.MDNS.Enabled {
+		zap.L().Debug("mDNS bridge is enabled")
+		dnsConfig.AddProvider(mdns.New(config.MDNS))
+	} else {
+		zap.L().Debug("mDNS bridge is not enabled")
+	}
+
+	// The neighbor provider learns MACs from the records of the DNS server so
+	// the server is set as its record source after the server is created.
+	var neighbors *neighbor.Client
+
+	if config.Neighbors != nil && config.Neighbors.Enabled {
+		zap.L().Debug("neighbor tables are enabled")
+		neighbors = neighbor.New(config.Neighbors)
+		dnsConfig.AddProvider(neighbors)
+	} else {
+		zap.L().Debug("neighbor tables are not enabled")
+	}
+
 	s := &Server{
 		dns: dns.New(dnsConfig),
 	}
 
+	if neighbors != nil {
+		neighbors.SetRecordSource(s.dns)
+	}
+
+	if config.Notify != nil && config.Notify.Enabled {
+		notifier = notify.New(config.Notify, s.dns)
+		s.notify = notifier
+	}
+
+	if config.MDNSResponder != nil && config.MDNSResponder.Enabled {
+		zap.L().Debug("mDNS responder is enabled")
+		s.responder = mdns.NewResponder(config.MDNSResponder, s.dns)
+	} else {
+		zap.L().Debug("mDNS responder is not enabled")
+	}
+
 	if config.HttpConfig != nil && config.HttpConfig.Enabled {
 		zap.L().Debug("HTTP Server is enabled")
 
 		httpConfig := &http.Config{
-			Listener:       config.HttpConfig.Listener,
-			RecordProvider: s.dns,
+			Listener:        config.HttpConfig.Listener,
+			RecordProvider:  s.dns,
+			StatusProvider:  s.dns,
+			EventSource:     s.dns,
+			ConflictSource:  s.dns,
+			CollisionSource: s.dns,
+		}
+
+		if runtime != nil {
+			httpConfig.RecordEditor = runtime
+		}
+
+		if auditLog != nil {
+			httpConfig.AuditLog = auditLog
 		}
 
 		s.http = http.New(httpConfig)
@@ -78,14 +253,18 @@ func New(config *Config) *Server {
 
 func (t *Server) Run(ctx context.Context) error {
 
-	errs := make(chan error, 2)
+	errs := make(chan error, 4)
 
 	dnsCtx, dnsCancel := context.WithCancel(ctx)
 	httpCtx, httpCancel := context.WithCancel(ctx)
+	notifyCtx, notifyCancel := context.WithCancel(ctx)
+	responderCtx, responderCancel := context.WithCancel(ctx)
 
 	defer func() {
 		dnsCancel()
 		httpCancel()
+		notifyCancel()
+		responderCancel()
 	}()
 
 	go func() {
@@ -104,6 +283,24 @@ func (t *Server) Run(ctx context.Context) error {
 		}()
 	}
 
+	if t.notify != nil {
+		go func() {
+			err := t.notify.Run(notifyCtx)
+			if err != nil {
+				errs <- err
+			}
+		}()
+	}
+
+	if t.responder != nil {
+		go func() {
+			err := t.responder.Run(responderCtx)
+			if err != nil {
+				errs <- err
+			}
+		}()
+	}
+
 	select {
 
 	case err := <-errs:
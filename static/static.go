@@ -19,7 +19,8 @@ const (
 )
 
 type Client struct {
-	domain *Domain
+	domain   *Domain
+	priority int
 }
 
 func New(config *Config) []*Client {
@@ -40,7 +41,7 @@ func New(config *Config) []*Client {
 			domain.Domain = types.DefaultDomain
 		}
 
-		clients = append(clients, &Client{domain: domain})
+		clients = append(clients, &Client{domain: domain, priority: config.Priority})
 	}
 
 	return clients
@@ -58,6 +59,16 @@ func (t *Client) GetRefreshDuration() time.Duration {
 	return 0
 }
 
+// GetPriority implements dns.Prioritized
+func (t *Client) GetPriority() int {
+	return t.priority
+}
+
+// Static implements dns.Static
+func (t *Client) Static() bool {
+	return true
+}
+
 func (t *Client) GetRecords() (*Records, error) {
 
 	ptrRecordsMap := make(map[string]*PTRrecord)
@@ -15,6 +15,59 @@ const (
 	DefaultDnsDomain = "home"
 	DefaultRefresh   = time.Hour
 	DefaultHTTPPort  = 8080
+	DefaultAuditFile = "/var/lib/home-server/audit.log"
+)
+
+const (
+	RecordAdded   = "added"
+	RecordRemoved = "removed"
+	RecordChanged = "changed"
+)
+
+// Conflict policies for names that more than one provider has records for.
+// Static providers are the ones with records that are set by hand which are the
+// static config, hosts files, zone files and runtime records.
+const (
+	ConflictPolicyFirstWins              = "first-wins"
+	ConflictPolicyStaticOverridesDynamic = "static-overrides-dynamic"
+	ConflictPolicyAll                    = "all"
+)
+
+// Unifi collision handling for clients with the same name. Number adds -2, -3
+// and so on to the names after the first in order of MAC, MAC adds the last six
+// digits of the MAC and merge gives them the same name so the name has all of
+// their IPs.
+const (
+	UnifiCollisionsNumber = "number"
+	UnifiCollisionsMAC    = "mac"
+	UnifiCollisionsMerge  = "merge"
+)
+
+// Unifi rule actions and the kinds of records the rules apply to
+const (
+	UnifiRuleInclude = "include"
+	UnifiRuleExclude = "exclude"
+
+	UnifiSourceClient    = "client"
+	UnifiSourceInterface = "interface"
+	UnifiSourceDevice    = "device"
+)
+
+// Unifi IPv6 policies for which of the IPv6 addresses of a client have AAAA
+// records
+const (
+	UnifiIPv6Global = "global"
+	UnifiIPv6Stable = "stable"
+	UnifiIPv6All    = "all"
+	UnifiIPv6None   = "none"
+)
+
+// Answers for a query for a blocked domain. Null answers A queries with
+// 0.0.0.0 and AAAA queries with ::.
+const (
+	BlockPolicyNXDomain = "nxdomain"
+	BlockPolicyNull     = "null"
+	BlockPolicyRefused  = "refused"
 )
 
 var space = regexp.MustCompile(`\s+`)
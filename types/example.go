@@ -1,6 +1,8 @@
 package types
 
 import (
+	"time"
+
 	"github.com/jodydadescott/home-server/types/proto"
 	logger "github.com/jodydadescott/jody-go-logger"
 )
@@ -38,10 +40,10 @@ func NewExampleConfig() *Config {
 		TargetDomain:   DefaultDomain,
 	})
 
-	static := &StaticConfig{Enabled: true}
+	static := &StaticConfig{Enabled: true, Priority: 100}
 	static.AddDomains(d)
 
-	unifiConfig := &UnifiConfig{}
+	unifiConfig := &UnifiConfig{Name: "main"}
 	unifiConfig.Hostname = "https://10.0.1.1"
 	unifiConfig.Username = "homeauto"
 	unifiConfig.Password = "******"
@@ -49,9 +51,81 @@ func NewExampleConfig() *Config {
 
 	unifiConfig.Enabled = true
 	unifiConfig.Refresh = DefaultRefresh
+	unifiConfig.AllIPs = true
+	unifiConfig.Retention = time.Hour * 24
+	unifiConfig.StateFile = "/var/lib/home-server/unifi-state.json"
+	unifiConfig.KnownClients = true
+	unifiConfig.IPv6Policy = UnifiIPv6Stable
+	unifiConfig.IPv6Prefix = "2001:db8:0:ab00::/56"
 
 	unifiConfig.AddIgnoreMacs("60:22:32:9f:0f:fd")
 
+	yes := true
+	unifiConfig.AddRules(
+		&UnifiRule{Action: UnifiRuleInclude, Name: "(?i)^printer"},
+		&UnifiRule{Action: UnifiRuleExclude, Sources: []string{UnifiSourceClient}, Guest: &yes},
+		&UnifiRule{Action: UnifiRuleExclude, Sources: []string{UnifiSourceClient}, RandomMAC: &yes, Wired: new(bool)},
+		&UnifiRule{Action: UnifiRuleExclude, OUI: "00:17:88"},
+	)
+
+	unifiConfig.NetworkSubdomains = true
+	unifiConfig.SubdomainFallback = "other"
+	unifiConfig.AddSubdomainMap("Default", "").AddSubdomainMap("IoT Devices", "iot")
+
+	workshop := &UnifiConfig{Name: "workshop", Domain: "workshop.home", Enabled: true}
+	workshop.Hostname = "https://10.9.0.1"
+	workshop.Username = "homeauto"
+	workshop.Password = "******"
+	workshop.AddSites("default", "lab")
+	workshop.NameTemplate = "{{if .Name}}{{.Name}}{{else if .Hostname}}{{.Hostname}}{{else}}{{.OUI}}-{{.MAC}}{{end}}"
+	workshop.Collisions = UnifiCollisionsMAC
+
+	leases := &LeaseConfig{Enabled: true}
+
+	leases.AddFiles(&LeaseFile{
+		Path:   "/var/lib/misc/dnsmasq.leases",
+		Format: "dnsmasq",
+		Domain: "iot.home",
+	})
+
+	hosts := &HostsConfig{Enabled: true, Domain: "home"}
+	hosts.AddFiles("/etc/home-server/legacy.hosts")
+
+	zones := &ZoneConfig{Enabled: true}
+	zones.AddFiles(&ZoneFile{Path: "/etc/home-server/lab.zone", Origin: "lab.home"})
+
+	neighbors := &NeighborConfig{Enabled: true, IPv6: true, Learn: true}
+	neighbors.AddHost("b8:27:eb:12:34:56", "pi-hole")
+
+	mdns := &MDNSConfig{Enabled: true, Services: true}
+	mdns.AddInterfaces("eth0").AddBrowse("_ipp._tcp", "_googlecast._tcp")
+
+	remote := &RemoteConfig{Enabled: true}
+	remote.AddSources(
+		&RemoteSource{URL: "https://inventory.home/api/records", Token: "secret"},
+		&RemoteSource{
+			URL:           "http://netbox.home/api/ipam/ip-addresses/",
+			Format:        "list",
+			Path:          "$.results",
+			HostnameField: "dns_name",
+			IPField:       "address",
+		},
+	)
+
+	docker := &DockerConfig{Enabled: true, Network: "bridge"}
+
+	homeAssistant := &HomeAssistantConfig{
+		Enabled:      true,
+		URL:          "http://homeassistant.home:8123",
+		Token:        "******",
+		Domain:       "iot.home",
+		Registry:     true,
+		NameTemplate: "{{if .Area}}{{.Area}}-{{end}}{{.Name}}",
+	}
+
+	mdnsResponder := &MDNSResponderConfig{Enabled: true}
+	mdnsResponder.AddInterfaces("eth0").AddDomains("home")
+
 	listener1 := &NetPort{
 		Port:  53,
 		Proto: proto.UDP,
@@ -63,9 +137,20 @@ func NewExampleConfig() *Config {
 	}
 
 	c := &Config{
-		Notes:  "PTR records will automatically be created",
-		Unifi:  unifiConfig,
-		Static: static,
+		Notes:          "PTR records will automatically be created",
+		Unifi:          unifiConfig,
+		Static:         static,
+		Leases:         leases,
+		Hosts:          hosts,
+		Zones:          zones,
+		Neighbors:      neighbors,
+		MDNS:           mdns,
+		MDNSResponder:  mdnsResponder,
+		Remote:         remote,
+		Docker:         docker,
+		HomeAssistant:  homeAssistant,
+		ConflictPolicy: ConflictPolicyFirstWins,
+		ShuffleAnswers: true,
 		Logging: &Logger{
 			LogLevel: logger.DebugLevel,
 		},
@@ -73,6 +158,8 @@ func NewExampleConfig() *Config {
 
 	c.AddListeners(listener1, listener2)
 
+	c.AddUnifiControllers(workshop)
+
 	c.AddNameservers(&NetPort{
 		IP:    "8.8.8.8",
 		Port:  53,
@@ -91,6 +178,61 @@ func NewExampleConfig() *Config {
 		Proto: proto.TCP,
 	})
 
+	guest := &ViewConfig{Name: "guest", BlockPolicy: BlockPolicyNull}
+	guest.AddNetworks("192.168.30.0/24").AddBlocklist("doubleclick.net", "tracking.example.com")
+	guest.AddNameservers(&NetPort{
+		IP:    "1.1.1.3",
+		Port:  53,
+		Proto: proto.UDP,
+	})
+
+	trusted := &ViewConfig{Name: "trusted"}
+	trusted.AddNetworks("192.168.1.0/24").AddProviders("*")
+
+	vpn := &ViewConfig{Name: "vpn"}
+	vpn.AddNetworks("10.8.0.0/24", "fd00:8::/64").AddProviders("static", "unifi")
+	vpn.AddForwards((&ForwardRule{Domain: "corp.example.com"}).AddNameservers(&NetPort{
+		IP:    "10.0.0.53",
+		Port:  53,
+		Proto: proto.UDP,
+	}))
+
+	c.AddViews(guest, trusted, vpn)
+
+	c.ACL = &ACLConfig{
+		Recursion: (&ACLRule{}).AddDeny("192.168.20.0/24"),
+	}
+	c.ACL.AddAllow("127.0.0.0/8", "::1", "192.168.0.0/16", "10.8.0.0/24", "fd00::/8")
+	c.ACL.AddDeny("192.168.99.0/24")
+
+	c.Runtime = &RuntimeConfig{
+		Enabled: true,
+		Domain:  "home",
+	}
+
+	c.Audit = &AuditConfig{
+		Enabled: true,
+		File:    DefaultAuditFile,
+	}
+
+	c.Notify = &NotifyConfig{
+		Enabled:         true,
+		ProviderFailing: time.Minute * 15,
+	}
+
+	c.Notify.AddWebhooks(&WebhookConfig{
+		Name:   "phone",
+		URL:    "https://ntfy.sh/my-home-server",
+		Preset: "ntfy",
+		Events: []string{"new-hostname", "upstream-down"},
+	})
+
+	c.Notify.AddWebhooks(&WebhookConfig{
+		Name:     "node-red",
+		URL:      "http://10.0.1.20:1880/home-server",
+		Template: `{"event":{{json .Event}},"host":{{json .Name}},"ip":{{json .New}}}`,
+	})
+
 	c.HttpConfig = &HttpConfig{
 		Enabled: true,
 		Listener: &NetPort{
@@ -2,6 +2,7 @@ package types
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -49,11 +50,14 @@ func (t *NetPort) GetIPColonPort() string {
 
 // ARecord is a DNS A Record
 type ARecord struct {
-	Domain   string `json:"domain,omitempty" yaml:"domain,omitempty"`
-	Hostname string `json:"hostname,omitempty" yaml:"hostname,omitempty"`
-	IP       string `json:"ip,omitempty" yaml:"ip,omitempty"`
-	SRC      string `json:"src,omitempty" yaml:"src,omitempty"`
-	fqdn     string `json:"-"`
+	Domain   string     `json:"domain,omitempty" yaml:"domain,omitempty"`
+	Hostname string     `json:"hostname,omitempty" yaml:"hostname,omitempty"`
+	IP       string     `json:"ip,omitempty" yaml:"ip,omitempty"`
+	MAC      string     `json:"mac,omitempty" yaml:"mac,omitempty"`
+	SRC      string     `json:"src,omitempty" yaml:"src,omitempty"`
+	Stale    bool       `json:"stale,omitempty" yaml:"stale,omitempty"`
+	LastSeen *time.Time `json:"lastSeen,omitempty" yaml:"lastSeen,omitempty"`
+	fqdn     string     `json:"-"`
 }
 
 // Clone return copy
@@ -112,11 +116,13 @@ func (t *CNameRecord) GetValue() string {
 
 // PTRrecord is a DNS PTR Record
 type PTRrecord struct {
-	ARPA     string `json:"arpa,omitempty" yaml:"arpa,omitempty"`
-	Hostname string `json:"hostname,omitempty" yaml:"hostname,omitempty"`
-	Domain   string `json:"domain,omitempty" yaml:"domain,omitempty"`
-	SRC      string `json:"src,omitempty" yaml:"src,omitempty"`
-	fqdn     string `json:"-"`
+	ARPA     string     `json:"arpa,omitempty" yaml:"arpa,omitempty"`
+	Hostname string     `json:"hostname,omitempty" yaml:"hostname,omitempty"`
+	Domain   string     `json:"domain,omitempty" yaml:"domain,omitempty"`
+	SRC      string     `json:"src,omitempty" yaml:"src,omitempty"`
+	Stale    bool       `json:"stale,omitempty" yaml:"stale,omitempty"`
+	LastSeen *time.Time `json:"lastSeen,omitempty" yaml:"lastSeen,omitempty"`
+	fqdn     string     `json:"-"`
 }
 
 // Clone return copy
@@ -139,15 +145,37 @@ func (t *PTRrecord) GetValue() string {
 	return t.fqdn
 }
 
-// Config is the main user level config
+// Config is the main user level config. ConflictPolicy is how a name that more
+// than one provider has records for is answered and is one of first-wins (the
+// default), static-overrides-dynamic or all. Providers are asked in order of
+// their Priority, highest first, and then in the order they are configured. If
+// ShuffleAnswers is set the A and AAAA records for a name with more than one
+// IP are answered in a random order.
 type Config struct {
-	Notes       string        `json:"notes,omitempty" yaml:"notes,omitempty"`
-	Unifi       *UnifiConfig  `json:"unifiConfig,omitempty" yaml:"unifiConfig,omitempty"`
-	Listeners   []*NetPort    `json:"listeners,omitempty" yaml:"listeners,omitempty"`
-	Static      *StaticConfig `json:"static,omitempty" yaml:"static,omitempty"`
-	Nameservers []*NetPort    `json:"nameservers,omitempty" yaml:"nameservers,omitempty"`
-	Logging     *Logger       `json:"logging,omitempty" yaml:"logging,omitempty"`
-	HttpConfig  *HttpConfig   `json:"httpConfig,omitempty" yaml:"httpConfig,omitempty"`
+	Notes            string               `json:"notes,omitempty" yaml:"notes,omitempty"`
+	Unifi            *UnifiConfig         `json:"unifiConfig,omitempty" yaml:"unifiConfig,omitempty"`
+	Listeners        []*NetPort           `json:"listeners,omitempty" yaml:"listeners,omitempty"`
+	Static           *StaticConfig        `json:"static,omitempty" yaml:"static,omitempty"`
+	Nameservers      []*NetPort           `json:"nameservers,omitempty" yaml:"nameservers,omitempty"`
+	Logging          *Logger              `json:"logging,omitempty" yaml:"logging,omitempty"`
+	HttpConfig       *HttpConfig          `json:"httpConfig,omitempty" yaml:"httpConfig,omitempty"`
+	Runtime          *RuntimeConfig       `json:"runtime,omitempty" yaml:"runtime,omitempty"`
+	Audit            *AuditConfig         `json:"audit,omitempty" yaml:"audit,omitempty"`
+	Notify           *NotifyConfig        `json:"notify,omitempty" yaml:"notify,omitempty"`
+	Leases           *LeaseConfig         `json:"leases,omitempty" yaml:"leases,omitempty"`
+	Hosts            *HostsConfig         `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+	Zones            *ZoneConfig          `json:"zones,omitempty" yaml:"zones,omitempty"`
+	Neighbors        *NeighborConfig      `json:"neighbors,omitempty" yaml:"neighbors,omitempty"`
+	MDNS             *MDNSConfig          `json:"mdns,omitempty" yaml:"mdns,omitempty"`
+	MDNSResponder    *MDNSResponderConfig `json:"mdnsResponder,omitempty" yaml:"mdnsResponder,omitempty"`
+	Remote           *RemoteConfig        `json:"remote,omitempty" yaml:"remote,omitempty"`
+	Docker           *DockerConfig        `json:"docker,omitempty" yaml:"docker,omitempty"`
+	HomeAssistant    *HomeAssistantConfig `json:"homeAssistant,omitempty" yaml:"homeAssistant,omitempty"`
+	UnifiControllers []*UnifiConfig       `json:"unifiControllers,omitempty" yaml:"unifiControllers,omitempty"`
+	ConflictPolicy   string               `json:"conflictPolicy,omitempty" yaml:"conflictPolicy,omitempty"`
+	ShuffleAnswers   bool                 `json:"shuffleAnswers,omitempty" yaml:"shuffleAnswers,omitempty"`
+	Views            []*ViewConfig        `json:"views,omitempty" yaml:"views,omitempty"`
+	ACL              *ACLConfig           `json:"acl,omitempty" yaml:"acl,omitempty"`
 }
 
 // HttpConfig is the config for HTTP servers
@@ -178,6 +206,22 @@ func (t *Config) AddNameservers(nameservers ...*NetPort) *Config {
 	return t
 }
 
+// AddUnifiControllers adds Unifi controllers in addition to the one in Unifi
+func (t *Config) AddUnifiControllers(controllers ...*UnifiConfig) *Config {
+	for _, v := range controllers {
+		t.UnifiControllers = append(t.UnifiControllers, v)
+	}
+	return t
+}
+
+// AddViews adds split-horizon views in the order their networks are checked
+func (t *Config) AddViews(views ...*ViewConfig) *Config {
+	for _, v := range views {
+		t.Views = append(t.Views, v)
+	}
+	return t
+}
+
 // AddNameserver adds the specified nameserver to the config
 func (t *Config) AddListeners(listeners ...*NetPort) *Config {
 	for _, v := range listeners {
@@ -189,10 +233,48 @@ func (t *Config) AddListeners(listeners ...*NetPort) *Config {
 // UnifiConfig is the config for Unifi servers
 type UnifiConfig struct {
 	unifi.Config
+	// Name identifies the controller in provider names such as
+	// unifi:main/default and defaults to the host of the controller
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Sites are the short names of the sites and default to the default site
+	Sites      []string      `json:"sites,omitempty" yaml:"sites,omitempty"`
 	Refresh    time.Duration `json:"refresh,omitempty" yaml:"refresh,omitempty"`
 	Enabled    bool          `json:"enabled,omitempty" yaml:"enabled,omitempty"`
 	Domain     string        `json:"domain,omitempty" yaml:"domain,omitempty"`
 	IgnoreMacs []string      `json:"ignoreMacs,omitempty" yaml:"ignoreMacs,omitempty"`
+	// AllIPs adds records for the fixed IPs of clients and the LAN IPs of
+	// devices
+	AllIPs   bool `json:"allIps,omitempty" yaml:"allIps,omitempty"`
+	Priority int  `json:"priority,omitempty" yaml:"priority,omitempty"`
+
+	// NetworkSubdomains puts each client in a subdomain of Domain named after
+	// its network
+	NetworkSubdomains bool `json:"networkSubdomains,omitempty" yaml:"networkSubdomains,omitempty"`
+	// SubdomainMap maps network names to subdomains. An empty subdomain is
+	// Domain itself.
+	SubdomainMap map[string]string `json:"subdomainMap,omitempty" yaml:"subdomainMap,omitempty"`
+	// SubdomainFallback is the subdomain for clients whose network is not known
+	SubdomainFallback string `json:"subdomainFallback,omitempty" yaml:"subdomainFallback,omitempty"`
+
+	// Retention is how long the records of an offline client are kept
+	Retention time.Duration `json:"retention,omitempty" yaml:"retention,omitempty"`
+	// StateFile keeps the retained records across restarts
+	StateFile string `json:"stateFile,omitempty" yaml:"stateFile,omitempty"`
+	// KnownClients adds records for the fixed IPs of offline clients
+	KnownClients bool `json:"knownClients,omitempty" yaml:"knownClients,omitempty"`
+
+	// NameTemplate is a Go template for the hostname of a client
+	NameTemplate string `json:"nameTemplate,omitempty" yaml:"nameTemplate,omitempty"`
+	// Collisions is number, mac or merge
+	Collisions string `json:"collisions,omitempty" yaml:"collisions,omitempty"`
+
+	// Rules are checked in order and the first one that matches decides
+	Rules []*UnifiRule `json:"rules,omitempty" yaml:"rules,omitempty"`
+
+	// IPv6Policy is global, stable, all or none
+	IPv6Policy string `json:"ipv6Policy,omitempty" yaml:"ipv6Policy,omitempty"`
+	// IPv6Prefix is the prefix delegated by the ISP
+	IPv6Prefix string `json:"ipv6Prefix,omitempty" yaml:"ipv6Prefix,omitempty"`
 }
 
 // Clone return copy
@@ -210,6 +292,32 @@ func (t *UnifiConfig) AddIgnoreMacs(macs ...string) *UnifiConfig {
 	return t
 }
 
+// AddRules is a convenience function that adds the specified rules
+func (t *UnifiConfig) AddRules(rules ...*UnifiRule) *UnifiConfig {
+	for _, v := range rules {
+		t.Rules = append(t.Rules, v)
+	}
+	return t
+}
+
+// AddSites is a convenience function that adds the specified sites
+func (t *UnifiConfig) AddSites(sites ...string) *UnifiConfig {
+	for _, v := range sites {
+		t.Sites = append(t.Sites, v)
+	}
+	return t
+}
+
+// AddSubdomainMap is a convenience function that maps a Unifi network name to
+// a subdomain
+func (t *UnifiConfig) AddSubdomainMap(network, subdomain string) *UnifiConfig {
+	if t.SubdomainMap == nil {
+		t.SubdomainMap = make(map[string]string)
+	}
+	t.SubdomainMap[network] = subdomain
+	return t
+}
+
 // IgnoreMac is a convenience function that returns true if the MAC exist in the ignore slice
 func (t *UnifiConfig) IgnoreMac(mac string) bool {
 	mac = strings.ToLower(mac)
@@ -221,10 +329,33 @@ func (t *UnifiConfig) IgnoreMac(mac string) bool {
 	return false
 }
 
+// UnifiRule includes or excludes the Unifi clients, interfaces and devices it
+// matches. Action is include or exclude and Sources is the kinds it applies to
+// which are client, interface and device or all of them if it is empty. A rule
+// matches if all of the conditions that are set match. MAC is a glob such as
+// da:a1:19:*, OUI is a MAC prefix such as 00:17:88, Name is a regular
+// expression for the name or hostname, Network is the name of the network and
+// VLAN is its VLAN. Wired, Guest and RandomMAC match wired or wireless clients,
+// guests and clients with a locally administered MAC as phones use for
+// privacy.
+type UnifiRule struct {
+	Action    string   `json:"action,omitempty" yaml:"action,omitempty"`
+	Sources   []string `json:"sources,omitempty" yaml:"sources,omitempty"`
+	MAC       string   `json:"mac,omitempty" yaml:"mac,omitempty"`
+	OUI       string   `json:"oui,omitempty" yaml:"oui,omitempty"`
+	Name      string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Network   string   `json:"network,omitempty" yaml:"network,omitempty"`
+	VLAN      int      `json:"vlan,omitempty" yaml:"vlan,omitempty"`
+	Wired     *bool    `json:"wired,omitempty" yaml:"wired,omitempty"`
+	Guest     *bool    `json:"guest,omitempty" yaml:"guest,omitempty"`
+	RandomMAC *bool    `json:"randomMac,omitempty" yaml:"randomMac,omitempty"`
+}
+
 // StaticConfig are records from config that are statically defined
 type StaticConfig struct {
-	Enabled bool      `json:"enabled,omitempty" yaml:"enabled,omitempty"`
-	Domains []*Domain `json:"domains,omitempty" yaml:"domains,omitempty"`
+	Enabled  bool      `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Domains  []*Domain `json:"domains,omitempty" yaml:"domains,omitempty"`
+	Priority int       `json:"priority,omitempty" yaml:"priority,omitempty"`
 }
 
 // Clone return copy
@@ -250,11 +381,85 @@ func (t *Domain) Clone() *Domain {
 	return c
 }
 
+// SRVRecord is a DNS SRV Record. Name is the service instance relative to the
+// domain such as printer._ipp._tcp.
+type SRVRecord struct {
+	Name           string `json:"name,omitempty" yaml:"name,omitempty"`
+	Domain         string `json:"domain,omitempty" yaml:"domain,omitempty"`
+	TargetHostname string `json:"targetHostname,omitempty" yaml:"targetHostname,omitempty"`
+	TargetDomain   string `json:"targetDomain,omitempty" yaml:"targetDomain,omitempty"`
+	Port           uint16 `json:"port,omitempty" yaml:"port,omitempty"`
+	Priority       uint16 `json:"priority,omitempty" yaml:"priority,omitempty"`
+	Weight         uint16 `json:"weight,omitempty" yaml:"weight,omitempty"`
+	SRC            string `json:"src,omitempty" yaml:"src,omitempty"`
+	fqdn           string `json:"-"`
+}
+
+// Clone return copy
+func (t *SRVRecord) Clone() *SRVRecord {
+	c := &SRVRecord{}
+	copier.Copy(&c, &t)
+	return c
+}
+
+// GetKey returns the key for the record type
+func (t *SRVRecord) GetKey() string {
+	if t.fqdn == "" {
+		t.fqdn = cleanHostname(t.Name) + "." + t.Domain + "."
+	}
+	return t.fqdn
+}
+
+// GetValue returns the value for the record type
+func (t *SRVRecord) GetValue() string {
+	return fmt.Sprintf("%d %d %d %s", t.Priority, t.Weight, t.Port, t.GetTarget())
+}
+
+// GetTarget returns the FQDN of the target
+func (t *SRVRecord) GetTarget() string {
+	return cleanHostname(t.TargetHostname) + "." + t.TargetDomain + "."
+}
+
+// TXTRecord is a DNS TXT Record. Name is relative to the domain.
+type TXTRecord struct {
+	Name   string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Domain string   `json:"domain,omitempty" yaml:"domain,omitempty"`
+	Text   []string `json:"text,omitempty" yaml:"text,omitempty"`
+	SRC    string   `json:"src,omitempty" yaml:"src,omitempty"`
+	fqdn   string   `json:"-"`
+}
+
+// Clone return copy
+func (t *TXTRecord) Clone() *TXTRecord {
+	c := &TXTRecord{}
+	copier.Copy(&c, &t)
+	return c
+}
+
+// GetKey returns the key for the record type
+func (t *TXTRecord) GetKey() string {
+	if t.fqdn == "" {
+		t.fqdn = cleanHostname(t.Name) + "." + t.Domain + "."
+	}
+	return t.fqdn
+}
+
+// GetValue returns the value for the record type. Each string is quoted.
+func (t *TXTRecord) GetValue() string {
+	var quoted []string
+	for _, v := range t.Text {
+		quoted = append(quoted, strconv.Quote(v))
+	}
+	return strings.Join(quoted, " ")
+}
+
 type DomainRecords struct {
 	ARecords     []*ARecord     `json:"aRecords,omitempty" yaml:"aRecords,omitempty"`
 	AAAARecords  []*ARecord     `json:"aaaRecords,omitempty" yaml:"aaaRecords,omitempty"`
 	CnameRecords []*CNameRecord `json:"cnameRecords,omitempty" yaml:"cnameRecords,omitempty"`
 	PtrRecords   []*PTRrecord   `json:"ptrRecords,omitempty" yaml:"ptrRecords,omitempty"`
+	SrvRecords   []*SRVRecord   `json:"srvRecords,omitempty" yaml:"srvRecords,omitempty"`
+	TxtRecords   []*TXTRecord   `json:"txtRecords,omitempty" yaml:"txtRecords,omitempty"`
 }
 
 // AddDomain is a convenience function that adds the specified Domaain to the StaticConfig
@@ -295,3 +500,642 @@ func (t *DomainRecords) AddCNameRecords(records ...*CNameRecord) *DomainRecords
 	}
 	return t
 }
+
+// AddSrvRecords is a convenience that adds the specified SRVRecords to the Domain
+func (t *DomainRecords) AddSrvRecords(records ...*SRVRecord) *DomainRecords {
+	for _, v := range records {
+		t.SrvRecords = append(t.SrvRecords, v)
+	}
+	return t
+}
+
+// AddTxtRecords is a convenience that adds the specified TXTRecords to the Domain
+func (t *DomainRecords) AddTxtRecords(records ...*TXTRecord) *DomainRecords {
+	for _, v := range records {
+		t.TxtRecords = append(t.TxtRecords, v)
+	}
+	return t
+}
+
+// RuntimeConfig is the config for records that are added at runtime over HTTP.
+// Runtime records are held in memory and are lost on restart.
+type RuntimeConfig struct {
+	Enabled  bool   `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Domain   string `json:"domain,omitempty" yaml:"domain,omitempty"`
+	Priority int    `json:"priority,omitempty" yaml:"priority,omitempty"`
+}
+
+// Clone return copy
+func (t *RuntimeConfig) Clone() *RuntimeConfig {
+	c := &RuntimeConfig{}
+	copier.Copy(&c, &t)
+	return c
+}
+
+// ProviderStatus is the refresh status of a record provider
+type ProviderStatus struct {
+	Name         string    `json:"name,omitempty" yaml:"name,omitempty"`
+	Domain       string    `json:"domain,omitempty" yaml:"domain,omitempty"`
+	Refresh      string    `json:"refresh,omitempty" yaml:"refresh,omitempty"`
+	LastRefresh  time.Time `json:"lastRefresh,omitempty" yaml:"lastRefresh,omitempty"`
+	LastSuccess  time.Time `json:"lastSuccess,omitempty" yaml:"lastSuccess,omitempty"`
+	LastError    string    `json:"lastError,omitempty" yaml:"lastError,omitempty"`
+	FailingSince time.Time `json:"failingSince,omitempty" yaml:"failingSince,omitempty"`
+	Priority     int       `json:"priority" yaml:"priority"`
+	Records      int       `json:"records" yaml:"records"`
+}
+
+// UpstreamStatus is the health of an upstream nameserver
+type UpstreamStatus struct {
+	Nameserver   string    `json:"nameserver,omitempty" yaml:"nameserver,omitempty"`
+	Proto        string    `json:"proto,omitempty" yaml:"proto,omitempty"`
+	Healthy      bool      `json:"healthy" yaml:"healthy"`
+	LastSuccess  time.Time `json:"lastSuccess,omitempty" yaml:"lastSuccess,omitempty"`
+	LastFailure  time.Time `json:"lastFailure,omitempty" yaml:"lastFailure,omitempty"`
+	LastError    string    `json:"lastError,omitempty" yaml:"lastError,omitempty"`
+	FailingSince time.Time `json:"failingSince,omitempty" yaml:"failingSince,omitempty"`
+	Failures     int       `json:"failures" yaml:"failures"`
+	View         string    `json:"view,omitempty" yaml:"view,omitempty"`
+}
+
+// ACLStatus is the number of queries refused by the ACL since the server
+// started. Denied is the queries from clients that are not allowed at all,
+// LocalDenied the queries for the local zones and RecursionDenied the queries
+// that would have been forwarded.
+type ACLStatus struct {
+	Denied          int       `json:"denied" yaml:"denied"`
+	LocalDenied     int       `json:"localDenied" yaml:"localDenied"`
+	RecursionDenied int       `json:"recursionDenied" yaml:"recursionDenied"`
+	LastDenied      time.Time `json:"lastDenied,omitempty" yaml:"lastDenied,omitempty"`
+	LastClient      string    `json:"lastClient,omitempty" yaml:"lastClient,omitempty"`
+}
+
+// QueryLogEntry is a single DNS question answered by the server
+type QueryLogEntry struct {
+	Time   time.Time `json:"time,omitempty" yaml:"time,omitempty"`
+	Client string    `json:"client,omitempty" yaml:"client,omitempty"`
+	Name   string    `json:"name,omitempty" yaml:"name,omitempty"`
+	Type   string    `json:"type,omitempty" yaml:"type,omitempty"`
+	Rcode  string    `json:"rcode,omitempty" yaml:"rcode,omitempty"`
+	Source string    `json:"source,omitempty" yaml:"source,omitempty"`
+	View   string    `json:"view,omitempty" yaml:"view,omitempty"`
+	Answer []string  `json:"answer,omitempty" yaml:"answer,omitempty"`
+}
+
+// RecordEvent is a change to a record found when a provider is refreshed
+type RecordEvent struct {
+	Time     time.Time `json:"time,omitempty" yaml:"time,omitempty"`
+	Action   string    `json:"action,omitempty" yaml:"action,omitempty"`
+	Type     string    `json:"type,omitempty" yaml:"type,omitempty"`
+	Name     string    `json:"name,omitempty" yaml:"name,omitempty"`
+	Old      string    `json:"old,omitempty" yaml:"old,omitempty"`
+	New      string    `json:"new,omitempty" yaml:"new,omitempty"`
+	SRC      string    `json:"src,omitempty" yaml:"src,omitempty"`
+	Provider string    `json:"provider,omitempty" yaml:"provider,omitempty"`
+}
+
+// Conflict is a name that more than one provider has records for
+type Conflict struct {
+	Name   string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Type   string   `json:"type,omitempty" yaml:"type,omitempty"`
+	Claims []*Claim `json:"claims,omitempty" yaml:"claims,omitempty"`
+}
+
+// Claim is the record a provider has for a conflicting name. Winner is true if
+// the record is used to answer queries for the name.
+type Claim struct {
+	Provider string `json:"provider,omitempty" yaml:"provider,omitempty"`
+	Priority int    `json:"priority" yaml:"priority"`
+	Value    string `json:"value,omitempty" yaml:"value,omitempty"`
+	SRC      string `json:"src,omitempty" yaml:"src,omitempty"`
+	Winner   bool   `json:"winner" yaml:"winner"`
+}
+
+// NameCollision is a name that more than one Unifi client has. Each client
+// after the first has the hostname with a suffix unless the collisions are
+// merged.
+type NameCollision struct {
+	Name     string             `json:"name,omitempty" yaml:"name,omitempty"`
+	Domain   string             `json:"domain,omitempty" yaml:"domain,omitempty"`
+	Provider string             `json:"provider,omitempty" yaml:"provider,omitempty"`
+	Clients  []*CollisionClient `json:"clients,omitempty" yaml:"clients,omitempty"`
+}
+
+// CollisionClient is a client with a colliding name and the hostname it was
+// given
+type CollisionClient struct {
+	MAC      string `json:"mac,omitempty" yaml:"mac,omitempty"`
+	Name     string `json:"name,omitempty" yaml:"name,omitempty"`
+	Hostname string `json:"hostname,omitempty" yaml:"hostname,omitempty"`
+}
+
+// AuditConfig is the config for the persistent log of record changes
+type AuditConfig struct {
+	Enabled bool   `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	File    string `json:"file,omitempty" yaml:"file,omitempty"`
+	// MaxSize is the size in bytes at which the file is rotated. One rotated
+	// file is kept.
+	MaxSize int64 `json:"maxSize,omitempty" yaml:"maxSize,omitempty"`
+}
+
+// Clone return copy
+func (t *AuditConfig) Clone() *AuditConfig {
+	c := &AuditConfig{}
+	copier.Copy(&c, &t)
+	return c
+}
+
+// NotifyConfig is the config for outbound webhook notifications
+type NotifyConfig struct {
+	Enabled bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// ProviderFailing is how long a provider refresh must be failing before
+	// notifying
+	ProviderFailing time.Duration `json:"providerFailing,omitempty" yaml:"providerFailing,omitempty"`
+	// UpstreamFailures is the number of consecutive failures before an upstream
+	// nameserver is considered down
+	UpstreamFailures int `json:"upstreamFailures,omitempty" yaml:"upstreamFailures,omitempty"`
+	// Interval is how often provider and upstream status is checked
+	Interval time.Duration    `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Webhooks []*WebhookConfig `json:"webhooks,omitempty" yaml:"webhooks,omitempty"`
+}
+
+// Clone return copy
+func (t *NotifyConfig) Clone() *NotifyConfig {
+	c := &NotifyConfig{}
+	copier.Copy(&c, &t)
+	return c
+}
+
+// AddWebhooks is a convenience function that adds the specified webhooks
+func (t *NotifyConfig) AddWebhooks(webhooks ...*WebhookConfig) *NotifyConfig {
+	for _, v := range webhooks {
+		t.Webhooks = append(t.Webhooks, v)
+	}
+	return t
+}
+
+// WebhookConfig is an HTTP endpoint that is sent a POST for each notification.
+// Preset is one of generic (the default), ntfy, gotify or slack. Template is a
+// Go text/template for the body and may only be set for generic webhooks. If
+// Events is empty all events are sent.
+type WebhookConfig struct {
+	Name     string            `json:"name,omitempty" yaml:"name,omitempty"`
+	URL      string            `json:"url,omitempty" yaml:"url,omitempty"`
+	Preset   string            `json:"preset,omitempty" yaml:"preset,omitempty"`
+	Template string            `json:"template,omitempty" yaml:"template,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Events   []string          `json:"events,omitempty" yaml:"events,omitempty"`
+	Retries  int               `json:"retries,omitempty" yaml:"retries,omitempty"`
+	Backoff  time.Duration     `json:"backoff,omitempty" yaml:"backoff,omitempty"`
+	Dedupe   time.Duration     `json:"dedupe,omitempty" yaml:"dedupe,omitempty"`
+}
+
+// Clone return copy
+func (t *WebhookConfig) Clone() *WebhookConfig {
+	c := &WebhookConfig{}
+	copier.Copy(&c, &t)
+	return c
+}
+
+// LeaseConfig is the config for DHCP lease file providers
+type LeaseConfig struct {
+	Enabled  bool         `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Files    []*LeaseFile `json:"files,omitempty" yaml:"files,omitempty"`
+	Priority int          `json:"priority,omitempty" yaml:"priority,omitempty"`
+}
+
+// Clone return copy
+func (t *LeaseConfig) Clone() *LeaseConfig {
+	c := &LeaseConfig{}
+	copier.Copy(&c, &t)
+	return c
+}
+
+// AddFiles is a convenience function that adds the specified lease files
+func (t *LeaseConfig) AddFiles(files ...*LeaseFile) *LeaseConfig {
+	for _, v := range files {
+		t.Files = append(t.Files, v)
+	}
+	return t
+}
+
+// LeaseFile is a DHCP server lease file. Format is one of dhcpd (ISC dhcpd),
+// dnsmasq or kea (Kea memfile CSV). The file is watched for changes and is
+// also refreshed at the Refresh interval so that expired leases are removed.
+type LeaseFile struct {
+	Path    string        `json:"path,omitempty" yaml:"path,omitempty"`
+	Format  string        `json:"format,omitempty" yaml:"format,omitempty"`
+	Domain  string        `json:"domain,omitempty" yaml:"domain,omitempty"`
+	Refresh time.Duration `json:"refresh,omitempty" yaml:"refresh,omitempty"`
+}
+
+// HostsConfig is the config for records read from /etc/hosts format files.
+// Names without a domain are put in Domain.
+type HostsConfig struct {
+	Enabled  bool     `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Domain   string   `json:"domain,omitempty" yaml:"domain,omitempty"`
+	Files    []string `json:"files,omitempty" yaml:"files,omitempty"`
+	Priority int      `json:"priority,omitempty" yaml:"priority,omitempty"`
+}
+
+// Clone return copy
+func (t *HostsConfig) Clone() *HostsConfig {
+	c := &HostsConfig{}
+	copier.Copy(&c, &t)
+	return c
+}
+
+// AddFiles is a convenience function that adds the specified hosts files
+func (t *HostsConfig) AddFiles(files ...string) *HostsConfig {
+	for _, v := range files {
+		t.Files = append(t.Files, v)
+	}
+	return t
+}
+
+// ZoneConfig is the config for records read from RFC 1035 zone files
+type ZoneConfig struct {
+	Enabled  bool        `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Files    []*ZoneFile `json:"files,omitempty" yaml:"files,omitempty"`
+	Priority int         `json:"priority,omitempty" yaml:"priority,omitempty"`
+}
+
+// Clone return copy
+func (t *ZoneConfig) Clone() *ZoneConfig {
+	c := &ZoneConfig{}
+	copier.Copy(&c, &t)
+	return c
+}
+
+// AddFiles is a convenience function that adds the specified zone files
+func (t *ZoneConfig) AddFiles(files ...*ZoneFile) *ZoneConfig {
+	for _, v := range files {
+		t.Files = append(t.Files, v)
+	}
+	return t
+}
+
+// ZoneFile is a BIND style zone file. Origin is the initial $ORIGIN and the
+// domain of the zone. If it is not set the file must set $ORIGIN itself or use
+// absolute names.
+type ZoneFile struct {
+	Path   string `json:"path,omitempty" yaml:"path,omitempty"`
+	Origin string `json:"origin,omitempty" yaml:"origin,omitempty"`
+}
+
+// NeighborConfig is the config for records from the kernel ARP and NDP neighbor
+// tables. Hosts maps MACs to hostnames. When Learn is set the hostnames for
+// MACs are also learned from the records of other providers. A learned name is
+// forgotten once neither the records nor the neighbor tables have had its MAC
+// for LearnAge (a week if not set).
+type NeighborConfig struct {
+	Enabled  bool              `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Domain   string            `json:"domain,omitempty" yaml:"domain,omitempty"`
+	Refresh  time.Duration     `json:"refresh,omitempty" yaml:"refresh,omitempty"`
+	ArpFile  string            `json:"arpFile,omitempty" yaml:"arpFile,omitempty"`
+	IPv6     bool              `json:"ipv6,omitempty" yaml:"ipv6,omitempty"`
+	Learn    bool              `json:"learn,omitempty" yaml:"learn,omitempty"`
+	LearnAge time.Duration     `json:"learnAge,omitempty" yaml:"learnAge,omitempty"`
+	Priority int               `json:"priority,omitempty" yaml:"priority,omitempty"`
+	Hosts    map[string]string `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+}
+
+// Clone return copy
+func (t *NeighborConfig) Clone() *NeighborConfig {
+	c := &NeighborConfig{}
+	copier.Copy(&c, &t)
+	return c
+}
+
+// AddHost is a convenience function that maps the MAC to the hostname
+func (t *NeighborConfig) AddHost(mac, hostname string) *NeighborConfig {
+	if t.Hosts == nil {
+		t.Hosts = make(map[string]string)
+	}
+	t.Hosts[strings.ToLower(mac)] = hostname
+	return t
+}
+
+// MDNSConfig is the config for the bridge that publishes the hosts announced
+// over multicast DNS as name.local into a unicast domain. Browse is the list of
+// service types such as _ipp._tcp to browse for. If it is empty every service
+// type is browsed for. When Services is set SRV and TXT records are published
+// for the service instances.
+type MDNSConfig struct {
+	Enabled    bool          `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Domain     string        `json:"domain,omitempty" yaml:"domain,omitempty"`
+	Interfaces []string      `json:"interfaces,omitempty" yaml:"interfaces,omitempty"`
+	IPv6       bool          `json:"ipv6,omitempty" yaml:"ipv6,omitempty"`
+	Services   bool          `json:"services,omitempty" yaml:"services,omitempty"`
+	Browse     []string      `json:"browse,omitempty" yaml:"browse,omitempty"`
+	Interval   time.Duration `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Priority   int           `json:"priority,omitempty" yaml:"priority,omitempty"`
+}
+
+// Clone return copy
+func (t *MDNSConfig) Clone() *MDNSConfig {
+	c := &MDNSConfig{}
+	copier.Copy(&c, &t)
+	return c
+}
+
+// AddInterfaces is a convenience function that adds the specified interfaces
+func (t *MDNSConfig) AddInterfaces(interfaces ...string) *MDNSConfig {
+	for _, v := range interfaces {
+		t.Interfaces = append(t.Interfaces, v)
+	}
+	return t
+}
+
+// AddBrowse is a convenience function that adds the specified service types
+func (t *MDNSConfig) AddBrowse(serviceTypes ...string) *MDNSConfig {
+	for _, v := range serviceTypes {
+		t.Browse = append(t.Browse, v)
+	}
+	return t
+}
+
+// MDNSResponderConfig is the config for answering multicast DNS queries for
+// name.local with the A and AAAA records of the hosts in Domains. If Domains is
+// empty the default domain is used. Only the interfaces in Interfaces answer or,
+// if it is empty, every multicast interface does.
+type MDNSResponderConfig struct {
+	Enabled    bool     `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Interfaces []string `json:"interfaces,omitempty" yaml:"interfaces,omitempty"`
+	Domains    []string `json:"domains,omitempty" yaml:"domains,omitempty"`
+	IPv6       bool     `json:"ipv6,omitempty" yaml:"ipv6,omitempty"`
+}
+
+// Clone return copy
+func (t *MDNSResponderConfig) Clone() *MDNSResponderConfig {
+	c := &MDNSResponderConfig{}
+	copier.Copy(&c, &t)
+	return c
+}
+
+// AddInterfaces is a convenience function that adds the specified interfaces
+func (t *MDNSResponderConfig) AddInterfaces(interfaces ...string) *MDNSResponderConfig {
+	for _, v := range interfaces {
+		t.Interfaces = append(t.Interfaces, v)
+	}
+	return t
+}
+
+// AddDomains is a convenience function that adds the specified domains
+func (t *MDNSResponderConfig) AddDomains(domains ...string) *MDNSResponderConfig {
+	for _, v := range domains {
+		t.Domains = append(t.Domains, v)
+	}
+	return t
+}
+
+// RemoteConfig is the config for records fetched from URLs
+type RemoteConfig struct {
+	Enabled bool            `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Sources []*RemoteSource `json:"sources,omitempty" yaml:"sources,omitempty"`
+}
+
+// Clone return copy
+func (t *RemoteConfig) Clone() *RemoteConfig {
+	c := &RemoteConfig{}
+	copier.Copy(&c, &t)
+	return c
+}
+
+// AddSources is a convenience function that adds the specified sources
+func (t *RemoteConfig) AddSources(sources ...*RemoteSource) *RemoteConfig {
+	for _, v := range sources {
+		t.Sources = append(t.Sources, v)
+	}
+	return t
+}
+
+// RemoteSource is a URL that returns JSON or YAML. Format is records (the
+// default) for the DomainRecords schema or list for a list of hosts. For a list
+// Path is the path to the list in the document and HostnameField, IPField and
+// DomainField are the paths to the values in each item. Paths are a subset of
+// JSONPath such as $.data.hosts or primary_ip.address. Username and Password
+// are for basic auth and Token is for bearer auth. CAFile is a PEM file with
+// the CAs to trust in addition to the system CAs.
+type RemoteSource struct {
+	URL           string        `json:"url,omitempty" yaml:"url,omitempty"`
+	Domain        string        `json:"domain,omitempty" yaml:"domain,omitempty"`
+	Refresh       time.Duration `json:"refresh,omitempty" yaml:"refresh,omitempty"`
+	Format        string        `json:"format,omitempty" yaml:"format,omitempty"`
+	Path          string        `json:"path,omitempty" yaml:"path,omitempty"`
+	HostnameField string        `json:"hostnameField,omitempty" yaml:"hostnameField,omitempty"`
+	IPField       string        `json:"ipField,omitempty" yaml:"ipField,omitempty"`
+	DomainField   string        `json:"domainField,omitempty" yaml:"domainField,omitempty"`
+	Username      string        `json:"username,omitempty" yaml:"username,omitempty"`
+	Password      string        `json:"password,omitempty" yaml:"password,omitempty"`
+	Token         string        `json:"token,omitempty" yaml:"token,omitempty"`
+	CAFile        string        `json:"caFile,omitempty" yaml:"caFile,omitempty"`
+	Priority      int           `json:"priority,omitempty" yaml:"priority,omitempty"`
+}
+
+// HomeAssistantConfig is the config for records for the devices of a Home
+// Assistant instance
+type HomeAssistantConfig struct {
+	Enabled bool   `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	URL     string `json:"url,omitempty" yaml:"url,omitempty"`
+	// Token is a long-lived access token
+	Token  string `json:"token,omitempty" yaml:"token,omitempty"`
+	Domain string `json:"domain,omitempty" yaml:"domain,omitempty"`
+	// Registry reads and watches the device, entity and area registries
+	Registry bool `json:"registry,omitempty" yaml:"registry,omitempty"`
+	// NameTemplate is a Go template for the hostname
+	NameTemplate string `json:"nameTemplate,omitempty" yaml:"nameTemplate,omitempty"`
+	// IPAttributes are the entity attributes with IPs
+	IPAttributes []string      `json:"ipAttributes,omitempty" yaml:"ipAttributes,omitempty"`
+	Refresh      time.Duration `json:"refresh,omitempty" yaml:"refresh,omitempty"`
+	Priority     int           `json:"priority,omitempty" yaml:"priority,omitempty"`
+}
+
+// Clone return copy
+func (t *HomeAssistantConfig) Clone() *HomeAssistantConfig {
+	c := &HomeAssistantConfig{}
+	copier.Copy(&c, &t)
+	return c
+}
+
+// AddIPAttributes is a convenience function that adds the specified entity
+// attributes that have IPs
+func (t *HomeAssistantConfig) AddIPAttributes(attributes ...string) *HomeAssistantConfig {
+	for _, v := range attributes {
+		t.IPAttributes = append(t.IPAttributes, v)
+	}
+	return t
+}
+
+// DockerConfig is the config for records for running Docker containers. Socket
+// is the Docker Engine API unix socket. If Network is set only the IPs on that
+// network are used, otherwise the IPs on every network are. If LabeledOnly is set only containers with the hostname
+// label get records.
+type DockerConfig struct {
+	Enabled     bool          `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Socket      string        `json:"socket,omitempty" yaml:"socket,omitempty"`
+	Domain      string        `json:"domain,omitempty" yaml:"domain,omitempty"`
+	Network     string        `json:"network,omitempty" yaml:"network,omitempty"`
+	LabeledOnly bool          `json:"labeledOnly,omitempty" yaml:"labeledOnly,omitempty"`
+	Refresh     time.Duration `json:"refresh,omitempty" yaml:"refresh,omitempty"`
+	Priority    int           `json:"priority,omitempty" yaml:"priority,omitempty"`
+}
+
+// Clone return copy
+func (t *DockerConfig) Clone() *DockerConfig {
+	c := &DockerConfig{}
+	copier.Copy(&c, &t)
+	return c
+}
+
+// ViewConfig is a split-horizon view for the clients with a source IP in one of
+// its networks
+type ViewConfig struct {
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Networks are CIDRs or IPs
+	Networks []string `json:"networks,omitempty" yaml:"networks,omitempty"`
+	// Providers are provider names, kinds or globs
+	Providers   []string       `json:"providers,omitempty" yaml:"providers,omitempty"`
+	Nameservers []*NetPort     `json:"nameservers,omitempty" yaml:"nameservers,omitempty"`
+	Forwards    []*ForwardRule `json:"forwards,omitempty" yaml:"forwards,omitempty"`
+	// Blocklist is the domains that are blocked with their subdomains
+	Blocklist []string `json:"blocklist,omitempty" yaml:"blocklist,omitempty"`
+	// BlockPolicy is nxdomain, null or refused
+	BlockPolicy string `json:"blockPolicy,omitempty" yaml:"blockPolicy,omitempty"`
+}
+
+// Clone return copy
+func (t *ViewConfig) Clone() *ViewConfig {
+	c := &ViewConfig{}
+	copier.Copy(&c, &t)
+	return c
+}
+
+// AddNetworks is a convenience function that adds the specified CIDRs
+func (t *ViewConfig) AddNetworks(networks ...string) *ViewConfig {
+	for _, v := range networks {
+		t.Networks = append(t.Networks, v)
+	}
+	return t
+}
+
+// AddProviders is a convenience function that adds the specified providers
+func (t *ViewConfig) AddProviders(providers ...string) *ViewConfig {
+	for _, v := range providers {
+		t.Providers = append(t.Providers, v)
+	}
+	return t
+}
+
+// AddNameservers is a convenience function that adds the specified nameservers
+func (t *ViewConfig) AddNameservers(nameservers ...*NetPort) *ViewConfig {
+	for _, v := range nameservers {
+		t.Nameservers = append(t.Nameservers, v)
+	}
+	return t
+}
+
+// AddForwards is a convenience function that adds the specified forward rules
+func (t *ViewConfig) AddForwards(forwards ...*ForwardRule) *ViewConfig {
+	for _, v := range forwards {
+		t.Forwards = append(t.Forwards, v)
+	}
+	return t
+}
+
+// AddBlocklist is a convenience function that adds the specified domains to
+// the blocklist
+func (t *ViewConfig) AddBlocklist(domains ...string) *ViewConfig {
+	for _, v := range domains {
+		t.Blocklist = append(t.Blocklist, v)
+	}
+	return t
+}
+
+// ACLConfig is the access control for the DNS listeners. The networks are
+// CIDRs or IPs. A client with a source IP in Deny is refused and if Allow is set
+// a client must have a source IP in it. Local is who may query the local zones,
+// the domains that providers have records in, and Recursion is who may have
+// queries forwarded to the nameservers. They are checked after Allow and Deny.
+// A query from a client that is not allowed is answered with REFUSED.
+type ACLConfig struct {
+	Allow     []string `json:"allow,omitempty" yaml:"allow,omitempty"`
+	Deny      []string `json:"deny,omitempty" yaml:"deny,omitempty"`
+	Local     *ACLRule `json:"local,omitempty" yaml:"local,omitempty"`
+	Recursion *ACLRule `json:"recursion,omitempty" yaml:"recursion,omitempty"`
+}
+
+// Clone return copy
+func (t *ACLConfig) Clone() *ACLConfig {
+	c := &ACLConfig{}
+	copier.Copy(&c, &t)
+	return c
+}
+
+// AddAllow is a convenience function that adds the specified networks to Allow
+func (t *ACLConfig) AddAllow(networks ...string) *ACLConfig {
+	for _, v := range networks {
+		t.Allow = append(t.Allow, v)
+	}
+	return t
+}
+
+// AddDeny is a convenience function that adds the specified networks to Deny
+func (t *ACLConfig) AddDeny(networks ...string) *ACLConfig {
+	for _, v := range networks {
+		t.Deny = append(t.Deny, v)
+	}
+	return t
+}
+
+// ACLRule allows the clients with a source IP in Allow, or every client if it
+// is empty, except for the ones in Deny
+type ACLRule struct {
+	Allow []string `json:"allow,omitempty" yaml:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty" yaml:"deny,omitempty"`
+}
+
+// Clone return copy
+func (t *ACLRule) Clone() *ACLRule {
+	c := &ACLRule{}
+	copier.Copy(&c, &t)
+	return c
+}
+
+// AddAllow is a convenience function that adds the specified networks to Allow
+func (t *ACLRule) AddAllow(networks ...string) *ACLRule {
+	for _, v := range networks {
+		t.Allow = append(t.Allow, v)
+	}
+	return t
+}
+
+// AddDeny is a convenience function that adds the specified networks to Deny
+func (t *ACLRule) AddDeny(networks ...string) *ACLRule {
+	for _, v := range networks {
+		t.Deny = append(t.Deny, v)
+	}
+	return t
+}
+
+// ForwardRule forwards the queries for Domain and its subdomains to
+// Nameservers
+type ForwardRule struct {
+	Domain      string     `json:"domain,omitempty" yaml:"domain,omitempty"`
+	Nameservers []*NetPort `json:"nameservers,omitempty" yaml:"nameservers,omitempty"`
+}
+
+// Clone return copy
+func (t *ForwardRule) Clone() *ForwardRule {
+	c := &ForwardRule{}
+	copier.Copy(&c, &t)
+	return c
+}
+
+// AddNameservers is a convenience function that adds the specified nameservers
+func (t *ForwardRule) AddNameservers(nameservers ...*NetPort) *ForwardRule {
+	for _, v := range nameservers {
+		t.Nameservers = append(t.Nameservers, v)
+	}
+	return t
+}
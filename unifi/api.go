@@ -0,0 +1,199 @@
+package unifi
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/jodydadescott/unifi-go-sdk"
+	"go.uber.org/zap"
+)
+
+const (
+	requestTimeout = time.Second * 30
+	authCookie     = "TOKEN"
+)
+
+// api is a client for the Unifi Network API of a controller. The SDK only
+// supports the default site so the requests are made here for any site and the
+// responses are decoded into the SDK types. The controllers use self signed
+// certificates so they are not verified. The auth cookie is shared by the sites
+// of the controller.
+type api struct {
+	mutex      sync.Mutex
+	hostname   string
+	username   string
+	password   string
+	httpClient *http.Client
+	cookie     *http.Cookie
+}
+
+func newAPI(hostname, username, password string) *api {
+	return &api{
+		hostname: hostname,
+		username: username,
+		password: password,
+		httpClient: &http.Client{
+			Timeout: requestTimeout,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		},
+	}
+}
+
+func (t *api) login() (*http.Cookie, error) {
+
+	body, _ := json.Marshal(&unifi.AuthRequest{
+		Username: t.username,
+		Password: t.password,
+	})
+
+	req, err := http.NewRequest(http.MethodPost, t.hostname+"/api/auth/login", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Unifi login to %s returned %s: %s", t.hostname, resp.Status, string(message))
+	}
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == authCookie {
+			return cookie, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Unifi login to %s did not return a cookie", t.hostname)
+}
+
+// getCookie returns the auth cookie, logging in if there is none
+func (t *api) getCookie() (*http.Cookie, error) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.cookie != nil {
+		return t.cookie, nil
+	}
+
+	zap.L().Debug(fmt.Sprintf("Logging in to Unifi controller %s", t.hostname))
+
+	cookie, err := t.login()
+	if err != nil {
+		return nil, err
+	}
+
+	t.cookie = cookie
+	return cookie, nil
+}
+
+func (t *api) clearCookie(cookie *http.Cookie) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.cookie == cookie {
+		t.cookie = nil
+	}
+}
+
+// get does a GET on the path of the controller and decodes the response into
+// v. If the cookie has expired the request is made again after logging in.
+func (t *api) get(path string, v any) error {
+
+	uri := t.hostname + path
+
+	do := func() (*http.Response, *http.Cookie, error) {
+
+		cookie, err := t.getCookie()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		req, err := http.NewRequest(http.MethodGet, uri, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(cookie)
+
+		resp, err := t.httpClient.Do(req)
+		return resp, cookie, err
+	}
+
+	resp, cookie, err := do()
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		zap.L().Debug(fmt.Sprintf("Unifi cookie for %s is unauthorized; trying again", t.hostname))
+		t.clearCookie(cookie)
+		resp, _, err = do()
+		if err != nil {
+			return err
+		}
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unifi %s returned %s: %s", path, resp.Status, string(body))
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+// sitePath returns the path of the v2 Network API for the site
+func sitePath(site, path string) string {
+	return "/proxy/network/v2/api/site/" + url.PathEscape(site) + path
+}
+
+func (t *api) getClients(site string) ([]unifi.UnifiClient, error) {
+	var clients []unifi.UnifiClient
+	err := t.get(sitePath(site, "/clients/active?includeTrafficUsage=true&includeUnifiDevices=true"), &clients)
+	return clients, err
+}
+
+func (t *api) getDevices(site string) (*unifi.UnifiDevices, error) {
+	devices := &unifi.UnifiDevices{}
+	err := t.get(sitePath(site, "/device?separateUnmanaged=true&includeTrafficUsage=true"), devices)
+	return devices, err
+}
+
+func (t *api) getEnrichedConfiguration(site string) ([]*network, error) {
+	var networks []*network
+	err := t.get(sitePath(site, "/lan/enriched-configuration"), &networks)
+	return networks, err
+}
+
+// getKnownClients returns every client the site has seen including the ones
+// that are offline. This is only in the older API which wraps the result.
+func (t *api) getKnownClients(site string) ([]unifi.UnifiClient, error) {
+	var result struct {
+		Data []unifi.UnifiClient `json:"data"`
+	}
+	err := t.get("/proxy/network/api/s/"+url.PathEscape(site)+"/rest/user", &result)
+	return result.Data, err
+}
@@ -0,0 +1,92 @@
+package unifi_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	mdns "github.com/miekg/dns"
+
+	"github.com/jodydadescott/home-server/dns"
+	"github.com/jodydadescott/home-server/dns/dnstest"
+	"github.com/jodydadescott/home-server/unifi"
+	"github.com/jodydadescott/home-server/unifi/unifitest"
+)
+
+// startServer runs a DNS server for the providers and returns its address
+func startServer(t *testing.T, providers ...dns.Provider) string {
+
+	t.Helper()
+
+	config := &dns.Config{}
+	for _, provider := range providers {
+		config.AddProvider(provider)
+	}
+
+	_, address := dnstest.Start(t, config)
+	return address
+}
+
+// query returns the answers for the name and type
+func query(t *testing.T, address, name string, qtype uint16) []string {
+
+	t.Helper()
+
+	client := &mdns.Client{Timeout: time.Second}
+	response, _, err := client.Exchange(new(mdns.Msg).SetQuestion(mdns.Fqdn(name), qtype), address)
+	if err != nil {
+		t.Fatalf("%s: %s", name, err.Error())
+	}
+
+	var answers []string
+
+	for _, rr := range response.Answer {
+		switch rr := rr.(type) {
+		case *mdns.A:
+			answers = append(answers, rr.A.String())
+		case *mdns.AAAA:
+			answers = append(answers, rr.AAAA.String())
+		case *mdns.PTR:
+			answers = append(answers, rr.Ptr)
+		}
+	}
+
+	sort.Strings(answers)
+	return answers
+}
+
+func expectAnswers(t *testing.T, address, name string, qtype uint16, expected ...string) {
+	t.Helper()
+	got := query(t, address, name, qtype)
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("%s %s: expected %v, got %v", name, mdns.TypeToString[qtype], expected, got)
+	}
+}
+
+func TestDNSServer(t *testing.T) {
+
+	controller := unifitest.New()
+	defer controller.Close()
+
+	config := controller.Config()
+	config.IPv6Prefix = "2001:db8:0:ab00::/56"
+	config.NetworkSubdomains = true
+	config.AddSubdomainMap("Default", "")
+
+	address := startServer(t, unifi.New(config)[0])
+
+	expectAnswers(t, address, "jodys-iphone-2.home", mdns.TypeA, "192.168.1.20")
+	expectAnswers(t, address, "jodys-iphone-2.home", mdns.TypeAAAA, "2001:db8:0:ab01:3e22:fbff:fe11:2233", "2001:db8:0:ab01:8d1c:2e3f:4a5b:6c7d")
+	expectAnswers(t, address, "living-room-tv.iot-devices.home", mdns.TypeA, "192.168.20.30")
+	expectAnswers(t, address, "laptop-2.home", mdns.TypeA, "192.168.1.41")
+	expectAnswers(t, address, "udm-pro.home", mdns.TypeA, "203.0.113.2")
+	expectAnswers(t, address, "inf-default-2001-db8-0-ab01--1.home", mdns.TypeAAAA, "2001:db8:0:ab01::1")
+
+	expectAnswers(t, address, "20.1.168.192.in-addr.arpa", mdns.TypePTR, "jodys-iphone-2.home.")
+	expectAnswers(t, address, "30.20.168.192.in-addr.arpa", mdns.TypePTR, "living-room-tv.iot-devices.home.")
+	expectAnswers(t, address, "3.3.2.2.1.1.e.f.f.f.b.f.2.2.e.3.1.0.b.a.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa", mdns.TypePTR, "jodys-iphone-2.home.")
+	expectAnswers(t, address, "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.6.5.4.3.2.1.d.f.ip6.arpa", mdns.TypePTR, "inf-lab-fd12-3456--1.home.")
+
+	expectAnswers(t, address, "nobody.home", mdns.TypeA)
+}
@@ -0,0 +1,33 @@
+package unifi
+
+import (
+	"testing"
+
+	"github.com/jodydadescott/home-server/types"
+)
+
+func TestGetNetworkDomain(t *testing.T) {
+
+	config := &types.UnifiConfig{NetworkSubdomains: true, SubdomainFallback: "Other Networks."}
+	config.Hostname = "unifi.home"
+	config.Username = "admin"
+	config.Password = "secret"
+	config.AddSubdomainMap("Default", "").AddSubdomainMap("IoT Devices", "IoT_Things").AddSubdomainMap("Guest", ".Wi-Fi.Guest.")
+
+	client := New(config)[0]
+
+	tests := map[string]string{
+		"Default":     "home",
+		"iot devices": "iot-things.home",
+		"guest":       "wi-fi.guest.home",
+		"Jody's Net":  "jodys-net.home",
+		"Café":        "xn--caf-dma.home",
+		"___":         "other-networks.home",
+	}
+
+	for network, expected := range tests {
+		if got := client.getNetworkDomain(network); got != expected {
+			t.Errorf("%s: expected %s, got %s", network, expected, got)
+		}
+	}
+}
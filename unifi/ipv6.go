@@ -0,0 +1,184 @@
+package unifi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/jodydadescott/home-server/types"
+	"github.com/jodydadescott/home-server/util"
+	"github.com/jodydadescott/unifi-go-sdk"
+)
+
+const (
+	ipv6InterfaceStatic = "static"
+	ipv6InterfacePD     = "pd"
+)
+
+// network is the enriched configuration of a network with the IPv6 settings
+// that the SDK does not have
+type network struct {
+	unifi.EnrichedConfiguration
+	IPv6 ipv6Config
+}
+
+// ipv6Config is the IPv6 part of the configuration of a network. Subnet is
+// the address of the gateway and the prefix length such as 2001:db8:0:1::1/64
+// and is set for static networks and by some firmware for networks that get
+// their subnet from a delegated prefix. PrefixID is the hex subnet ID of the
+// network within the delegated prefix.
+type ipv6Config struct {
+	InterfaceType string `json:"ipv6_interface_type"`
+	Subnet        string `json:"ipv6_subnet"`
+	PrefixID      string `json:"ipv6_pd_prefixid"`
+}
+
+func (t *network) UnmarshalJSON(b []byte) error {
+
+	if err := json.Unmarshal(b, &t.EnrichedConfiguration); err != nil {
+		return err
+	}
+
+	var ipv6 struct {
+		Configuration ipv6Config `json:"configuration"`
+	}
+
+	if err := json.Unmarshal(b, &ipv6); err != nil {
+		return err
+	}
+
+	t.IPv6 = ipv6.Configuration
+	return nil
+}
+
+// getIPv6Subnet returns the address of the gateway on the network and the /64
+// or other subnet it is in. If the network gets its subnet from the delegated
+// prefix and the controller does not say what it is then it is the prefix with
+// the subnet ID of the network and the gateway is ::1 in it.
+func (t *Client) getIPv6Subnet(n *network) (string, string, error) {
+
+	switch strings.ToLower(n.IPv6.InterfaceType) {
+
+	case ipv6InterfaceStatic, ipv6InterfacePD:
+
+	default:
+		return "", "", nil
+	}
+
+	if n.IPv6.Subnet != "" {
+		ip, subnet, err := net.ParseCIDR(n.IPv6.Subnet)
+		if err != nil {
+			return "", "", err
+		}
+		return ip.String(), subnet.String(), nil
+	}
+
+	if strings.ToLower(n.IPv6.InterfaceType) != ipv6InterfacePD || t.prefix == nil {
+		return "", "", nil
+	}
+
+	id, err := strconv.ParseUint(n.IPv6.PrefixID, 16, 64)
+	if err != nil && n.IPv6.PrefixID != "" {
+		return "", "", fmt.Errorf("prefix ID %s is invalid", n.IPv6.PrefixID)
+	}
+
+	bits, _ := t.prefix.Mask.Size()
+	if bits > 64 || id >= 1<<uint(64-bits) {
+		return "", "", fmt.Errorf("prefix ID %s does not fit in %s", n.IPv6.PrefixID, t.prefix.String())
+	}
+
+	// The subnet ID is the bits of the /64 that follow the delegated prefix
+	value := new(big.Int).SetBytes(t.prefix.IP.To16())
+	value.Or(value, new(big.Int).Lsh(new(big.Int).SetUint64(id), 64))
+
+	subnet := make(net.IP, net.IPv6len)
+	value.FillBytes(subnet)
+
+	gateway := make(net.IP, net.IPv6len)
+	copy(gateway, subnet)
+	gateway[net.IPv6len-1] = 1
+
+	return gateway.String(), (&net.IPNet{IP: subnet, Mask: net.CIDRMask(64, 128)}).String(), nil
+}
+
+// filterIPv6 returns the IPv6 addresses of a client that the policy allows
+func (t *Client) filterIPv6(addresses []string, mac string) []string {
+
+	var result []string
+
+	for _, address := range compact(addresses) {
+
+		ip := net.ParseIP(address)
+		if ip == nil || ip.To4() != nil {
+			continue
+		}
+
+		switch t.ipv6Policy {
+
+		case types.UnifiIPv6None:
+			continue
+
+		case types.UnifiIPv6Global:
+			if ip.IsLinkLocalUnicast() {
+				continue
+			}
+
+		case types.UnifiIPv6Stable:
+			if ip.IsLinkLocalUnicast() || !isEUI64(ip, mac) {
+				continue
+			}
+
+		}
+
+		result = append(result, ip.String())
+	}
+
+	return result
+}
+
+// isEUI64 returns true if the interface ID of the IP is made from the MAC.
+// Temporary and privacy addresses have random interface IDs.
+func isEUI64(ip net.IP, mac string) bool {
+
+	hw, err := net.ParseMAC(mac)
+	if err != nil || len(hw) != 6 {
+		return false
+	}
+
+	id := []byte{hw[0] ^ 0x02, hw[1], hw[2], 0xff, 0xfe, hw[3], hw[4], hw[5]}
+
+	return string(ip.To16()[8:]) == string(id)
+}
+
+// getReverseZones returns the reverse zones of the delegated prefix and the
+// subnets of the networks
+func (t *Client) getReverseZones(networks []*network) []string {
+
+	var zones []string
+
+	add := func(cidr string) {
+		if zone, err := util.GetReverseZone(cidr); err == nil {
+			zones = append(zones, zone)
+		}
+	}
+
+	if t.prefix != nil {
+		add(t.prefix.String())
+	}
+
+	for _, n := range networks {
+
+		if n.Configuration.IPSubnet != "" {
+			add(n.Configuration.IPSubnet)
+		}
+
+		if _, subnet, err := t.getIPv6Subnet(n); err == nil && subnet != "" {
+			add(subnet)
+		}
+	}
+
+	return zones
+}
@@ -0,0 +1,188 @@
+package unifi
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/jodydadescott/home-server/types"
+	"github.com/jodydadescott/home-server/util"
+)
+
+type NameCollision = types.NameCollision
+type CollisionClient = types.CollisionClient
+
+const (
+	// defaultTemplate is the client alias set in Unifi or the hostname the
+	// client sent with DHCP
+	defaultTemplate = "{{if .Name}}{{.Name}}{{else}}{{.Hostname}}{{end}}"
+
+	maxLabel = util.MaxLabel
+)
+
+// nameFields are the fields that can be used in the name template
+type nameFields struct {
+	Name     string
+	Hostname string
+	MAC      string
+	OUI      string
+	Network  string
+}
+
+func parseTemplate(text string) *template.Template {
+
+	if text == "" {
+		text = defaultTemplate
+	}
+
+	tmpl, err := template.New("name").Parse(text)
+	if err == nil {
+		// A field that does not exist is only found when the template is run
+		err = tmpl.Execute(io.Discard, &nameFields{})
+	}
+
+	if err != nil {
+		panic(fmt.Sprintf("Unifi name template %s is invalid; error %s", text, err.Error()))
+	}
+
+	return tmpl
+}
+
+// getName returns the hostname for the fields from the template
+func (t *Client) getName(fields *nameFields) (string, error) {
+
+	var b strings.Builder
+	if err := t.template.Execute(&b, fields); err != nil {
+		return "", err
+	}
+
+	return util.ToLabel(b.String()), nil
+}
+
+func truncate(label string, length int) string {
+	if len(label) <= length {
+		return label
+	}
+	return strings.TrimRight(label[:length], "-")
+}
+
+// withSuffix returns the label with the suffix and shortens the label if that
+// is needed for the result to be a valid label
+func withSuffix(label, suffix string) string {
+	return truncate(label, maxLabel-len(suffix)) + suffix
+}
+
+// resolveCollisions finds the clients with the same hostname in the same
+// domain and, unless the collisions are merged, gives each client after the
+// first in order of MAC a hostname with a suffix. The suffixed hostnames are
+// different from every other hostname.
+func (t *Client) resolveCollisions(entries []*entry) []*NameCollision {
+
+	groups := make(map[string][]*entry)
+	taken := make(map[string]bool)
+	var keys []string
+
+	for _, e := range entries {
+		key := e.Hostname + "." + e.Domain
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], e)
+		taken[key] = true
+	}
+
+	sort.Strings(keys)
+
+	var collisions []*NameCollision
+
+	for _, key := range keys {
+
+		group := groups[key]
+
+		macs := make(map[string]bool)
+		for _, e := range group {
+			macs[e.MAC] = true
+		}
+
+		if len(macs) < 2 {
+			continue
+		}
+
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].MAC < group[j].MAC
+		})
+
+		collision := &NameCollision{
+			Name:     group[0].Hostname,
+			Domain:   group[0].Domain,
+			Provider: t.name,
+		}
+
+		number := 1
+
+		for i, e := range group {
+
+			original := e.Hostname
+
+			if i > 0 && t.collisions != types.UnifiCollisionsMerge {
+
+				for {
+					var suffix string
+					if t.collisions == types.UnifiCollisionsMAC {
+						suffix = "-" + macSuffix(e.MAC, number)
+					} else {
+						number++
+						suffix = "-" + strconv.Itoa(number)
+					}
+
+					hostname := withSuffix(original, suffix)
+					if !taken[hostname+"."+e.Domain] {
+						e.Hostname = hostname
+						taken[hostname+"."+e.Domain] = true
+						break
+					}
+
+					if t.collisions == types.UnifiCollisionsMAC {
+						number++
+					}
+				}
+			}
+
+			collision.Clients = append(collision.Clients, &CollisionClient{
+				MAC:      e.MAC,
+				Name:     original,
+				Hostname: e.Hostname,
+			})
+		}
+
+		collisions = append(collisions, collision)
+	}
+
+	return collisions
+}
+
+// macSuffix returns the last six hex digits of the MAC. If that is taken the
+// attempt number is added.
+func macSuffix(mac string, attempt int) string {
+
+	digits := hexDigits(mac)
+	if len(digits) > 6 {
+		digits = digits[len(digits)-6:]
+	}
+
+	if attempt > 1 {
+		digits += "-" + strconv.Itoa(attempt)
+	}
+
+	return digits
+}
+
+// GetCollisions returns the clients that had the same name on the last refresh
+func (t *Client) GetCollisions() []*NameCollision {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.nameCollisions
+}
@@ -0,0 +1,217 @@
+package unifi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// entry is what is known about a client. It is saved to the state file for
+// the clients that were seen recently.
+type entry struct {
+	MAC      string    `json:"mac"`
+	Hostname string    `json:"hostname"`
+	Domain   string    `json:"domain"`
+	IPv4     []string  `json:"ipv4,omitempty"`
+	IPv6     []string  `json:"ipv6,omitempty"`
+	LastSeen time.Time `json:"lastSeen,omitempty"`
+}
+
+// state is the clients last seen on each site of a controller. If there is a
+// file the state is loaded from it when it is created and saved to it after
+// each change.
+type state struct {
+	mutex sync.Mutex
+	file  string
+	sites map[string]map[string]*entry
+}
+
+func newState(file string) *state {
+
+	s := &state{
+		file:  file,
+		sites: make(map[string]map[string]*entry),
+	}
+
+	if file == "" {
+		return s
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			zap.L().Warn(fmt.Sprintf("Unifi state file %s was not read; error %s", file, err.Error()))
+		}
+		return s
+	}
+
+	if err := json.Unmarshal(b, &s.sites); err != nil {
+		zap.L().Warn(fmt.Sprintf("Unifi state file %s is invalid; error %s", file, err.Error()))
+		s.sites = make(map[string]map[string]*entry)
+	}
+
+	return s
+}
+
+// update sets the clients that are online now, removes the clients that have
+// not been seen within retention and returns the clients that are offline in
+// order of their MAC
+func (t *state) update(site string, online []*entry, retention time.Duration, now time.Time) []*entry {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	entries := t.sites[site]
+	if entries == nil {
+		entries = make(map[string]*entry)
+		t.sites[site] = entries
+	}
+
+	isOnline := make(map[string]bool)
+
+	for _, e := range online {
+		saved := *e
+		saved.LastSeen = now
+		entries[e.MAC] = &saved
+		isOnline[e.MAC] = true
+	}
+
+	var offline []*entry
+
+	for mac, e := range entries {
+
+		if isOnline[mac] {
+			continue
+		}
+
+		if now.Sub(e.LastSeen) > retention {
+			zap.L().Debug(fmt.Sprintf("Unifi client %s with MAC %s has not been seen since %s", e.Hostname, mac, e.LastSeen.Format(time.RFC3339)))
+			delete(entries, mac)
+			continue
+		}
+
+		offline = append(offline, e)
+	}
+
+	sort.Slice(offline, func(i, j int) bool {
+		return offline[i].MAC < offline[j].MAC
+	})
+
+	t.save()
+
+	return offline
+}
+
+// save writes the state to a temporary file that then replaces the state file
+// so the state file is never partly written
+func (t *state) save() {
+
+	if t.file == "" {
+		return
+	}
+
+	b, err := json.MarshalIndent(t.sites, "", "  ")
+	if err != nil {
+		zap.L().Error(err.Error())
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(t.file), 0755)
+	if err == nil {
+		err = os.WriteFile(t.file+".tmp", b, 0644)
+	}
+	if err == nil {
+		err = os.Rename(t.file+".tmp", t.file)
+	}
+
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("Unifi state file %s was not saved; error %s", t.file, err.Error()))
+	}
+}
+
+// addOffline adds the records for the clients that are not online. These are
+// the known clients that have a fixed IP and, if retention is set, the clients
+// that were online within retention. Their records are not added if a client
+// that is online has the same name or IP.
+func (t *Client) addOffline(records *Records, online []*entry, networks map[string]string) error {
+
+	names := make(map[string]bool)
+	ips := make(map[string]bool)
+	macs := make(map[string]bool)
+
+	claim := func(e *entry) bool {
+
+		if macs[e.MAC] || names[e.Hostname+"."+e.Domain] {
+			return false
+		}
+
+		for _, ip := range append(append([]string{}, e.IPv4...), e.IPv6...) {
+			if ips[ip] {
+				return false
+			}
+		}
+
+		macs[e.MAC] = true
+		names[e.Hostname+"."+e.Domain] = true
+		for _, ip := range append(append([]string{}, e.IPv4...), e.IPv6...) {
+			ips[ip] = true
+		}
+
+		return true
+	}
+
+	for _, e := range online {
+		claim(e)
+	}
+
+	if t.config.KnownClients {
+
+		known, err := t.api.getKnownClients(t.site)
+		if err != nil {
+			return err
+		}
+
+		for _, client := range known {
+
+			if !client.UseFixedip || client.FixedIP == "" || macs[client.Mac] {
+				continue
+			}
+
+			e := t.getEntry(&client, networks)
+			if e == nil {
+				continue
+			}
+
+			e.IPv4 = []string{client.FixedIP}
+			e.IPv6 = nil
+
+			if client.LastSeen > 0 {
+				e.LastSeen = time.Unix(int64(client.LastSeen), 0)
+			}
+
+			if claim(e) {
+				t.addClient(records, e, source+":unifi-known", false)
+			}
+		}
+	}
+
+	if t.config.Retention <= 0 {
+		return nil
+	}
+
+	for _, e := range t.state.update(t.site, online, t.config.Retention, time.Now()) {
+		if claim(e) {
+			t.addClient(records, e, source+":unifi-stale", true)
+		}
+	}
+
+	return nil
+}
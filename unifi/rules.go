@@ -0,0 +1,189 @@
+package unifi
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jodydadescott/home-server/types"
+)
+
+type Rule = types.UnifiRule
+
+// rule is a Unifi rule with its conditions parsed
+type rule struct {
+	*Rule
+	include bool
+	sources map[string]bool
+	mac     string
+	oui     string
+	name    *regexp.Regexp
+}
+
+// subject is what a rule is matched against. Wired is nil if it is not known
+// and MAC is empty for interfaces.
+type subject struct {
+	source  string
+	mac     string
+	names   []string
+	network string
+	vlan    int
+	wired   *bool
+	guest   bool
+}
+
+func (t *subject) String() string {
+	return fmt.Sprintf("%s %s with MAC %s", t.source, strings.Join(t.names, "/"), t.mac)
+}
+
+func parseRules(rules []*Rule) []*rule {
+
+	var result []*rule
+
+	for i, r := range rules {
+
+		if r == nil {
+			continue
+		}
+
+		parsed := &rule{Rule: r, sources: make(map[string]bool)}
+
+		switch strings.ToLower(r.Action) {
+
+		case types.UnifiRuleInclude:
+			parsed.include = true
+
+		case types.UnifiRuleExclude:
+
+		default:
+			panic(fmt.Sprintf("Unifi rule %d action %s is invalid; it must be %s or %s", i+1, r.Action, types.UnifiRuleInclude, types.UnifiRuleExclude))
+		}
+
+		for _, source := range r.Sources {
+			source = strings.ToLower(source)
+			switch source {
+			case types.UnifiSourceClient, types.UnifiSourceInterface, types.UnifiSourceDevice:
+				parsed.sources[source] = true
+			default:
+				panic(fmt.Sprintf("Unifi rule %d source %s is invalid", i+1, source))
+			}
+		}
+
+		if r.MAC != "" {
+			parsed.mac = strings.ToLower(r.MAC)
+			if _, err := path.Match(parsed.mac, ""); err != nil {
+				panic(fmt.Sprintf("Unifi rule %d MAC %s is invalid; error %s", i+1, r.MAC, err.Error()))
+			}
+		}
+
+		parsed.oui = hexDigits(r.OUI)
+
+		if r.Name != "" {
+			name, err := regexp.Compile(r.Name)
+			if err != nil {
+				panic(fmt.Sprintf("Unifi rule %d name %s is invalid; error %s", i+1, r.Name, err.Error()))
+			}
+			parsed.name = name
+		}
+
+		result = append(result, parsed)
+	}
+
+	return result
+}
+
+// matches returns true if each condition of the rule that is set matches
+func (t *rule) matches(s *subject) bool {
+
+	if len(t.sources) > 0 && !t.sources[s.source] {
+		return false
+	}
+
+	mac := strings.ToLower(s.mac)
+
+	if t.mac != "" {
+		if ok, _ := path.Match(t.mac, mac); !ok {
+			return false
+		}
+	}
+
+	if t.oui != "" && (mac == "" || !strings.HasPrefix(hexDigits(mac), t.oui)) {
+		return false
+	}
+
+	if t.RandomMAC != nil && (mac == "" || isRandomMAC(mac) != *t.RandomMAC) {
+		return false
+	}
+
+	if t.name != nil {
+		matched := false
+		for _, name := range s.names {
+			if name != "" && t.name.MatchString(name) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if t.Network != "" && !strings.EqualFold(t.Network, s.network) {
+		return false
+	}
+
+	if t.VLAN != 0 && t.VLAN != s.vlan {
+		return false
+	}
+
+	if t.Wired != nil && (s.wired == nil || *s.wired != *t.Wired) {
+		return false
+	}
+
+	if t.Guest != nil && *t.Guest != s.guest {
+		return false
+	}
+
+	return true
+}
+
+// isIncluded returns true unless the MAC is ignored or the first rule that
+// matches excludes it
+func (t *Client) isIncluded(s *subject) bool {
+
+	if s.mac != "" && t.config.IgnoreMac(s.mac) {
+		return false
+	}
+
+	for _, r := range t.rules {
+		if r.matches(s) {
+			return r.include
+		}
+	}
+
+	return true
+}
+
+// hexDigits returns the MAC or MAC prefix in lowercase without separators
+func hexDigits(mac string) string {
+	return strings.ToLower(strings.NewReplacer(":", "", "-", "", ".", "").Replace(mac))
+}
+
+// isRandomMAC returns true if the MAC is locally administered. Phones use a
+// random MAC of this kind for each network for privacy.
+func isRandomMAC(mac string) bool {
+
+	digits := hexDigits(mac)
+	if len(digits) < 2 {
+		return false
+	}
+
+	b, err := strconv.ParseUint(digits[:2], 16, 8)
+	if err != nil {
+		return false
+	}
+
+	return b&0x02 != 0
+}
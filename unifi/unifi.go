@@ -2,7 +2,11 @@ package unifi
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/jodydadescott/home-server/types"
@@ -16,18 +20,37 @@ type ARecord = types.ARecord
 type PTRrecord = types.PTRrecord
 type Records = types.DomainRecords
 
+// Client is a provider for the clients, networks and devices of a site on a
+// Unifi controller
 type Client struct {
-	unifiClient *unifi.Client
+	mutex       sync.Mutex
+	api         *api
+	state       *state
+	name        string
+	site        string
 	config      *Config
 	ignoreMacs  []string
 	domain      string
+	subdomains  map[string]string
+	domainNames []string
+	template    *template.Template
+	collisions  string
+	rules       []*rule
+	ipv6Policy  string
+	prefix      *net.IPNet
+
+	nameCollisions []*NameCollision
 }
 
 const (
 	source = "unifi"
+
+	defaultSite = "default"
 )
 
-func New(config *Config) *Client {
+// New returns a client for each site of the controller. The sites share the
+// login to the controller.
+func New(config *Config) []*Client {
 
 	if config == nil {
 		panic("config is required")
@@ -52,115 +75,364 @@ func New(config *Config) *Client {
 		domain = config.Domain
 	}
 
-	return &Client{
-		config:      config,
-		domain:      domain,
-		unifiClient: unifi.New(&config.Config),
+	// Network names are matched without regard to case
+	subdomains := make(map[string]string)
+	for network, subdomain := range config.SubdomainMap {
+		subdomains[strings.ToLower(network)] = toSubdomain(subdomain)
+	}
+
+	// The controller name is used in the provider names. If it is not set the
+	// host of the controller is used.
+	name := config.Name
+	if name == "" {
+		name = config.Hostname
+		if u, err := url.Parse(config.Hostname); err == nil && u.Host != "" {
+			name = u.Host
+		}
 	}
+
+	collisions := config.Collisions
+	switch collisions {
+	case "":
+		collisions = types.UnifiCollisionsNumber
+	case types.UnifiCollisionsNumber, types.UnifiCollisionsMAC, types.UnifiCollisionsMerge:
+	default:
+		panic(fmt.Sprintf("Unifi collisions %s is invalid; it must be %s, %s or %s", collisions,
+			types.UnifiCollisionsNumber, types.UnifiCollisionsMAC, types.UnifiCollisionsMerge))
+	}
+
+	tmpl := parseTemplate(config.NameTemplate)
+	rules := parseRules(config.Rules)
+
+	ipv6Policy := config.IPv6Policy
+	switch ipv6Policy {
+	case "":
+		ipv6Policy = types.UnifiIPv6Global
+	case types.UnifiIPv6Global, types.UnifiIPv6Stable, types.UnifiIPv6All, types.UnifiIPv6None:
+	default:
+		panic(fmt.Sprintf("Unifi IPv6 policy %s is invalid; it must be %s, %s, %s or %s", ipv6Policy,
+			types.UnifiIPv6Global, types.UnifiIPv6Stable, types.UnifiIPv6All, types.UnifiIPv6None))
+	}
+
+	var prefix *net.IPNet
+	if config.IPv6Prefix != "" {
+		var err error
+		_, prefix, err = net.ParseCIDR(config.IPv6Prefix)
+		if err != nil || prefix.IP.To4() != nil {
+			panic(fmt.Sprintf("Unifi IPv6 prefix %s is invalid", config.IPv6Prefix))
+		}
+		if bits, _ := prefix.Mask.Size(); bits > 64 {
+			panic(fmt.Sprintf("Unifi IPv6 prefix %s is longer than /64", config.IPv6Prefix))
+		}
+	}
+
+	sites := config.Sites
+	if len(sites) == 0 {
+		sites = []string{defaultSite}
+	}
+
+	api := newAPI(strings.TrimSuffix(config.Hostname, "/"), config.Username, config.Password)
+
+	var clientState *state
+	if config.Retention > 0 {
+		clientState = newState(config.StateFile)
+	}
+
+	var clients []*Client
+
+	for _, site := range sites {
+		clients = append(clients, &Client{
+			api:        api,
+			state:      clientState,
+			name:       source + ":" + name + "/" + site,
+			site:       site,
+			config:     config,
+			domain:     domain,
+			subdomains: subdomains,
+			template:   tmpl,
+			collisions: collisions,
+			rules:      rules,
+			ipv6Policy: ipv6Policy,
+			prefix:     prefix,
+		})
+	}
+
+	return clients
 }
 
 func (t *Client) GetRefreshDuration() time.Duration {
 	return t.config.Refresh
 }
 
+// GetPriority implements dns.Prioritized
+func (t *Client) GetPriority() int {
+	return t.config.Priority
+}
+
 func (t *Client) GetDomainName() string {
 	return t.domain
 }
 
 func (t *Client) GetName() string {
-	return "unifi"
+	return t.name
 }
 
-// GetRecords() (*Records, error)
-func (t *Client) GetRecords() (*Records, error) {
+// GetDomainNames implements dns.MultiDomain. The domains are the subdomains of
+// the networks found on the last refresh if network subdomains are enabled and
+// the reverse zones of the delegated prefix and the subnets of the networks.
+func (t *Client) GetDomainNames() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.domainNames
+}
 
-	clients, err := t.unifiClient.GetClients()
-	if err != nil {
-		return nil, err
+// getNetworkDomain returns the domain for the clients on a network
+func (t *Client) getNetworkDomain(network string) string {
+
+	if !t.config.NetworkSubdomains {
+		return t.domain
+	}
+
+	subdomain, ok := t.subdomains[strings.ToLower(network)]
+
+	if !ok {
+		subdomain = util.ToLabel(network)
+		if subdomain == "" {
+			subdomain = toSubdomain(t.config.SubdomainFallback)
+		}
 	}
 
-	enrichedConfigs, err := t.unifiClient.GetEnrichedConfiguration()
+	if subdomain == "" {
+		return t.domain
+	}
+
+	return subdomain + "." + t.domain
+}
+
+// getEntry returns the name, domain, MAC and IPs of a client or nil if the
+// client does not have a name. The name is from the name template.
+func (t *Client) getEntry(client *unifi.UnifiClient, networks map[string]string) *entry {
+
+	network := getNetworkName(client, networks)
+
+	if !t.isIncluded(clientSubject(client, network)) {
+		zap.L().Debug(fmt.Sprintf("Client with MAC=%s and IP=%s is excluded", client.Mac, client.IP))
+		return nil
+	}
+
+	name, err := t.getName(&nameFields{
+		Name:     client.Name,
+		Hostname: client.Hostname,
+		MAC:      client.Mac,
+		OUI:      client.Oui,
+		Network:  network,
+	})
+
 	if err != nil {
-		return nil, err
+		zap.L().Debug(fmt.Sprintf("Client with MAC=%s and IP=%s does not have a name; error %s", client.Mac, client.IP, err.Error()))
+		return nil
 	}
 
-	records := &Records{}
+	if name == "" {
+		zap.L().Debug(fmt.Sprintf("Client with MAC=%s and IP=%s does not have a name", client.Mac, client.IP))
+		return nil
+	}
 
-	for _, client := range clients {
+	return &entry{
+		MAC:      client.Mac,
+		Hostname: name,
+		Domain:   t.getNetworkDomain(network),
+		IPv4:     compact([]string{client.IP}),
+		IPv6:     t.filterIPv6(client.Ipv6Address, client.Mac),
+	}
+}
 
-		name := client.Name
+// addClient adds the A, AAAA and PTR records for a client. Stale records are
+// for a client that is offline and have the time it was last seen.
+func (t *Client) addClient(records *Records, e *entry, src string, stale bool) {
 
-		if name == "" {
-			name = client.Hostname
+	var lastSeen *time.Time
+	if !e.LastSeen.IsZero() {
+		v := e.LastSeen
+		lastSeen = &v
+	}
+
+	addRecord := func(ip, iptype string) {
+
+		arpa, err := util.GetARPA(ip)
+
+		if err != nil {
+			zap.L().Debug(fmt.Sprintf("Client %s has an invalid IP; error %s", e.Hostname, err.Error()))
+			return
 		}
 
-		if name == "" {
-			zap.L().Debug(fmt.Sprintf("Client with MAC=%s and IP=%s does not have a name", client.Mac, client.IP))
-			continue
+		a := &ARecord{
+			Hostname: e.Hostname,
+			Domain:   e.Domain,
+			IP:       ip,
+			MAC:      e.MAC,
+			SRC:      src,
+			Stale:    stale,
+			LastSeen: lastSeen,
 		}
 
-		ipV6 := getIpV6String(client.Ipv6Address)
+		switch iptype {
+		case "A":
+			records.AddARecords(a)
+
+		case "AAAA":
+			records.AddAAAARecords(a)
+
+		default:
+			panic("this should not happen")
 
-		if client.IP == "" && ipV6 == "" {
-			zap.L().Debug(fmt.Sprintf("Client %s does not have an IPv4 or IPv6", name))
-			continue
 		}
 
-		addRecord := func(ip, iptype string) {
+		p := &PTRrecord{
+			ARPA:     arpa,
+			Hostname: e.Hostname,
+			Domain:   e.Domain,
+			SRC:      src,
+			Stale:    stale,
+			LastSeen: lastSeen,
+		}
 
-			arpa, err := util.GetARPA(ip)
+		records.AddPtrRecords(p)
+	}
 
-			if err != nil {
-				zap.L().Debug(fmt.Sprintf("Client %s has an invalid IP; error %s", name, err.Error()))
-				return
-			}
+	for _, ip := range e.IPv4 {
+		addRecord(ip, "A")
+	}
 
-			a := &ARecord{
-				Hostname: name,
-				Domain:   t.domain,
-				IP:       ip,
-				SRC:      source + ":unifi-client",
-			}
+	for _, ip := range e.IPv6 {
+		addRecord(ip, "AAAA")
+	}
+}
 
-			switch iptype {
-			case "A":
-				records.AddARecords(a)
+// clientSubject returns what the rules are matched against for a client
+func clientSubject(client *unifi.UnifiClient, network string) *subject {
+	wired := client.IsWired
+	return &subject{
+		source:  types.UnifiSourceClient,
+		mac:     client.Mac,
+		names:   []string{client.Name, client.Hostname},
+		network: network,
+		vlan:    int(client.Vlan),
+		wired:   &wired,
+		guest:   client.IsGuest,
+	}
+}
 
-			case "AAAA":
-				records.AddAAAARecords(a)
+// getNetworkName returns the name of the network the client is on. A client
+// may be moved to another network by a virtual network override.
+func getNetworkName(client *unifi.UnifiClient, networks map[string]string) string {
 
-			default:
-				panic("this should not happen")
+	if client.VirtualNetworkOverrideEnabled {
+		if name, ok := networks[client.VirtualNetworkOverrideID]; ok {
+			return name
+		}
+	}
 
-			}
+	if client.NetworkName != "" {
+		return client.NetworkName
+	}
 
-			p := &PTRrecord{
-				ARPA:     arpa,
-				Hostname: name,
-				Domain:   t.domain,
-				SRC:      source + ":unifi-client",
-			}
+	return networks[client.NetworkID]
+}
 
-			records.AddPtrRecords(p)
+// toSubdomain returns the configured subdomain with each of its labels made a
+// valid hostname label
+func toSubdomain(subdomain string) string {
+
+	var labels []string
+
+	for _, label := range strings.Split(subdomain, ".") {
+		if label = util.ToLabel(label); label != "" {
+			labels = append(labels, label)
+		}
+	}
+
+	return strings.Join(labels, ".")
+}
+
+// GetRecords() (*Records, error)
+func (t *Client) GetRecords() (*Records, error) {
+
+	clients, err := t.api.getClients(t.site)
+	if err != nil {
+		return nil, err
+	}
+
+	enrichedConfigs, err := t.api.getEnrichedConfiguration(t.site)
+	if err != nil {
+		return nil, err
+	}
+
+	records := &Records{}
+
+	networks := make(map[string]string)
+	domainNames := []string{t.getNetworkDomain("")}
+
+	for _, enrichedConfig := range enrichedConfigs {
+		networks[enrichedConfig.Configuration.ID] = enrichedConfig.Configuration.Name
+		domainNames = append(domainNames, t.getNetworkDomain(enrichedConfig.Configuration.Name))
+	}
+
+	domainNames = append(domainNames, t.getReverseZones(enrichedConfigs)...)
+
+	t.mutex.Lock()
+	t.domainNames = domainNames
+	t.mutex.Unlock()
+
+	var active []*entry
+
+	for _, client := range clients {
+
+		e := t.getEntry(&client, networks)
+		if e == nil {
+			continue
 		}
 
-		if client.IP != "" {
-			addRecord(client.IP, "A")
+		// A client may have a fixed IP that differs from the IP it has now
+		if t.config.AllIPs && client.UseFixedip {
+			e.IPv4 = compact(append(e.IPv4, client.FixedIP))
 		}
 
-		if ipV6 != "" {
-			addRecord(ipV6, "AAAA")
+		if len(e.IPv4) == 0 && len(e.IPv6) == 0 {
+			zap.L().Debug(fmt.Sprintf("Client %s does not have an IPv4 or IPv6", e.Hostname))
+			continue
 		}
 
+		active = append(active, e)
 	}
 
-	for _, enrichedConfig := range enrichedConfigs {
+	collisions := t.resolveCollisions(active)
+
+	for _, collision := range collisions {
+		var hostnames []string
+		for _, client := range collision.Clients {
+			hostnames = append(hostnames, client.Hostname+" ("+client.MAC+")")
+		}
+		zap.L().Debug(fmt.Sprintf("Unifi clients named %s in %s are %s", collision.Name, collision.Domain, strings.Join(hostnames, ", ")))
+	}
 
-		// TODO add IPv6 support here
-		// enrichedConfig.Configuration.Ipv6ClientAddressAssignment
+	t.mutex.Lock()
+	t.nameCollisions = collisions
+	t.mutex.Unlock()
 
-		name := strings.ToLower(enrichedConfig.Configuration.Name)
-		ip := strings.Split(enrichedConfig.Configuration.IPSubnet, "/")[0]
+	for _, e := range active {
+		t.addClient(records, e, source+":unifi-client", false)
+	}
+
+	if t.config.KnownClients || t.config.Retention > 0 {
+		if err := t.addOffline(records, active, networks); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, enrichedConfig := range enrichedConfigs {
+
+		name := util.ToLabel(enrichedConfig.Configuration.Name)
 
 		if name == "" {
 			zap.L().Debug("Interface is missing its name")
@@ -171,47 +443,75 @@ func (t *Client) GetRecords() (*Records, error) {
 			zap.L().Debug("Skipping default interface")
 		}
 
-		if ip == "" {
-			zap.L().Debug(fmt.Sprintf("Interface %s is missing its ip", enrichedConfig.Configuration.Name))
-			continue
+		ips := compact([]string{strings.Split(enrichedConfig.Configuration.IPSubnet, "/")[0]})
+
+		ipv6, _, err := t.getIPv6Subnet(enrichedConfig)
+		if err != nil {
+			zap.L().Debug(fmt.Sprintf("Interface %s has an invalid IPv6 config; error %s", enrichedConfig.Configuration.Name, err.Error()))
 		}
 
-		interfaceName := "inf-" + name + "-"
-		interfaceName += strings.Replace(ip, ".", "-", -1)
+		ips = compact(append(ips, ipv6))
 
-		arpa, err := util.GetARPA(ip)
-		if err != nil {
-			zap.L().Debug(fmt.Sprintf("Interface %s has an invalid IP; error %s", name, err.Error()))
+		if len(ips) == 0 {
+			zap.L().Debug(fmt.Sprintf("Interface %s is missing its ip", enrichedConfig.Configuration.Name))
 			continue
 		}
 
-		a := &ARecord{
-			Hostname: interfaceName,
-			Domain:   t.domain,
-			IP:       ip,
-			SRC:      source + ":unifi-interface",
+		if !t.isIncluded(&subject{
+			source:  types.UnifiSourceInterface,
+			names:   []string{enrichedConfig.Configuration.Name},
+			network: enrichedConfig.Configuration.Name,
+			guest:   enrichedConfig.Configuration.Purpose == "guest",
+		}) {
+			zap.L().Debug(fmt.Sprintf("Interface %s is excluded", enrichedConfig.Configuration.Name))
+			continue
 		}
 
-		records.AddARecords(a)
+		for _, ip := range ips {
 
-		p := &PTRrecord{
-			ARPA:     arpa,
-			Hostname: interfaceName,
-			Domain:   t.domain,
-			SRC:      source + ":unifi-interface",
-		}
+			interfaceName := "inf-" + name + "-"
+			interfaceName += strings.NewReplacer(".", "-", ":", "-").Replace(ip)
 
-		records.AddPtrRecords(p)
+			arpa, err := util.GetARPA(ip)
+			if err != nil {
+				zap.L().Debug(fmt.Sprintf("Interface %s has an invalid IP; error %s", name, err.Error()))
+				continue
+			}
+
+			a := &ARecord{
+				Hostname: interfaceName,
+				Domain:   t.domain,
+				IP:       ip,
+				SRC:      source + ":unifi-interface",
+			}
+
+			if strings.Contains(ip, ":") {
+				records.AddAAAARecords(a)
+			} else {
+				records.AddARecords(a)
+			}
+
+			p := &PTRrecord{
+				ARPA:     arpa,
+				Hostname: interfaceName,
+				Domain:   t.domain,
+				SRC:      source + ":unifi-interface",
+			}
+
+			records.AddPtrRecords(p)
+		}
 	}
 
-	devices, err := t.unifiClient.GetDevices()
+	devices, err := t.api.getDevices(t.site)
 	if err != nil {
 		return nil, err
 	}
 
 	for _, device := range devices.NetworkDevices {
 
-		if device.Name == "" {
+		name := util.ToLabel(device.Name)
+
+		if name == "" {
 			zap.L().Debug("Device is missing its name")
 			continue
 		}
@@ -221,54 +521,69 @@ func (t *Client) GetRecords() (*Records, error) {
 			continue
 		}
 
-		if t.config.IgnoreMac(device.Mac) {
+		if !t.isIncluded(&subject{
+			source:  types.UnifiSourceDevice,
+			mac:     device.Mac,
+			names:   []string{device.Name},
+			network: device.ConnectionNetworkName,
+		}) {
 			zap.L().Debug(fmt.Sprintf("Ignoring mac %s with name %s", device.Mac, device.Name))
 			continue
 		}
 
-		arpa, err := util.GetARPA(device.IP)
-		if err != nil {
-			zap.L().Debug(fmt.Sprintf("Device %s has an invalid IP; error %s", device.Name, err.Error()))
-			continue
-		}
+		ips := []string{device.IP}
 
-		a := &ARecord{
-			Hostname: device.Name,
-			Domain:   t.domain,
-			IP:       device.IP,
-			SRC:      source + ":unifi-device",
+		// A gateway has a LAN IP as well as the IP it is managed on
+		if t.config.AllIPs {
+			ips = compact(append(ips, device.LanIP))
 		}
 
-		records.AddARecords(a)
+		for _, ip := range ips {
 
-		p := &PTRrecord{
-			ARPA:     arpa,
-			Hostname: device.Name,
-			Domain:   t.domain,
-			SRC:      source + ":unifi-device",
-		}
+			arpa, err := util.GetARPA(ip)
+			if err != nil {
+				zap.L().Debug(fmt.Sprintf("Device %s has an invalid IP; error %s", device.Name, err.Error()))
+				continue
+			}
 
-		records.AddPtrRecords(p)
+			a := &ARecord{
+				Hostname: name,
+				Domain:   t.domain,
+				IP:       ip,
+				MAC:      device.Mac,
+				SRC:      source + ":unifi-device",
+			}
+
+			records.AddARecords(a)
+
+			p := &PTRrecord{
+				ARPA:     arpa,
+				Hostname: name,
+				Domain:   t.domain,
+				SRC:      source + ":unifi-device",
+			}
+
+			records.AddPtrRecords(p)
+		}
 	}
 
 	return records, nil
 
 }
 
-func getIpV6String(input []string) string {
+// compact returns the IPs without empty and repeated values
+func compact(ips []string) []string {
 
-	ipV6 := ""
-	ipV6Len := len(input)
+	var result []string
+	seen := make(map[string]bool)
 
-	if ipV6Len > 0 {
-		for i, v := range input {
-			if i == ipV6Len-1 {
-				ipV6 = ipV6 + v
-			} else {
-				ipV6 = ipV6 + v + ":"
-			}
+	for _, ip := range ips {
+		if ip == "" || seen[ip] {
+			continue
 		}
+		seen[ip] = true
+		result = append(result, ip)
 	}
 
-	return ipV6
+	return result
 }
@@ -0,0 +1,444 @@
+package unifi_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jodydadescott/home-server/types"
+	"github.com/jodydadescott/home-server/unifi"
+	"github.com/jodydadescott/home-server/unifi/unifitest"
+)
+
+// getRecords returns the records of the only site of the config
+func getRecords(t *testing.T, config *types.UnifiConfig) (*unifi.Client, *types.DomainRecords) {
+
+	t.Helper()
+
+	clients := unifi.New(config)
+	if len(clients) != 1 {
+		t.Fatalf("expected 1 client, got %d", len(clients))
+	}
+
+	records, err := clients[0].GetRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return clients[0], records
+}
+
+// ips returns the sorted IPs of the records for the name
+func ips(records []*types.ARecord, name string) []string {
+
+	var result []string
+	for _, r := range records {
+		if r.Hostname+"."+r.Domain == name {
+			result = append(result, r.IP)
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+func expectIPs(t *testing.T, records []*types.ARecord, name string, expected ...string) {
+	t.Helper()
+	got := ips(records, name)
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("%s: expected %v, got %v", name, expected, got)
+	}
+}
+
+func expectPTR(t *testing.T, records *types.DomainRecords, arpa, name string) {
+
+	t.Helper()
+
+	for _, r := range records.PtrRecords {
+		if r.ARPA == arpa {
+			if got := r.Hostname + "." + r.Domain; got != name {
+				t.Errorf("%s: expected %s, got %s", arpa, name, got)
+			}
+			return
+		}
+	}
+
+	t.Errorf("%s: expected %s, got no record", arpa, name)
+}
+
+func TestGetRecords(t *testing.T) {
+
+	controller := unifitest.New()
+	defer controller.Close()
+
+	_, records := getRecords(t, controller.Config())
+
+	expectIPs(t, records.ARecords, "jodys-iphone-2.home", "192.168.1.20")
+	expectIPs(t, records.ARecords, "living-room-tv.home", "192.168.20.30")
+	expectIPs(t, records.ARecords, "xn--caf-tv-dva.home", "192.168.20.31")
+	expectIPs(t, records.ARecords, "pixel-7.home", "192.168.50.10")
+
+	// The link-local address is left out by the default policy
+	expectIPs(t, records.AAAARecords, "jodys-iphone-2.home", "2001:db8:0:ab01:3e22:fbff:fe11:2233", "2001:db8:0:ab01:8d1c:2e3f:4a5b:6c7d")
+
+	// The client without a name does not have a record
+	for _, r := range records.ARecords {
+		if r.IP == "192.168.1.99" {
+			t.Errorf("client without a name has record %s", r.GetKey())
+		}
+	}
+
+	expectIPs(t, records.ARecords, "inf-default-192-168-1-1.home", "192.168.1.1")
+	expectIPs(t, records.ARecords, "inf-iot-devices-192-168-20-1.home", "192.168.20.1")
+	expectIPs(t, records.ARecords, "inf-lab-10-10-0-1.home", "10.10.0.1")
+	expectIPs(t, records.AAAARecords, "inf-lab-fd12-3456--1.home", "fd12:3456::1")
+
+	expectIPs(t, records.ARecords, "udm-pro.home", "203.0.113.2")
+	expectIPs(t, records.ARecords, "office-switch.home", "192.168.1.2")
+
+	expectPTR(t, records, "20.1.168.192.in-addr.arpa.", "jodys-iphone-2.home")
+	expectPTR(t, records, "3.3.2.2.1.1.e.f.f.f.b.f.2.2.e.3.1.0.b.a.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", "jodys-iphone-2.home")
+}
+
+func TestAllIPs(t *testing.T) {
+
+	controller := unifitest.New()
+	defer controller.Close()
+
+	config := controller.Config()
+	config.AllIPs = true
+
+	_, records := getRecords(t, config)
+
+	expectIPs(t, records.ARecords, "udm-pro.home", "192.168.1.1", "203.0.113.2")
+}
+
+func TestCollisions(t *testing.T) {
+
+	controller := unifitest.New()
+	defer controller.Close()
+
+	tests := []struct {
+		collisions string
+		first      string
+		second     string
+	}{
+		{"", "laptop.home", "laptop-2.home"},
+		{types.UnifiCollisionsNumber, "laptop.home", "laptop-2.home"},
+		{types.UnifiCollisionsMAC, "laptop.home", "laptop-000002.home"},
+		{types.UnifiCollisionsMerge, "laptop.home", "laptop.home"},
+	}
+
+	for _, test := range tests {
+
+		config := controller.Config()
+		config.Collisions = test.collisions
+
+		client, records := getRecords(t, config)
+
+		if test.first == test.second {
+			expectIPs(t, records.ARecords, test.first, "192.168.1.40", "192.168.1.41")
+		} else {
+			// The clients are numbered in order of their MAC
+			expectIPs(t, records.ARecords, test.first, "192.168.1.40")
+			expectIPs(t, records.ARecords, test.second, "192.168.1.41")
+		}
+
+		collisions := client.GetCollisions()
+		if len(collisions) != 1 {
+			t.Fatalf("%s: expected 1 collision, got %d", test.collisions, len(collisions))
+		}
+
+		collision := collisions[0]
+		if collision.Name != "laptop" || collision.Domain != "home" || len(collision.Clients) != 2 {
+			t.Errorf("%s: unexpected collision %+v", test.collisions, collision)
+		}
+
+		if collision.Clients[1].MAC != "f0:18:98:00:00:02" || collision.Clients[1].Hostname+".home" != test.second {
+			t.Errorf("%s: unexpected client %+v", test.collisions, collision.Clients[1])
+		}
+	}
+}
+
+// TestCollisionSkipsTakenNames checks that a suffixed name is not given to a
+// client if another client has it
+func TestCollisionSkipsTakenNames(t *testing.T) {
+
+	controller := unifitest.New()
+	defer controller.Close()
+
+	clients := controller.GetClients(unifitest.DefaultSite)
+	clients[0].Name = "laptop-2"
+	controller.SetFixture(unifitest.DefaultSite, unifitest.Clients, clients)
+
+	_, records := getRecords(t, controller.Config())
+
+	expectIPs(t, records.ARecords, "laptop-2.home", "192.168.1.20")
+	expectIPs(t, records.ARecords, "laptop-3.home", "192.168.1.41")
+}
+
+func TestNameTemplate(t *testing.T) {
+
+	controller := unifitest.New()
+	defer controller.Close()
+
+	config := controller.Config()
+	config.NameTemplate = "{{if .Name}}{{.Name}}{{else}}{{.OUI}} {{.MAC}}{{end}}"
+
+	_, records := getRecords(t, config)
+
+	expectIPs(t, records.ARecords, "living-room-tv.home", "192.168.20.30")
+	expectIPs(t, records.ARecords, "cimsys-inc-00-11-22-33-44-55.home", "192.168.1.99")
+	expectIPs(t, records.ARecords, "apple-inc-f0-18-98-00-00-01.home", "192.168.1.40")
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected a panic for a template with a field that does not exist")
+			}
+		}()
+		config := controller.Config()
+		config.NameTemplate = "{{.Vendor}}"
+		unifi.New(config)
+	}()
+}
+
+func TestRules(t *testing.T) {
+
+	controller := unifitest.New()
+	defer controller.Close()
+
+	yes := true
+
+	config := controller.Config()
+	config.AddIgnoreMacs("74:AC:B9:00:00:02")
+	config.AddRules(
+		// The TV is included even though it is wired on the IoT network
+		&types.UnifiRule{Action: types.UnifiRuleInclude, Name: "(?i)tv$", Wired: &yes},
+		&types.UnifiRule{Action: types.UnifiRuleExclude, Sources: []string{types.UnifiSourceClient}, Guest: &yes},
+		&types.UnifiRule{Action: types.UnifiRuleExclude, Sources: []string{types.UnifiSourceClient}, RandomMAC: &yes},
+		&types.UnifiRule{Action: types.UnifiRuleExclude, Network: "iot devices"},
+		&types.UnifiRule{Action: types.UnifiRuleExclude, OUI: "f0-18-98", Wired: new(bool)},
+		&types.UnifiRule{Action: types.UnifiRuleExclude, Sources: []string{types.UnifiSourceInterface}, Guest: &yes},
+		&types.UnifiRule{Action: types.UnifiRuleExclude, Sources: []string{types.UnifiSourceDevice}, MAC: "74:ac:b9:*:01"},
+	)
+
+	_, records := getRecords(t, config)
+
+	expectIPs(t, records.ARecords, "living-room-tv.home", "192.168.20.30")
+	expectIPs(t, records.ARecords, "xn--caf-tv-dva.home")
+	expectIPs(t, records.ARecords, "pixel-7.home")
+	expectIPs(t, records.ARecords, "jodys-iphone-2.home", "192.168.1.20")
+
+	// Only the wired laptop is left so it does not collide
+	expectIPs(t, records.ARecords, "laptop.home", "192.168.1.40")
+	expectIPs(t, records.ARecords, "laptop-2.home")
+
+	expectIPs(t, records.ARecords, "inf-iot-devices-192-168-20-1.home")
+	expectIPs(t, records.ARecords, "inf-guest-192-168-50-1.home")
+	expectIPs(t, records.ARecords, "inf-default-192-168-1-1.home", "192.168.1.1")
+
+	expectIPs(t, records.ARecords, "udm-pro.home")
+	expectIPs(t, records.ARecords, "office-switch.home")
+}
+
+func TestIPv6(t *testing.T) {
+
+	controller := unifitest.New()
+	defer controller.Close()
+
+	tests := []struct {
+		policy   string
+		expected []string
+	}{
+		{types.UnifiIPv6Global, []string{"2001:db8:0:ab01:3e22:fbff:fe11:2233", "2001:db8:0:ab01:8d1c:2e3f:4a5b:6c7d"}},
+		{types.UnifiIPv6Stable, []string{"2001:db8:0:ab01:3e22:fbff:fe11:2233"}},
+		{types.UnifiIPv6All, []string{"2001:db8:0:ab01:3e22:fbff:fe11:2233", "2001:db8:0:ab01:8d1c:2e3f:4a5b:6c7d", "fe80::3e22:fbff:fe11:2233"}},
+		{types.UnifiIPv6None, nil},
+	}
+
+	for _, test := range tests {
+		config := controller.Config()
+		config.IPv6Policy = test.policy
+		_, records := getRecords(t, config)
+		expectIPs(t, records.AAAARecords, "jodys-iphone-2.home", test.expected...)
+	}
+
+	config := controller.Config()
+	config.IPv6Prefix = "2001:db8:0:ab00::/56"
+
+	client, records := getRecords(t, config)
+
+	// The default network has subnet ID 1 in the delegated prefix
+	expectIPs(t, records.AAAARecords, "inf-default-2001-db8-0-ab01--1.home", "2001:db8:0:ab01::1")
+	expectPTR(t, records, "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.1.0.b.a.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", "inf-default-2001-db8-0-ab01--1.home")
+
+	zones := strings.Join(client.GetDomainNames(), " ")
+	for _, zone := range []string{"b.a.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa", "0.0.0.0.0.0.0.0.6.5.4.3.2.1.d.f.ip6.arpa", "1.168.192.in-addr.arpa"} {
+		if !strings.Contains(zones, zone) {
+			t.Errorf("expected reverse zone %s in %s", zone, zones)
+		}
+	}
+}
+
+func TestNetworkSubdomains(t *testing.T) {
+
+	controller := unifitest.New()
+	defer controller.Close()
+
+	config := controller.Config()
+	config.NetworkSubdomains = true
+	config.AddSubdomainMap("Default", "").AddSubdomainMap("iot devices", "iot")
+
+	_, records := getRecords(t, config)
+
+	expectIPs(t, records.ARecords, "jodys-iphone-2.home", "192.168.1.20")
+	expectIPs(t, records.ARecords, "living-room-tv.iot.home", "192.168.20.30")
+
+	// The network of this client is only known by its ID
+	expectIPs(t, records.ARecords, "xn--caf-tv-dva.iot.home", "192.168.20.31")
+	expectIPs(t, records.ARecords, "pixel-7.guest.home", "192.168.50.10")
+
+	// Devices stay in the domain
+	expectIPs(t, records.ARecords, "office-switch.home", "192.168.1.2")
+}
+
+func TestKnownClients(t *testing.T) {
+
+	controller := unifitest.New()
+	defer controller.Close()
+
+	config := controller.Config()
+	config.KnownClients = true
+
+	_, records := getRecords(t, config)
+
+	expectIPs(t, records.ARecords, "printer.home", "192.168.20.5")
+	expectIPs(t, records.ARecords, "raspberrypi.home")
+
+	for _, r := range records.ARecords {
+		if r.Hostname == "printer" && r.SRC != "unifi:unifi-known" {
+			t.Errorf("expected source unifi:unifi-known, got %s", r.SRC)
+		}
+	}
+}
+
+func TestRetention(t *testing.T) {
+
+	controller := unifitest.New()
+	defer controller.Close()
+
+	config := controller.Config()
+	config.Retention = time.Hour
+	config.StateFile = t.TempDir() + "/state.json"
+
+	getRecords(t, config)
+
+	// The TV goes offline
+	var online []any
+	for _, client := range controller.GetClients(unifitest.DefaultSite) {
+		if client.Name != "Living Room TV" {
+			online = append(online, client)
+		}
+	}
+	controller.SetFixture(unifitest.DefaultSite, unifitest.Clients, online)
+
+	// A new client is used so the state is loaded from the file
+	_, records := getRecords(t, config)
+
+	expectIPs(t, records.ARecords, "living-room-tv.home", "192.168.20.30")
+
+	for _, r := range records.ARecords {
+		if r.Hostname == "living-room-tv" && (!r.Stale || r.LastSeen == nil) {
+			t.Errorf("expected a stale record with the time it was last seen, got %+v", r)
+		}
+	}
+}
+
+func TestSites(t *testing.T) {
+
+	controller := unifitest.New()
+	defer controller.Close()
+
+	controller.AddSite("lab")
+	controller.SetFixture("lab", unifitest.Clients, `[{"mac":"02:00:00:00:00:01","name":"Scope","ip":"10.10.0.50"}]`)
+
+	clients := unifi.New(controller.Config("default", "lab"))
+	if len(clients) != 2 {
+		t.Fatalf("expected 2 clients, got %d", len(clients))
+	}
+
+	for _, client := range clients {
+		if !strings.HasPrefix(client.GetName(), "unifi:127.0.0.1:") {
+			t.Errorf("unexpected provider name %s", client.GetName())
+		}
+	}
+
+	records, err := clients[1].GetRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectIPs(t, records.ARecords, "scope.home", "10.10.0.50")
+	expectIPs(t, records.ARecords, "jodys-iphone-2.home")
+
+	if _, err := clients[0].GetRecords(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The sites share the login
+	if logins := controller.Logins(); logins != 1 {
+		t.Errorf("expected 1 login, got %d", logins)
+	}
+
+	if requests := controller.Requests("lab", unifitest.Clients); requests != 1 {
+		t.Errorf("expected 1 request for the clients of the lab site, got %d", requests)
+	}
+}
+
+func TestExpiredSession(t *testing.T) {
+
+	controller := unifitest.New()
+	defer controller.Close()
+
+	client, _ := getRecords(t, controller.Config())
+
+	controller.ExpireSessions()
+
+	if _, err := client.GetRecords(); err != nil {
+		t.Fatal(err)
+	}
+
+	if logins := controller.Logins(); logins != 2 {
+		t.Errorf("expected 2 logins, got %d", logins)
+	}
+}
+
+func TestInvalidCredentials(t *testing.T) {
+
+	controller := unifitest.New()
+	defer controller.Close()
+
+	config := controller.Config()
+	config.Password = "wrong"
+
+	if _, err := unifi.New(config)[0].GetRecords(); err == nil {
+		t.Error("expected an error for invalid credentials")
+	}
+}
+
+// TestUnknownFields checks that fields added by newer firmware do not break
+// the decoding of the responses
+func TestUnknownFields(t *testing.T) {
+
+	controller := unifitest.New()
+	defer controller.Close()
+
+	controller.SetFixture(unifitest.DefaultSite, unifitest.Clients, `[{"mac":"3c:22:fb:11:22:33","name":"Phone","ip":"192.168.1.20","new_field":{"a":[1,2]},"ipv6_address":[]}]`)
+
+	_, records := getRecords(t, controller.Config())
+
+	expectIPs(t, records.ARecords, "phone.home", "192.168.1.20")
+	expectIPs(t, records.AAAARecords, "phone.home")
+}
@@ -0,0 +1,270 @@
+// Package unifitest provides a fake Unifi controller for tests. It serves the
+// login, clients, devices, network configuration and known clients endpoints
+// of the Unifi Network API from fixtures. The fixtures are the responses of a
+// controller and can be replaced for each site to test other responses.
+package unifitest
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/jodydadescott/unifi-go-sdk"
+
+	"github.com/jodydadescott/home-server/types"
+)
+
+const (
+	Username = "homeauto"
+	Password = "password"
+
+	// DefaultSite is the site that has the fixtures when the controller is
+	// created
+	DefaultSite = "default"
+
+	// The fixtures for each site
+	Clients      = "clients"
+	Devices      = "devices"
+	Networks     = "networks"
+	KnownClients = "known"
+
+	authCookie = "TOKEN"
+	sitePrefix = "/proxy/network/v2/api/site/"
+	oldPrefix  = "/proxy/network/api/s/"
+)
+
+//go:embed fixtures
+var fixtures embed.FS
+
+// Controller is a fake Unifi controller. It is a TLS server with a self signed
+// certificate as a controller is.
+type Controller struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	sites    map[string]map[string][]byte
+	sessions map[string]bool
+	logins   int
+	requests map[string]int
+}
+
+// New returns a running controller with the fixtures on the default site. It
+// should be closed when the test is done.
+func New() *Controller {
+
+	t := &Controller{
+		sites:    make(map[string]map[string][]byte),
+		sessions: make(map[string]bool),
+		requests: make(map[string]int),
+	}
+
+	t.AddSite(DefaultSite)
+	t.Server = httptest.NewTLSServer(http.HandlerFunc(t.serveHTTP))
+
+	return t
+}
+
+// Config returns the Unifi config for the controller with the sites
+func (t *Controller) Config(sites ...string) *types.UnifiConfig {
+	config := &types.UnifiConfig{Enabled: true}
+	config.Hostname = t.URL
+	config.Username = Username
+	config.Password = Password
+	config.AddSites(sites...)
+	return config
+}
+
+// AddSite adds a site with the fixtures
+func (t *Controller) AddSite(site string) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.sites[site] = make(map[string][]byte)
+
+	for _, name := range []string{Clients, Devices, Networks, KnownClients} {
+		b, err := fixtures.ReadFile("fixtures/" + name + ".json")
+		if err != nil {
+			panic(err)
+		}
+		t.sites[site][name] = b
+	}
+}
+
+// SetFixture replaces the response for the fixture of the site with v. The
+// site is added if it does not exist. If v is a []byte or string it is the
+// response otherwise it is encoded as JSON.
+func (t *Controller) SetFixture(site, name string, v any) {
+
+	var b []byte
+
+	switch v := v.(type) {
+
+	case []byte:
+		b = v
+
+	case string:
+		b = []byte(v)
+
+	default:
+		var err error
+		b, err = json.Marshal(v)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.sites[site] == nil {
+		t.sites[site] = make(map[string][]byte)
+	}
+
+	t.sites[site][name] = b
+}
+
+// GetClients returns the clients of the site decoded from its fixture so a test
+// can change them and set them with SetFixture
+func (t *Controller) GetClients(site string) []unifi.UnifiClient {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var clients []unifi.UnifiClient
+	if err := json.Unmarshal(t.sites[site][Clients], &clients); err != nil {
+		panic(err)
+	}
+
+	return clients
+}
+
+// Logins returns the number of successful logins
+func (t *Controller) Logins() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.logins
+}
+
+// Requests returns the number of requests for the fixture of the site
+func (t *Controller) Requests(site, name string) int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.requests[site+"/"+name]
+}
+
+// ExpireSessions makes the controller return 401 for the cookies it has given
+// out as it does when they expire
+func (t *Controller) ExpireSessions() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.sessions = make(map[string]bool)
+}
+
+func (t *Controller) serveHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if r.URL.Path == "/api/auth/login" {
+		t.login(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cookie, err := r.Cookie(authCookie)
+
+	t.mutex.Lock()
+	authorized := err == nil && t.sessions[cookie.Value]
+	t.mutex.Unlock()
+
+	if !authorized {
+		http.Error(w, `{"error":{"code":401,"message":"Unauthorized"}}`, http.StatusUnauthorized)
+		return
+	}
+
+	site, name := route(r.URL.Path)
+	if name == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	t.mutex.Lock()
+	b, ok := t.sites[site][name]
+	t.requests[site+"/"+name]++
+	t.mutex.Unlock()
+
+	if !ok {
+		http.Error(w, fmt.Sprintf(`{"errorCode":404,"message":"site %s not found"}`, site), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func (t *Controller) login(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request unifi.AuthRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if request.Username != Username || request.Password != Password {
+		http.Error(w, `{"code":"AUTHENTICATION_FAILED_INVALID_CREDENTIALS","message":"Invalid username or password"}`, http.StatusUnauthorized)
+		return
+	}
+
+	t.mutex.Lock()
+	t.logins++
+	token := fmt.Sprintf("session-%d", t.logins)
+	t.sessions[token] = true
+	t.mutex.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: authCookie, Value: token, Path: "/", HttpOnly: true, Secure: true})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"username":"` + Username + `"}`))
+}
+
+// route returns the site and fixture for the path of a request
+func route(path string) (string, string) {
+
+	if strings.HasPrefix(path, oldPrefix) {
+		site, rest, _ := strings.Cut(strings.TrimPrefix(path, oldPrefix), "/")
+		if rest == "rest/user" {
+			return site, KnownClients
+		}
+		return "", ""
+	}
+
+	if !strings.HasPrefix(path, sitePrefix) {
+		return "", ""
+	}
+
+	site, rest, _ := strings.Cut(strings.TrimPrefix(path, sitePrefix), "/")
+
+	switch rest {
+
+	case "clients/active":
+		return site, Clients
+
+	case "device":
+		return site, Devices
+
+	case "lan/enriched-configuration":
+		return site, Networks
+
+	}
+
+	return "", ""
+}
@@ -0,0 +1,68 @@
+package util
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+)
+
+// MaxLabel is the most characters a hostname label can have
+const MaxLabel = 63
+
+var invalidLabel = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// ToLabel returns the name as a valid RFC 1123 hostname label. Apostrophes
+// and quotes are removed so "Jody's iPhone (2)" is jodys-iphone-2 and each
+// other run of characters that are not letters or digits is a dash. A name with
+// letters that are not ASCII is encoded with IDNA so "Café TV" is
+// xn--caf-tv-dva. The label is at most 63 characters.
+func ToLabel(name string) string {
+
+	var b strings.Builder
+	dash := false
+	ascii := true
+
+	for _, r := range strings.ToLower(name) {
+
+		switch {
+
+		case r == '\'' || r == '"' || r == '‘' || r == '’' || r == '`':
+			continue
+
+		case r < unicode.MaxASCII && (r >= 'a' && r <= 'z' || r >= '0' && r <= '9'):
+			b.WriteRune(r)
+			dash = false
+
+		case r >= unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(r)
+			dash = false
+			ascii = false
+
+		default:
+			if !dash && b.Len() > 0 {
+				b.WriteByte('-')
+				dash = true
+			}
+
+		}
+	}
+
+	label := strings.TrimRight(b.String(), "-")
+
+	if !ascii {
+		encoded, err := idna.Lookup.ToASCII(label)
+		if err == nil && len(encoded) <= MaxLabel {
+			return encoded
+		}
+		// The letters that can not be encoded are dropped
+		label = strings.Trim(invalidLabel.ReplaceAllString(label, "-"), "-")
+	}
+
+	if len(label) > MaxLabel {
+		label = strings.TrimRight(label[:MaxLabel], "-")
+	}
+
+	return label
+}
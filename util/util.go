@@ -51,6 +51,85 @@ func GetARPA(ipOrArpa string) (string, error) {
 	return addTerm(result), nil
 }
 
+// GetIP returns the IP address for an in-addr.arpa or ip6.arpa name. It is
+// the inverse of GetARPA.
+func GetIP(arpa string) (string, error) {
+
+	arpa = strings.TrimSuffix(arpa, ".")
+
+	ip := ""
+
+	switch {
+	case strings.HasSuffix(arpa, IP4arpa):
+		ip = reverse(strings.Split(strings.TrimSuffix(arpa, IP4arpa), "."))
+	case strings.HasSuffix(arpa, IP6arpa):
+		ip = reverse6(strings.Split(strings.TrimSuffix(arpa, IP6arpa), "."))
+	}
+
+	if ip == "" {
+		return "", fmt.Errorf("ARPA %s is invalid", arpa)
+	}
+
+	return ip, nil
+}
+
+// ParseNetwork returns the network for the CIDR. An IP is a network of one
+// address.
+func ParseNetwork(network string) (*net.IPNet, error) {
+
+	network = strings.TrimSpace(network)
+
+	if strings.Contains(network, "/") {
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			return nil, fmt.Errorf("CIDR %s is invalid", network)
+		}
+		return ipNet, nil
+	}
+
+	ip := net.ParseIP(network)
+	if ip == nil {
+		return nil, fmt.Errorf("IP %s is invalid", network)
+	}
+
+	if ip.To4() != nil {
+		return &net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)}, nil
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// GetReverseZone returns the in-addr.arpa or ip6.arpa zone for the CIDR. The
+// prefix is shortened to a whole octet for IPv4 and a whole nibble for IPv6 so
+// that the zone is a name, such as 1.168.192.in-addr.arpa for 192.168.1.0/26.
+func GetReverseZone(cidr string) (string, error) {
+
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+
+	bits, total := network.Mask.Size()
+
+	step := 4
+	if total == 32 {
+		step = 8
+	}
+
+	bits -= bits % step
+	if bits == 0 {
+		return "", fmt.Errorf("CIDR %s is too large for a reverse zone", cidr)
+	}
+
+	mask := net.CIDRMask(bits, total)
+	zone, err := getARPA((&net.IPNet{IP: network.IP.Mask(mask), Mask: mask}).String())
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(zone, "."), nil
+}
+
 func addTerm(input string) string {
 
 	l := input[len(input)-1:]
@@ -0,0 +1,60 @@
+package util
+
+import (
+	"os"
+	"time"
+)
+
+const (
+	// WatchInterval is how often watched files are checked for changes
+	WatchInterval = time.Second * 2
+)
+
+// WatchFiles calls changed when the modification time or size of any of the
+// files changes, including when a file is created or removed. It blocks until
+// done is closed.
+func WatchFiles(done <-chan struct{}, files []string, changed func()) {
+
+	type state struct {
+		modTime time.Time
+		size    int64
+		exist   bool
+	}
+
+	get := func() map[string]state {
+		states := make(map[string]state)
+		for _, file := range files {
+			info, err := os.Stat(file)
+			if err != nil {
+				states[file] = state{}
+				continue
+			}
+			states[file] = state{modTime: info.ModTime(), size: info.Size(), exist: true}
+		}
+		return states
+	}
+
+	last := get()
+
+	ticker := time.NewTicker(WatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+
+		case <-done:
+			return
+
+		case <-ticker.C:
+			current := get()
+			for file, s := range current {
+				if last[file] != s {
+					last = current
+					changed()
+					break
+				}
+			}
+
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package zone
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+
+	"github.com/jodydadescott/home-server/types"
+	"github.com/jodydadescott/home-server/util"
+)
+
+type Config = types.ZoneConfig
+type ZoneFile = types.ZoneFile
+type ARecord = types.ARecord
+type CNameRecord = types.CNameRecord
+type PTRrecord = types.PTRrecord
+type SRVRecord = types.SRVRecord
+type TXTRecord = types.TXTRecord
+type Records = types.DomainRecords
+
+const (
+	source = "zone"
+
+	// maxIncludeDepth matches the limit of the zone parser
+	maxIncludeDepth = 7
+)
+
+// Client is a provider for the records in an RFC 1035 zone file
+type Client struct {
+	path     string
+	origin   string
+	domain   string
+	priority int
+}
+
+func New(config *Config) []*Client {
+
+	if config == nil {
+		panic("config is required")
+	}
+
+	config = config.Clone()
+
+	var clients []*Client
+
+	for _, file := range config.Files {
+
+		if file.Path == "" {
+			panic("zone file path is required")
+		}
+
+		client := &Client{
+			path:     file.Path,
+			domain:   types.DefaultDomain,
+			priority: config.Priority,
+		}
+
+		if file.Origin != "" {
+			client.origin = dns.Fqdn(strings.ToLower(file.Origin))
+			client.domain = strings.TrimSuffix(client.origin, ".")
+		}
+
+		clients = append(clients, client)
+	}
+
+	return clients
+}
+
+func (t *Client) GetName() string {
+	return source + ":" + t.path
+}
+
+func (t *Client) GetDomainName() string {
+	return t.domain
+}
+
+func (t *Client) GetRefreshDuration() time.Duration {
+	return 0
+}
+
+// GetPriority implements dns.Prioritized
+func (t *Client) GetPriority() int {
+	return t.priority
+}
+
+// Static implements dns.Static
+func (t *Client) Static() bool {
+	return true
+}
+
+// Watch implements dns.Watcher. The zone file and the files it includes are
+// watched. The included files are found again after each change.
+func (t *Client) Watch(done <-chan struct{}, changed func()) {
+
+	for {
+
+		stop := make(chan struct{})
+		finished := make(chan struct{})
+		restart := make(chan struct{}, 1)
+
+		files := t.getFiles()
+
+		go func() {
+			defer close(finished)
+			util.WatchFiles(stop, files, func() {
+				changed()
+				select {
+				case restart <- struct{}{}:
+				default:
+				}
+			})
+		}()
+
+		select {
+
+		case <-done:
+			close(stop)
+			<-finished
+			return
+
+		case <-restart:
+			close(stop)
+			<-finished
+
+		}
+	}
+}
+
+// getFiles returns the zone file and the files it includes. Relative include
+// paths are relative to the directory of the including file as they are for
+// the zone parser.
+func (t *Client) getFiles() []string {
+
+	var files []string
+	seen := make(map[string]bool)
+
+	var add func(file string, depth int)
+	add = func(file string, depth int) {
+
+		if seen[file] || depth > maxIncludeDepth {
+			return
+		}
+
+		seen[file] = true
+		files = append(files, file)
+
+		f, err := os.Open(file)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(strings.SplitN(scanner.Text(), ";", 2)[0])
+			if len(fields) < 2 || !strings.EqualFold(fields[0], "$INCLUDE") {
+				continue
+			}
+			include := fields[1]
+			if !filepath.IsAbs(include) {
+				include = filepath.Join(filepath.Dir(file), include)
+			}
+			add(include, depth+1)
+		}
+	}
+
+	add(t.path, 0)
+	return files
+}
+
+func (t *Client) GetRecords() (*Records, error) {
+
+	f, err := os.Open(t.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zp := dns.NewZoneParser(f, t.origin, t.path)
+	zp.SetIncludeAllowed(true)
+
+	var rrs []dns.RR
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		rrs = append(rrs, rr)
+	}
+
+	// The parser error has the file and line number
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+
+	return t.getRecords(rrs), nil
+}
+
+// splitName returns the hostname and domain for an owner or target name. Names
+// in the origin use the origin as the domain and other names are split at the
+// first label. Single label names can not be served and return false.
+func (t *Client) splitName(name string) (string, string, bool) {
+
+	name = strings.ToLower(dns.Fqdn(name))
+
+	if t.origin != "" && name != t.origin && dns.IsSubDomain(t.origin, name) {
+		return strings.TrimSuffix(name, "."+t.origin), t.domain, true
+	}
+
+	parts := strings.SplitN(strings.TrimSuffix(name, "."), ".", 2)
+	if len(parts) < 2 || parts[0] == "" {
+		return "", "", false
+	}
+
+	return parts[0], parts[1], true
+}
+
+// getRecords maps the resource records the same way as static records. A and
+// AAAA records get a PTR record unless the zone has one for the address. SRV
+// and TXT names such as _ipp._tcp in the origin keep every label before the
+// domain. Record types that are not served are skipped.
+func (t *Client) getRecords(rrs []dns.RR) *Records {
+
+	records := &Records{}
+	ptrRecordsMap := make(map[string]*PTRrecord)
+	var dynamic []*PTRrecord
+
+	src := source + ":" + t.path
+
+	addA := func(name string, ip string, ipv6 bool) {
+
+		hostname, domain, ok := t.splitName(name)
+		if !ok {
+			zap.L().Debug(fmt.Sprintf("Zone %s: skipping %s; name has a single label", t.path, name))
+			return
+		}
+
+		a := &ARecord{
+			Hostname: hostname,
+			Domain:   domain,
+			IP:       ip,
+			SRC:      src,
+		}
+
+		if ipv6 {
+			records.AddAAAARecords(a)
+		} else {
+			records.AddARecords(a)
+		}
+
+		arpa, err := util.GetARPA(ip)
+		if err != nil {
+			zap.L().Debug(fmt.Sprintf("Zone %s: %s has an invalid IP; error %s", t.path, name, err.Error()))
+			return
+		}
+
+		dynamic = append(dynamic, &PTRrecord{
+			ARPA:     arpa,
+			Hostname: hostname,
+			Domain:   domain,
+			SRC:      source + ":dynamic",
+		})
+	}
+
+	for _, rr := range rrs {
+
+		switch v := rr.(type) {
+
+		case *dns.A:
+			addA(v.Hdr.Name, v.A.String(), false)
+
+		case *dns.AAAA:
+			addA(v.Hdr.Name, v.AAAA.String(), true)
+
+		case *dns.CNAME:
+			aliasHostname, aliasDomain, ok := t.splitName(v.Hdr.Name)
+			if !ok {
+				zap.L().Debug(fmt.Sprintf("Zone %s: skipping CNAME %s; name has a single label", t.path, v.Hdr.Name))
+				continue
+			}
+			targetHostname, targetDomain, ok := t.splitName(v.Target)
+			if !ok {
+				zap.L().Debug(fmt.Sprintf("Zone %s: skipping CNAME %s; target %s has a single label", t.path, v.Hdr.Name, v.Target))
+				continue
+			}
+			records.AddCNameRecords(&CNameRecord{
+				AliasHostname:  aliasHostname,
+				AliasDomain:    aliasDomain,
+				TargetHostname: targetHostname,
+				TargetDomain:   targetDomain,
+				SRC:            src,
+			})
+
+		case *dns.PTR:
+			arpa := strings.ToLower(v.Hdr.Name)
+			if !strings.HasSuffix(arpa, ".in-addr.arpa.") && !strings.HasSuffix(arpa, ".ip6.arpa.") {
+				zap.L().Debug(fmt.Sprintf("Zone %s: skipping PTR %s; name is not a reverse name", t.path, v.Hdr.Name))
+				continue
+			}
+			hostname, domain, ok := t.splitName(v.Ptr)
+			if !ok {
+				zap.L().Debug(fmt.Sprintf("Zone %s: skipping PTR %s; target %s has a single label", t.path, v.Hdr.Name, v.Ptr))
+				continue
+			}
+			ptrRecordsMap[arpa] = &PTRrecord{
+				ARPA:     arpa,
+				Hostname: hostname,
+				Domain:   domain,
+				SRC:      src,
+			}
+
+		case *dns.SRV:
+			name, domain, ok := t.splitName(v.Hdr.Name)
+			if !ok {
+				zap.L().Debug(fmt.Sprintf("Zone %s: skipping SRV %s; name has a single label", t.path, v.Hdr.Name))
+				continue
+			}
+			targetHostname, targetDomain, ok := t.splitName(v.Target)
+			if !ok {
+				zap.L().Debug(fmt.Sprintf("Zone %s: skipping SRV %s; target %s has a single label", t.path, v.Hdr.Name, v.Target))
+				continue
+			}
+			records.AddSrvRecords(&SRVRecord{
+				Name:           name,
+				Domain:         domain,
+				TargetHostname: targetHostname,
+				TargetDomain:   targetDomain,
+				Port:           v.Port,
+				Priority:       v.Priority,
+				Weight:         v.Weight,
+				SRC:            src,
+			})
+
+		case *dns.TXT:
+			name, domain, ok := t.splitName(v.Hdr.Name)
+			if !ok {
+				zap.L().Debug(fmt.Sprintf("Zone %s: skipping TXT %s; name has a single label", t.path, v.Hdr.Name))
+				continue
+			}
+			records.AddTxtRecords(&TXTRecord{
+				Name:   name,
+				Domain: domain,
+				Text:   v.Txt,
+				SRC:    src,
+			})
+
+		default:
+			zap.L().Debug(fmt.Sprintf("Zone %s: skipping %s record %s", t.path, dns.TypeToString[rr.Header().Rrtype], rr.Header().Name))
+
+		}
+	}
+
+	for _, p := range dynamic {
+		if _, exist := ptrRecordsMap[p.GetKey()]; !exist {
+			ptrRecordsMap[p.GetKey()] = p
+		}
+	}
+
+	for _, p := range ptrRecordsMap {
+		records.AddPtrRecords(p)
+	}
+
+	return records
+}
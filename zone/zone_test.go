@@ -0,0 +1,67 @@
+package zone
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestGetRecords(t *testing.T) {
+
+	client := New(&Config{Files: []*ZoneFile{{Path: "testdata/home.zone", Origin: "home"}}})[0]
+
+	records, err := client.GetRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+
+	for _, r := range records.ARecords {
+		got = append(got, "A "+r.Hostname+"."+r.Domain+"="+r.IP)
+	}
+	for _, r := range records.AAAARecords {
+		got = append(got, "AAAA "+r.Hostname+"."+r.Domain+"="+r.IP)
+	}
+	for _, r := range records.CnameRecords {
+		got = append(got, "CNAME "+r.AliasHostname+"."+r.AliasDomain+"="+r.TargetHostname+"."+r.TargetDomain)
+	}
+	for _, r := range records.PtrRecords {
+		got = append(got, "PTR "+r.ARPA+"="+r.Hostname+"."+r.Domain)
+	}
+	for _, r := range records.SrvRecords {
+		got = append(got, "SRV "+r.Name+"."+r.Domain+"="+r.TargetHostname+"."+r.TargetDomain+":"+strconv.Itoa(int(r.Port))+
+			" "+strconv.Itoa(int(r.Priority))+" "+strconv.Itoa(int(r.Weight)))
+	}
+	for _, r := range records.TxtRecords {
+		got = append(got, "TXT "+r.Name+"."+r.Domain+"="+strings.Join(r.Text, ","))
+	}
+
+	sort.Strings(got)
+
+	// The SOA, NS and apex TXT records are skipped, the PTR record of the zone
+	// is used for the printer and every SRV and TXT record of a name is kept
+	expected := []string{
+		"A nas.home=192.168.1.10",
+		"A ns.home=192.168.1.2",
+		"A printer.home=192.168.1.50",
+		"AAAA nas.home=2001:db8:0:1::10",
+		"CNAME files.home=nas.home",
+		"PTR 0.1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.1.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.=nas.home",
+		"PTR 10.1.168.192.in-addr.arpa.=nas.home",
+		"PTR 2.1.168.192.in-addr.arpa.=ns.home",
+		"PTR 50.1.168.192.in-addr.arpa.=office-printer.home",
+		"SRV _ipp._tcp.home=printer.home:631 0 0",
+		"SRV _ldap._tcp.home=dc1.home:389 0 100",
+		"SRV _ldap._tcp.home=dc2.home:389 10 100",
+		"SRV _sip._udp.home=sip.example.com:5060 10 60",
+		"TXT _ipp._tcp.home=rp=ipp/print,ty=Office Printer",
+		"TXT mail.home=google-site-verification=abc",
+		"TXT mail.home=v=spf1 mx -all",
+	}
+
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}